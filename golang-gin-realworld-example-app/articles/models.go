@@ -1,23 +1,35 @@
 package articles
 
 import (
-	_ "fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"github.com/gosimple/slug"
 	"github.com/jinzhu/gorm"
+	"net/url"
 	"realworld-backend/common"
 	"realworld-backend/users"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// A Hidden article is kept from everyone but its author and moderators, see ReportModel.
 type ArticleModel struct {
 	gorm.Model
 	Slug        string `gorm:"unique_index"`
 	Title       string
 	Description string `gorm:"size:2048"`
-	Body        string `gorm:"size:2048"`
+	Body        string `gorm:"type:text"`
 	Author      ArticleUserModel
 	AuthorID    uint
 	Tags        []TagModel     `gorm:"many2many:article_tags;"`
 	Comments    []CommentModel `gorm:"ForeignKey:ArticleID"`
+	Hidden      bool
 }
 
 type ArticleUserModel struct {
@@ -42,15 +54,321 @@ type TagModel struct {
 	ArticleModels []ArticleModel `gorm:"many2many:article_tags;"`
 }
 
+// Former names of a tag which got renamed or merged, writing an alias tags the article with TagID instead.
+type TagAliasModel struct {
+	gorm.Model
+	Alias string `gorm:"unique_index"`
+	Tag   TagModel
+	TagID uint
+}
+
+// FollowedBy reads TagModel in their feed, like users.FollowModel does for authors.
+type TagFollowModel struct {
+	gorm.Model
+	Tag          TagModel
+	TagID        uint
+	FollowedBy   ArticleUserModel
+	FollowedByID uint
+}
+
+// A tag with the number of articles using it.
+type TagCount struct {
+	TagModel
+	ArticlesCount int
+}
+
+// A reply points at its parent comment, Depth counts from 0 for top level comments.
+// A Hidden comment shows up as a tombstone like a deleted one.
 type CommentModel struct {
+	gorm.Model
+	Article      ArticleModel
+	ArticleID    uint
+	Author       ArticleUserModel
+	AuthorID     uint
+	Body         string `gorm:"size:2048"`
+	ParentID     *uint
+	Depth        uint
+	EditedAt     *time.Time
+	Hidden       bool
+	RepliesCount int            `gorm:"-"`
+	Mentions     []MentionModel `gorm:"-"`
+}
+
+// Whether readers get to see the comment rather than a tombstone.
+func (comment CommentModel) visible() bool {
+	return comment.DeletedAt == nil && !comment.Hidden
+}
+
+// A user named as @username in an article, or in one of its comments when CommentID is set.
+type MentionModel struct {
 	gorm.Model
 	Article   ArticleModel
 	ArticleID uint
-	Author    ArticleUserModel
-	AuthorID  uint
+	CommentID *uint
+	User      users.UserModel
+	UserID    uint
+	Username  string
+}
+
+// The body a comment had before an edit.
+type CommentEditModel struct {
+	gorm.Model
+	Comment   CommentModel
+	CommentID uint
 	Body      string `gorm:"size:2048"`
 }
 
+// How deep replies may nest, COMMENT_MAX_DEPTH overrides the default of 5 levels.
+var MaxCommentDepth = uint(common.GetEnvInt("COMMENT_MAX_DEPTH", 5))
+
+// Every save of an article stores an immutable snapshot, Number counts from 1 per article.
+type ArticleRevisionModel struct {
+	gorm.Model
+	Article     ArticleModel
+	ArticleID   uint `gorm:"unique_index:idx_article_revision"`
+	Number      uint `gorm:"unique_index:idx_article_revision"`
+	Author      ArticleUserModel
+	AuthorID    uint
+	Title       string
+	Description string `gorm:"size:2048"`
+	Body        string `gorm:"type:text"`
+}
+
+// Old slugs of an article, kept so that links made before a rename still find it.
+type ArticleSlugModel struct {
+	gorm.Model
+	Slug      string `gorm:"unique_index"`
+	Article   ArticleModel
+	ArticleID uint
+}
+
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportResolved  = "resolved"
+)
+
+// A reader flagging an article, or one of its comments when CommentID is set, for moderators.
+// Reason is one of the codes ReportValidator accepts, once closed Action records what the moderator did.
+type ReportModel struct {
+	gorm.Model
+	Article      ArticleModel
+	ArticleID    uint
+	Comment      CommentModel
+	CommentID    *uint
+	Reporter     ArticleUserModel
+	ReporterID   uint
+	Reason       string
+	Note         string `gorm:"size:1024"`
+	Status       string
+	Action       string
+	ResolvedByID uint
+	// Set while the report is open, so a reader can't have two open reports on the same target.
+	OpenKey *string `gorm:"unique_index"`
+}
+
+// How many open reports hide an article or comment until a moderator looks at it,
+// REPORT_HIDE_THRESHOLD overrides the default of 5, 0 never hides automatically.
+var ReportHideThreshold = common.GetEnvInt("REPORT_HIDE_THRESHOLD", 5)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+// User opted in to an email with the new articles of the authors they follow every day or week.
+// LastSentAt is when the previous digest went out, the next one picks up from there.
+type DigestSubscriptionModel struct {
+	gorm.Model
+	User       ArticleUserModel
+	UserID     uint `gorm:"unique_index"`
+	Frequency  string
+	LastSentAt *time.Time
+}
+
+// At most DIGEST_MAX_ARTICLES articles, 20 by default, are listed in a digest.
+var DigestMaxArticles = common.GetEnvInt("DIGEST_MAX_ARTICLES", 20)
+
+// The secret in the URL of the private RSS and Atom feeds of User, feed readers can't log in.
+// Revoking it deletes the row, a user has one token at most.
+type FeedTokenModel struct {
+	gorm.Model
+	User   ArticleUserModel
+	UserID uint   `gorm:"unique_index"`
+	Token  string `gorm:"unique_index"`
+}
+
+// An image uploaded for an article. Key and ThumbnailKey name the scaled down image and its
+// thumbnail in common.Media, Width and Height are the ones of the image at Key.
+type ArticleImageModel struct {
+	gorm.Model
+	Article      ArticleModel
+	ArticleID    uint `gorm:"index"`
+	Key          string
+	ThumbnailKey string
+	ContentType  string
+	Width        int
+	Height       int
+	Size         int
+}
+
+// Article images are scaled down to fit ARTICLE_IMAGE_MAX_SIZE pixels, 1600 by default,
+// thumbnails to ARTICLE_THUMBNAIL_SIZE, 400 by default.
+var (
+	ArticleImageMaxSize  = common.GetEnvInt("ARTICLE_IMAGE_MAX_SIZE", 1600)
+	ArticleThumbnailSize = common.GetEnvInt("ARTICLE_THUMBNAIL_SIZE", 400)
+)
+
+// A sitemap lists at most SITEMAP_MAX_URLS urls, 50000 by default as the sitemap protocol allows.
+// Past that the sitemap becomes an index of pages holding that many each.
+var SitemapMaxURLs = common.GetEnvInt("SITEMAP_MAX_URLS", 50000)
+
+// A named list Owner saves articles into to read later. Unlike favorites nobody else gets to see them.
+type ReadingListModel struct {
+	gorm.Model
+	Owner   ArticleUserModel
+	OwnerID uint `gorm:"index"`
+	Name    string
+}
+
+// An article in a reading list, the list is read in Position order.
+type ReadingListItemModel struct {
+	gorm.Model
+	List      ReadingListModel
+	ListID    uint `gorm:"index"`
+	Article   ArticleModel
+	ArticleID uint `gorm:"index"`
+	Position  int
+}
+
+// The reactions readers leave on articles and comments, REACTIONS overrides them with a comma separated list.
+// Clients pick the emoji to show for each name.
+var Reactions = strings.Split(common.GetEnv("REACTIONS", "like,love,laugh,hooray,confused"), ",")
+
+// User reacted to Article, or to its comment when CommentID is set. A user leaves every reaction once,
+// which the unique index holds to. CommentID is 0 rather than NULL on the article itself, as NULLs never collide in it.
+type ReactionModel struct {
+	gorm.Model
+	Article   ArticleModel
+	ArticleID uint `gorm:"index;unique_index:idx_reaction"`
+	Comment   CommentModel
+	CommentID uint `gorm:"index;unique_index:idx_reaction;not null;default:0"`
+	User      ArticleUserModel
+	UserID    uint   `gorm:"unique_index:idx_reaction"`
+	Reaction  string `gorm:"unique_index:idx_reaction"`
+}
+
+// The reactions on an article or comment, how often each was left and whether the reader left it.
+type ReactionSummary struct {
+	Counts map[string]int
+	Mine   map[string]bool
+}
+
+// The roles of the authors of an article. The owner is the AuthorID of the article, co-authors
+// are the users who accepted an ArticleAuthorModel invitation.
+const (
+	ArticleRoleOwner    = "owner"
+	ArticleRoleCoauthor = "coauthor"
+)
+
+// Author was invited by the owner of Article to write it with them, AcceptedAt is set once they agreed.
+// Declined invitations are deleted.
+type ArticleAuthorModel struct {
+	gorm.Model
+	Article     ArticleModel
+	ArticleID   uint `gorm:"index"`
+	Author      ArticleUserModel
+	AuthorID    uint `gorm:"index"`
+	InvitedBy   ArticleUserModel
+	InvitedByID uint
+	AcceptedAt  *time.Time
+}
+
+// A multi-part piece by Author, its articles are read in SeriesPartModel.Position order.
+type SeriesModel struct {
+	gorm.Model
+	Slug        string `gorm:"unique_index"`
+	Title       string
+	Description string `gorm:"size:2048"`
+	Author      ArticleUserModel
+	AuthorID    uint `gorm:"index"`
+}
+
+// An article is a part of one series at most.
+type SeriesPartModel struct {
+	gorm.Model
+	Series    SeriesModel
+	SeriesID  uint `gorm:"index"`
+	Article   ArticleModel
+	ArticleID uint `gorm:"unique_index"`
+	Position  int
+}
+
+// The domain events of this package, see common.PublishEvent. They carry ids, subscribers load
+// the rest and check it's still visible, the dispatcher may run a while after the change.
+type ArticleCreated struct {
+	ArticleID uint `json:"articleId"`
+	AuthorID  uint `json:"authorId"`
+}
+
+func (ArticleCreated) EventName() string { return "article.created" }
+
+type ArticleUpdated struct {
+	ArticleID uint `json:"articleId"`
+}
+
+func (ArticleUpdated) EventName() string { return "article.updated" }
+
+type ArticleDeleted struct {
+	ArticleID uint `json:"articleId"`
+}
+
+func (ArticleDeleted) EventName() string { return "article.deleted" }
+
+// UserID is the users.UserModel who favorited the article.
+type ArticleFavorited struct {
+	ArticleID uint `json:"articleId"`
+	UserID    uint `json:"userId"`
+}
+
+func (ArticleFavorited) EventName() string { return "article.favorited" }
+
+type CommentCreated struct {
+	CommentID uint `json:"commentId"`
+	ArticleID uint `json:"articleId"`
+	AuthorID  uint `json:"authorId"`
+}
+
+func (CommentCreated) EventName() string { return "comment.created" }
+
+type CommentUpdated struct {
+	CommentID uint `json:"commentId"`
+	ArticleID uint `json:"articleId"`
+}
+
+func (CommentUpdated) EventName() string { return "comment.updated" }
+
+// ActorID mentioned UserID in the article, or in its comment when CommentID is set.
+type UserMentioned struct {
+	ArticleID uint  `json:"articleId"`
+	CommentID *uint `json:"commentId"`
+	UserID    uint  `json:"userId"`
+	ActorID   uint  `json:"actorId"`
+}
+
+func (UserMentioned) EventName() string { return "user.mentioned" }
+
+// InviterID asked InviteeID to co-author the article, both are users.UserModel ids.
+type CoauthorInvited struct {
+	InvitationID uint `json:"invitationId"`
+	ArticleID    uint `json:"articleId"`
+	InviteeID    uint `json:"inviteeId"`
+	InviterID    uint `json:"inviterId"`
+}
+
+func (CoauthorInvited) EventName() string { return "coauthor.invited" }
+
 func GetArticleUserModel(userModel users.UserModel) ArticleUserModel {
 	var articleUserModel ArticleUserModel
 	if userModel.ID == 0 {
@@ -84,13 +402,21 @@ func (article ArticleModel) isFavoriteBy(user ArticleUserModel) bool {
 }
 
 func (article ArticleModel) favoriteBy(user ArticleUserModel) error {
-	db := common.GetDB()
-	var favorite FavoriteModel
-	err := db.FirstOrCreate(&favorite, &FavoriteModel{
-		FavoriteID:   article.ID,
-		FavoriteByID: user.ID,
-	}).Error
-	return err
+	return common.Transaction(func(tx *gorm.DB) error {
+		var favorite FavoriteModel
+		tx.Where(FavoriteModel{
+			FavoriteID:   article.ID,
+			FavoriteByID: user.ID,
+		}).First(&favorite)
+		if favorite.ID != 0 {
+			return nil
+		}
+		favorite = FavoriteModel{FavoriteID: article.ID, FavoriteByID: user.ID}
+		if err := tx.Create(&favorite).Error; err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, ArticleFavorited{ArticleID: article.ID, UserID: user.UserModelID})
+	})
 }
 
 func (article ArticleModel) unFavoriteBy(user ArticleUserModel) error {
@@ -108,11 +434,37 @@ func SaveOne(data interface{}) error {
 	return err
 }
 
+// Save a new article with its first revision and publish ArticleCreated with it.
+func createArticle(article *ArticleModel) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(article).Error; err != nil {
+			return err
+		}
+		if _, err := article.saveRevision(tx, article.Author); err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, ArticleCreated{ArticleID: article.ID, AuthorID: article.Author.UserModelID})
+	})
+}
+
+// Save a new comment and publish CommentCreated with it.
+func createComment(comment *CommentModel) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(comment).Error; err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, CommentCreated{CommentID: comment.ID, ArticleID: comment.ArticleID, AuthorID: comment.Author.UserModelID})
+	})
+}
+
 func FindOneArticle(condition interface{}) (ArticleModel, error) {
 	db := common.GetDB()
 	var model ArticleModel
 	tx := db.Begin()
-	tx.Where(condition).First(&model)
+	if err := tx.Where(condition).First(&model).Error; err != nil {
+		tx.Rollback()
+		return model, err
+	}
 	tx.Model(&model).Related(&model.Author, "Author")
 	tx.Model(&model.Author).Related(&model.Author.UserModel)
 	tx.Model(&model).Related(&model.Tags, "Tags")
@@ -120,150 +472,2186 @@ func FindOneArticle(condition interface{}) (ArticleModel, error) {
 	return model, err
 }
 
-func (self *ArticleModel) getComments() error {
+// Load an article by id like FindOneArticle does, even when it's been deleted.
+func findArticleByID(id uint) (ArticleModel, error) {
 	db := common.GetDB()
+	var model ArticleModel
 	tx := db.Begin()
-	tx.Model(self).Related(&self.Comments, "Comments")
-	for i, _ := range self.Comments {
-		tx.Model(&self.Comments[i]).Related(&self.Comments[i].Author, "Author")
-		tx.Model(&self.Comments[i].Author).Related(&self.Comments[i].Author.UserModel)
+	if err := tx.Unscoped().First(&model, id).Error; err != nil {
+		tx.Rollback()
+		return model, err
 	}
+	tx.Model(&model).Related(&model.Author, "Author")
+	tx.Model(&model.Author).Related(&model.Author.UserModel)
+	tx.Model(&model).Related(&model.Tags, "Tags")
 	err := tx.Commit().Error
-	return err
+	return model, err
 }
 
-func getAllTags() ([]TagModel, error) {
-	db := common.GetDB()
-	var models []TagModel
-	err := db.Find(&models).Error
-	return models, err
+// Hidden articles are left to their authors and moderators.
+func (article ArticleModel) visibleTo(user users.UserModel) bool {
+	return !article.Hidden || article.hasAuthor(user) || user.HasRole(users.RoleModerator)
 }
 
-func FindManyArticle(tag, author, limit, offset, favorited string) ([]ArticleModel, int, error) {
+// Whether user is the owner or a co-author of article.
+func (article ArticleModel) hasAuthor(user users.UserModel) bool {
+	if user.ID == 0 {
+		return false
+	}
+	if article.Author.UserModelID == user.ID {
+		return true
+	}
 	db := common.GetDB()
-	var models []ArticleModel
 	var count int
+	db.Model(&ArticleAuthorModel{}).
+		Joins("join article_user_models on article_user_models.id = article_author_models.author_id").
+		Where("article_author_models.article_id = ? AND article_user_models.user_model_id = ? AND article_author_models.accepted_at IS NOT NULL", article.ID, user.ID).
+		Count(&count)
+	return count > 0
+}
 
-	offset_int, err := strconv.Atoi(offset)
-	if err != nil {
-		offset_int = 0
-	}
+// Limit an article query to what readers get to see.
+func visibleArticles(db *gorm.DB) *gorm.DB {
+	return db.Where("article_models.hidden = ?", false)
+}
 
-	limit_int, err := strconv.Atoi(limit)
-	if err != nil {
-		limit_int = 20
-	}
+// Paging and order of a comment listing. Sort is "oldest" (default), "newest" or "top" for the most replied,
+// a Limit of 0 means every comment. In Tree mode the page is made of top level comments with all their replies,
+// and the total counts threads rather than comments.
+type CommentQuery struct {
+	Limit  int
+	Offset int
+	Sort   string
+	Tree   bool
+}
 
-	tx := db.Begin()
-	if tag != "" {
-		var tagModel TagModel
-		tx.Where(TagModel{Tag: tag}).First(&tagModel)
-		if tagModel.ID != 0 {
-			tx.Model(&tagModel).Offset(offset_int).Limit(limit_int).Related(&models, "ArticleModels")
-			count = tx.Model(&tagModel).Association("ArticleModels").Count()
-		}
-	} else if author != "" {
-		var userModel users.UserModel
-		tx.Where(users.UserModel{Username: author}).First(&userModel)
-		articleUserModel := GetArticleUserModel(userModel)
+// Load every comment in the order they were written.
+func (self *ArticleModel) getComments() error {
+	_, err := self.findComments(CommentQuery{})
+	return err
+}
 
-		if articleUserModel.ID != 0 {
-			count = tx.Model(&articleUserModel).Association("ArticleModels").Count()
-			tx.Model(&articleUserModel).Offset(offset_int).Limit(limit_int).Related(&models, "ArticleModels")
-		}
-	} else if favorited != "" {
-		var userModel users.UserModel
-		tx.Where(users.UserModel{Username: favorited}).First(&userModel)
-		articleUserModel := GetArticleUserModel(userModel)
-		if articleUserModel.ID != 0 {
-			var favoriteModels []FavoriteModel
-			tx.Where(FavoriteModel{
-				FavoriteByID: articleUserModel.ID,
-			}).Offset(offset_int).Limit(limit_int).Find(&favoriteModels)
+// Load one page of comments into self.Comments and return how many there are in total.
+// Deleted comments which still have replies are kept as tombstones, so a thread never loses its parent.
+//
+// However many comments the article has, this takes five queries: the thread structure, the page,
+// its authors, their users and the mentions.
+func (self *ArticleModel) findComments(query CommentQuery) (int, error) {
+	db := common.GetDB()
+	tx := db.Begin()
+	var nodes []CommentModel
+	tx.Unscoped().Select("id, parent_id, deleted_at, hidden").Where(CommentModel{ArticleID: self.ID}).Order("id asc").Find(&nodes)
+	nodes = threadComments(nodes)
 
-			count = tx.Model(&articleUserModel).Association("FavoriteModels").Count()
-			for _, favorite := range favoriteModels {
-				var model ArticleModel
-				tx.Model(&favorite).Related(&model, "Favorite")
-				models = append(models, model)
+	ordered := sortComments(nodes, query.Sort)
+	var page []CommentModel
+	var count int
+	if query.Tree {
+		var roots []CommentModel
+		for _, node := range ordered {
+			if node.ParentID == nil {
+				roots = append(roots, node)
 			}
 		}
+		count = len(roots)
+		page = withReplies(paginate(roots, query.Limit, query.Offset), nodes)
 	} else {
-		db.Model(&models).Count(&count)
-		db.Offset(offset_int).Limit(limit_int).Find(&models)
+		count = len(ordered)
+		page = paginate(ordered, query.Limit, query.Offset)
 	}
 
-	for i, _ := range models {
-		tx.Model(&models[i]).Related(&models[i].Author, "Author")
-		tx.Model(&models[i].Author).Related(&models[i].Author.UserModel)
-		tx.Model(&models[i]).Related(&models[i].Tags, "Tags")
+	var ids []uint
+	for _, node := range page {
+		ids = append(ids, node.ID)
 	}
-	err = tx.Commit().Error
-	return models, count, err
+	var models []CommentModel
+	if len(ids) > 0 {
+		tx.Unscoped().Where("id in (?)", ids).Find(&models)
+	}
+	byID := map[uint]CommentModel{}
+	for _, model := range models {
+		byID[model.ID] = model
+	}
+	self.Comments = []CommentModel{}
+	for _, node := range page {
+		model := byID[node.ID]
+		model.RepliesCount = node.RepliesCount
+		self.Comments = append(self.Comments, model)
+	}
+	loadCommentAuthors(tx, self.Comments)
+	loadCommentMentions(tx, self.Comments)
+	err := tx.Commit().Error
+	return count, err
 }
 
-func (self *ArticleUserModel) GetArticleFeed(limit, offset string) ([]ArticleModel, int, error) {
-	db := common.GetDB()
-	var models []ArticleModel
-	var count int
+func sortComments(comments []CommentModel, order string) []CommentModel {
+	sorted := append([]CommentModel{}, comments...)
+	switch order {
+	case "newest":
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	case "top":
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].RepliesCount > sorted[j].RepliesCount
+		})
+	}
+	return sorted
+}
 
-	offset_int, err := strconv.Atoi(offset)
-	if err != nil {
-		offset_int = 0
+func paginate(comments []CommentModel, limit, offset int) []CommentModel {
+	if offset < 0 {
+		offset = 0
 	}
-	limit_int, err := strconv.Atoi(limit)
-	if err != nil {
-		limit_int = 20
+	if offset >= len(comments) {
+		return []CommentModel{}
 	}
+	comments = comments[offset:]
+	if limit > 0 && limit < len(comments) {
+		comments = comments[:limit]
+	}
+	return comments
+}
 
-	tx := db.Begin()
-	followings := self.UserModel.GetFollowings()
-	var articleUserModels []uint
-	for _, following := range followings {
-		articleUserModel := GetArticleUserModel(following)
-		articleUserModels = append(articleUserModels, articleUserModel.ID)
+// The roots followed by all their replies in the order they were written.
+func withReplies(roots []CommentModel, all []CommentModel) []CommentModel {
+	included := map[uint]bool{}
+	for _, root := range roots {
+		included[root.ID] = true
+	}
+	result := append([]CommentModel{}, roots...)
+	// all is sorted by id, so parents are seen before their replies
+	for _, comment := range all {
+		if comment.ParentID != nil && included[*comment.ParentID] && !included[comment.ID] {
+			included[comment.ID] = true
+			result = append(result, comment)
+		}
 	}
+	return result
+}
 
-	tx.Where("author_id in (?)", articleUserModels).Order("updated_at desc").Offset(offset_int).Limit(limit_int).Find(&models)
+// Fill in the authors of comments with two queries, tombstones stay without one.
+func loadCommentAuthors(tx *gorm.DB, comments []CommentModel) {
+	var authorIDs []uint
+	for _, comment := range comments {
+		if comment.visible() {
+			authorIDs = append(authorIDs, comment.AuthorID)
+		}
+	}
+	if len(authorIDs) == 0 {
+		return
+	}
+	var authors []ArticleUserModel
+	tx.Where("id in (?)", authorIDs).Find(&authors)
+	var userIDs []uint
+	for _, author := range authors {
+		userIDs = append(userIDs, author.UserModelID)
+	}
+	var userModels []users.UserModel
+	tx.Where("id in (?)", userIDs).Find(&userModels)
 
-	for i, _ := range models {
-		tx.Model(&models[i]).Related(&models[i].Author, "Author")
-		tx.Model(&models[i].Author).Related(&models[i].Author.UserModel)
-		tx.Model(&models[i]).Related(&models[i].Tags, "Tags")
+	usersByID := map[uint]users.UserModel{}
+	for _, userModel := range userModels {
+		usersByID[userModel.ID] = userModel
+	}
+	authorsByID := map[uint]ArticleUserModel{}
+	for _, author := range authors {
+		author.UserModel = usersByID[author.UserModelID]
+		authorsByID[author.ID] = author
+	}
+	for i, _ := range comments {
+		if comments[i].visible() {
+			comments[i].Author = authorsByID[comments[i].AuthorID]
+		}
 	}
-	err = tx.Commit().Error
-	return models, count, err
 }
 
-func (model *ArticleModel) setTags(tags []string) error {
-	db := common.GetDB()
-	var tagList []TagModel
-	for _, tag := range tags {
-		var tagModel TagModel
-		err := db.FirstOrCreate(&tagModel, TagModel{Tag: tag}).Error
-		if err != nil {
-			return err
+// Drop deleted or hidden comments without live replies and count the replies of the rest.
+// comments must be sorted by id, so replies come after their parents.
+func threadComments(comments []CommentModel) []CommentModel {
+	index := map[uint]int{}
+	for i, comment := range comments {
+		index[comment.ID] = i
+	}
+	keep := make([]bool, len(comments))
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := &comments[i]
+		keep[i] = keep[i] || comment.visible()
+		if !keep[i] || comment.ParentID == nil {
+			continue
+		}
+		if parent, ok := index[*comment.ParentID]; ok {
+			keep[parent] = true
+			comments[parent].RepliesCount++
 		}
-		tagList = append(tagList, tagModel)
 	}
-	model.Tags = tagList
-	return nil
+	threaded := []CommentModel{}
+	for i, comment := range comments {
+		if keep[i] {
+			threaded = append(threaded, comment)
+		}
+	}
+	return threaded
 }
 
-func (model *ArticleModel) Update(data interface{}) error {
+func (article ArticleModel) commentsCount() uint {
+	return articleCommentsCounts([]uint{article.ID})[article.ID]
+}
+
+type articleCount struct {
+	ArticleID uint
+	Count     uint
+}
+
+// The number of visible comments on each of the articles with the given ids, in one query.
+func articleCommentsCounts(ids []uint) map[uint]uint {
+	counts := map[uint]uint{}
+	if len(ids) == 0 {
+		return counts
+	}
 	db := common.GetDB()
-	err := db.Model(model).Update(data).Error
-	return err
+	var rows []articleCount
+	db.Model(&CommentModel{}).Select("article_id, count(*) as count").
+		Where("article_id in (?) AND hidden = ?", ids, false).Group("article_id").Scan(&rows)
+	for _, row := range rows {
+		counts[row.ArticleID] = row.Count
+	}
+	return counts
 }
 
-func DeleteArticleModel(condition interface{}) error {
+// Find a comment of this article by its id.
+func (self *ArticleModel) findComment(id uint) (CommentModel, error) {
 	db := common.GetDB()
-	err := db.Where(condition).Delete(ArticleModel{}).Error
-	return err
+	var model CommentModel
+	err := db.Where("id = ? AND article_id = ?", id, self.ID).First(&model).Error
+	return model, err
 }
 
-func DeleteCommentModel(condition interface{}) error {
+// Load a single comment with its author, mentions and article, the way a listing would have it.
+func findCommentByID(id uint) (CommentModel, error) {
 	db := common.GetDB()
-	err := db.Where(condition).Delete(CommentModel{}).Error
-	return err
+	var model CommentModel
+	tx := db.Begin()
+	if err := tx.First(&model, id).Error; err != nil {
+		tx.Rollback()
+		return model, err
+	}
+	tx.First(&model.Article, model.ArticleID)
+	tx.Model(&model.Article).Related(&model.Article.Author, "Author")
+	comments := []CommentModel{model}
+	loadCommentAuthors(tx, comments)
+	loadCommentMentions(tx, comments)
+	err := tx.Commit().Error
+	return comments[0], err
+}
+
+// The id of the users.UserModel who wrote the comment.
+func (comment CommentModel) authorUserID() uint {
+	db := common.GetDB()
+	var author ArticleUserModel
+	db.First(&author, comment.AuthorID)
+	return author.UserModelID
+}
+
+// Change the body, keeping the current one in the edit history.
+func (comment *CommentModel) edit(body string) error {
+	if body == comment.Body {
+		return nil
+	}
+	now := time.Now()
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&CommentEditModel{CommentID: comment.ID, Body: comment.Body}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(comment).Updates(map[string]interface{}{"body": body, "edited_at": &now}).Error; err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, CommentUpdated{CommentID: comment.ID, ArticleID: comment.ArticleID})
+	})
+}
+
+// Earlier bodies of the comment, oldest first.
+func (comment *CommentModel) getEdits() ([]CommentEditModel, error) {
+	db := common.GetDB()
+	var edits []CommentEditModel
+	err := db.Where(CommentEditModel{CommentID: comment.ID}).Order("id asc").Find(&edits).Error
+	return edits, err
+}
+
+// Make comment a reply to parent, as long as that doesn't nest deeper than MaxCommentDepth.
+func (comment *CommentModel) setParent(parent CommentModel) error {
+	if parent.Depth+1 >= MaxCommentDepth {
+		return errors.New("Replies are nested too deep")
+	}
+	comment.ParentID = &parent.ID
+	comment.Depth = parent.Depth + 1
+	return nil
+}
+
+func getAllTags() ([]TagModel, error) {
+	db := common.GetDB()
+	var models []TagModel
+	err := db.Find(&models).Error
+	return models, err
+}
+
+// Tags used by at least one article with their counts, sorted by name or by count when sort is "popular".
+// A limit of 0 means no limit.
+func FindTagCounts(sort string, limit int) ([]TagCount, error) {
+	db := common.GetDB()
+	var counts []TagCount
+	order := "tag_models.tag asc"
+	if sort == "popular" {
+		order = "articles_count desc, tag_models.tag asc"
+	}
+	query := db.Table("tag_models").
+		Select("tag_models.*, count(article_models.id) as articles_count").
+		Joins("join article_tags on article_tags.tag_model_id = tag_models.id").
+		Joins("join article_models on article_models.id = article_tags.article_model_id and article_models.deleted_at is null").
+		Where("tag_models.deleted_at is null").
+		Group("tag_models.id").
+		Order(order)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Scan(&counts).Error
+	return counts, err
+}
+
+func (tag TagModel) isFollowedBy(user ArticleUserModel) bool {
+	db := common.GetDB()
+	var follow TagFollowModel
+	db.Where(TagFollowModel{
+		TagID:        tag.ID,
+		FollowedByID: user.ID,
+	}).First(&follow)
+	return follow.ID != 0
+}
+
+func (tag TagModel) followedBy(user ArticleUserModel) error {
+	db := common.GetDB()
+	var follow TagFollowModel
+	err := db.FirstOrCreate(&follow, &TagFollowModel{
+		TagID:        tag.ID,
+		FollowedByID: user.ID,
+	}).Error
+	return err
+}
+
+func (tag TagModel) unFollowedBy(user ArticleUserModel) error {
+	db := common.GetDB()
+	err := db.Where(TagFollowModel{
+		TagID:        tag.ID,
+		FollowedByID: user.ID,
+	}).Delete(TagFollowModel{}).Error
+	return err
+}
+
+// The tags user follows, by name.
+func (user ArticleUserModel) GetFollowedTags() ([]TagModel, error) {
+	db := common.GetDB()
+	var tags []TagModel
+	err := db.Joins("join tag_follow_models on tag_follow_models.tag_id = tag_models.id and tag_follow_models.deleted_at is null").
+		Where("tag_follow_models.followed_by_id = ?", user.ID).
+		Order("tag_models.tag asc").
+		Find(&tags).Error
+	return tags, err
+}
+
+// Tags are stored lower case with single dashes between words, so "Go ", "go" and "GO" are one tag.
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// Find the tag named tag, following aliases of renamed and merged tags.
+func FindOneTag(tag string) (TagModel, error) {
+	db := common.GetDB()
+	var tagModel TagModel
+	name := normalizeTag(tag)
+	err := db.Where(TagModel{Tag: name}).First(&tagModel).Error
+	if err == nil {
+		return tagModel, nil
+	}
+	var aliasModel TagAliasModel
+	if db.Where(TagAliasModel{Alias: name}).First(&aliasModel).Error != nil {
+		return tagModel, err
+	}
+	err = db.Model(&aliasModel).Related(&tagModel, "Tag").Error
+	return tagModel, err
+}
+
+// Give tag a new name, the old one stays as an alias. Renaming onto an existing tag is an error, merge them instead.
+func RenameTag(tagModel TagModel, name string) (TagModel, error) {
+	name = normalizeTag(name)
+	if name == "" {
+		return tagModel, errors.New("Tag name should not be empty")
+	}
+	if name == tagModel.Tag {
+		return tagModel, nil
+	}
+	oldName := tagModel.Tag
+	err := common.Transaction(func(tx *gorm.DB) error {
+		var count int
+		if err := tx.Unscoped().Model(&TagModel{}).Where(TagModel{Tag: name}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("Tag already exists, merge it instead")
+		}
+		if err := tx.Unscoped().Where(TagAliasModel{Alias: name}).Delete(TagAliasModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&tagModel).Update("tag", name).Error; err != nil {
+			return err
+		}
+		return tx.Create(&TagAliasModel{Alias: oldName, TagID: tagModel.ID}).Error
+	})
+	return tagModel, err
+}
+
+// Move every article of from over to into and drop from, its name and aliases then point at into.
+func MergeTags(from, into TagModel) error {
+	if from.ID == into.ID {
+		return errors.New("Can not merge a tag into itself")
+	}
+	return common.Transaction(func(tx *gorm.DB) error {
+		// Articles which already have both tags only lose the link to from
+		err := tx.Exec("DELETE FROM article_tags WHERE tag_model_id = ? AND article_model_id IN (SELECT article_model_id FROM article_tags WHERE tag_model_id = ?)", from.ID, into.ID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE article_tags SET tag_model_id = ? WHERE tag_model_id = ?", into.ID, from.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&TagAliasModel{}).Where(TagAliasModel{TagID: from.ID}).Update("tag_id", into.ID).Error; err != nil {
+			return err
+		}
+		// Followers of both keep following into only
+		err = tx.Unscoped().Where("tag_id = ? AND followed_by_id IN (?)", from.ID,
+			tx.Model(&TagFollowModel{}).Select("followed_by_id").Where("tag_id = ?", into.ID).QueryExpr()).Delete(TagFollowModel{}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&TagFollowModel{}).Where(TagFollowModel{TagID: from.ID}).Update("tag_id", into.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&from).Error; err != nil {
+			return err
+		}
+		return tx.Create(&TagAliasModel{Alias: from.Tag, TagID: into.ID}).Error
+	})
+}
+
+// Hard delete the tags no article links to, together with their aliases.
+// Tags of articles in the trash are kept until the articles get purged.
+func DeleteUnusedTags() (int64, error) {
+	var ids []uint
+	err := common.Transaction(func(tx *gorm.DB) error {
+		used := tx.Table("article_tags").Select("tag_model_id").QueryExpr()
+		if err := tx.Unscoped().Model(&TagModel{}).Where("id NOT IN (?)", used).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Unscoped().Where("tag_id in (?)", ids).Delete(TagAliasModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("tag_id in (?)", ids).Delete(TagFollowModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id in (?)", ids).Delete(TagModel{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+// Articles by tag, author or co-author, favorited by a user or in the reading list with the id list, newest first.
+// Favorites keep the order they were made in, reading lists their own. Callers check who owns list.
+func FindManyArticle(tag, author, limit, offset, favorited, list string) ([]ArticleModel, int, error) {
+	db := common.GetDB()
+	var models []ArticleModel
+	var count int
+
+	offset_int, err := strconv.Atoi(offset)
+	if err != nil {
+		offset_int = 0
+	}
+
+	limit_int, err := strconv.Atoi(limit)
+	if err != nil {
+		limit_int = 20
+	}
+
+	tx := db.Begin()
+	if tag != "" {
+		tagModel, _ := FindOneTag(tag)
+		if tagModel.ID != 0 {
+			tx.Model(&tagModel).Scopes(visibleArticles).Order("article_models.created_at desc").Offset(offset_int).Limit(limit_int).Related(&models, "ArticleModels")
+			count = tx.Model(&tagModel).Scopes(visibleArticles).Association("ArticleModels").Count()
+		}
+	} else if author != "" {
+		var userModel users.UserModel
+		tx.Where(users.UserModel{Username: author}).First(&userModel)
+		articleUserModel := GetArticleUserModel(userModel)
+
+		if articleUserModel.ID != 0 {
+			coauthored := tx.Model(&ArticleAuthorModel{}).Select("article_id").
+				Where("author_id = ? AND accepted_at IS NOT NULL", articleUserModel.ID).QueryExpr()
+			authored := tx.Model(&ArticleModel{}).Scopes(visibleArticles).
+				Where("article_models.author_id = ? OR article_models.id in (?)", articleUserModel.ID, coauthored)
+			authored.Count(&count)
+			authored.Order("article_models.created_at desc").Offset(offset_int).Limit(limit_int).Find(&models)
+		}
+	} else if favorited != "" {
+		var userModel users.UserModel
+		tx.Where(users.UserModel{Username: favorited}).First(&userModel)
+		articleUserModel := GetArticleUserModel(userModel)
+		if articleUserModel.ID != 0 {
+			var favoriteModels []FavoriteModel
+			favorites := tx.Model(&FavoriteModel{}).Where(FavoriteModel{
+				FavoriteByID: articleUserModel.ID,
+			}).Joins("join article_models on article_models.id = favorite_models.favorite_id").Scopes(visibleArticles)
+			favorites.Count(&count)
+			favorites.Select("favorite_models.*").Offset(offset_int).Limit(limit_int).Find(&favoriteModels)
+			for _, favorite := range favoriteModels {
+				var model ArticleModel
+				tx.Model(&favorite).Related(&model, "Favorite")
+				models = append(models, model)
+			}
+		}
+	} else if list != "" {
+		items := tx.Model(&ArticleModel{}).Scopes(visibleArticles).
+			Joins("join reading_list_item_models on reading_list_item_models.article_id = article_models.id").
+			Where("reading_list_item_models.list_id = ?", list)
+		items.Count(&count)
+		items.Select("article_models.*").Order("reading_list_item_models.position").Offset(offset_int).Limit(limit_int).Find(&models)
+	} else {
+		db.Model(&models).Scopes(visibleArticles).Count(&count)
+		db.Scopes(visibleArticles).Order("created_at desc").Offset(offset_int).Limit(limit_int).Find(&models)
+	}
+
+	for i, _ := range models {
+		tx.Model(&models[i]).Related(&models[i].Author, "Author")
+		tx.Model(&models[i].Author).Related(&models[i].Author.UserModel)
+		tx.Model(&models[i]).Related(&models[i].Tags, "Tags")
+	}
+	err = tx.Commit().Error
+	return models, count, err
+}
+
+// Articles by the authors self follows, newest first. With includeTags the articles tagged
+// with a tag self follows are mixed in, each article still showing up once.
+func (self *ArticleUserModel) GetArticleFeed(limit, offset string, includeTags bool) ([]ArticleModel, int, error) {
+	db := common.GetDB()
+	var models []ArticleModel
+	var count int
+
+	offset_int, err := strconv.Atoi(offset)
+	if err != nil {
+		offset_int = 0
+	}
+	limit_int, err := strconv.Atoi(limit)
+	if err != nil {
+		limit_int = 20
+	}
+
+	tx := db.Begin()
+	query := self.feedQuery(tx, includeTags)
+	query.Count(&count)
+	query.Order("updated_at desc").Offset(offset_int).Limit(limit_int).Find(&models)
+
+	for i, _ := range models {
+		tx.Model(&models[i]).Related(&models[i].Author, "Author")
+		tx.Model(&models[i].Author).Related(&models[i].Author.UserModel)
+		tx.Model(&models[i]).Related(&models[i].Tags, "Tags")
+	}
+	err = tx.Commit().Error
+	return models, count, err
+}
+
+// The visible articles of the feed of self, see GetArticleFeed.
+func (self *ArticleUserModel) feedQuery(tx *gorm.DB, includeTags bool) *gorm.DB {
+	followedAuthors := tx.Table("article_user_models").
+		Select("article_user_models.id").
+		Joins("join follow_models on follow_models.following_id = article_user_models.user_model_id and follow_models.deleted_at is null").
+		Where("follow_models.followed_by_id = ?", self.UserModelID).
+		QueryExpr()
+	query := tx.Model(&ArticleModel{}).Scopes(visibleArticles)
+	if includeTags {
+		followedTagArticles := tx.Table("article_tags").
+			Select("article_tags.article_model_id").
+			Joins("join tag_follow_models on tag_follow_models.tag_id = article_tags.tag_model_id and tag_follow_models.deleted_at is null").
+			Where("tag_follow_models.followed_by_id = ?", self.ID).
+			QueryExpr()
+		return query.Where("author_id in (?) or id in (?)", followedAuthors, followedTagArticles)
+	}
+	return query.Where("author_id in (?)", followedAuthors)
+}
+
+func (model *ArticleModel) setTags(tags []string) error {
+	db := common.GetDB()
+	var tagList []TagModel
+	seen := map[uint]bool{}
+	for _, tag := range tags {
+		name := normalizeTag(tag)
+		if name == "" {
+			continue
+		}
+		tagModel, err := FindOneTag(name)
+		if err != nil {
+			err = db.FirstOrCreate(&tagModel, TagModel{Tag: name}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if seen[tagModel.ID] {
+			continue
+		}
+		seen[tagModel.ID] = true
+		tagList = append(tagList, tagModel)
+	}
+	model.Tags = tagList
+	return nil
+}
+
+func (model *ArticleModel) Update(data interface{}) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Update(data).Error; err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, ArticleUpdated{ArticleID: model.ID})
+	})
+}
+
+// Update the article the way editor asked, record the result as a new revision and publish ArticleUpdated.
+func (model *ArticleModel) edit(data interface{}, editor ArticleUserModel) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Update(data).Error; err != nil {
+			return err
+		}
+		if _, err := model.saveRevision(tx, editor); err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, ArticleUpdated{ArticleID: model.ID})
+	})
+}
+
+// Make a slug from title which no other article uses or used to use, by suffixing -2, -3, ...
+// articleID is the article the slug is made for, 0 for a new one.
+func uniqueSlug(title string, articleID uint) string {
+	base := slug.Make(title)
+	if base == "" {
+		base = "article"
+	}
+	candidate := base
+	for i := 2; slugTaken(candidate, articleID); i++ {
+		candidate = fmt.Sprintf("%v-%v", base, i)
+	}
+	return candidate
+}
+
+func slugTaken(candidate string, articleID uint) bool {
+	db := common.GetDB()
+	var count int
+	// Soft deleted articles still hold their unique index
+	db.Unscoped().Model(&ArticleModel{}).Where("slug = ? AND id <> ?", candidate, articleID).Count(&count)
+	if count > 0 {
+		return true
+	}
+	db.Unscoped().Model(&ArticleSlugModel{}).Where("slug = ? AND article_id <> ?", candidate, articleID).Count(&count)
+	return count > 0
+}
+
+// Remember oldSlug so it keeps resolving after the article got a new one.
+func (model *ArticleModel) keepSlugHistory(oldSlug string) error {
+	db := common.GetDB()
+	// Renaming back to a former slug takes it out of the history
+	err := db.Unscoped().Where(ArticleSlugModel{Slug: model.Slug, ArticleID: model.ID}).Delete(ArticleSlugModel{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Create(&ArticleSlugModel{Slug: oldSlug, ArticleID: model.ID}).Error
+}
+
+// Find the current slug of the article which used to be reachable by oldSlug.
+func FindCurrentSlug(oldSlug string) (string, error) {
+	db := common.GetDB()
+	var slugModel ArticleSlugModel
+	err := db.Where(ArticleSlugModel{Slug: oldSlug}).First(&slugModel).Error
+	if err != nil {
+		return "", err
+	}
+	var model ArticleModel
+	err = db.Where("id = ?", slugModel.ArticleID).First(&model).Error
+	return model.Slug, err
+}
+
+// Record the current content of the article as its next revision, tx is the transaction which changed it.
+func (model *ArticleModel) saveRevision(tx *gorm.DB, author ArticleUserModel) (ArticleRevisionModel, error) {
+	var last struct{ Number uint }
+	err := tx.Model(&ArticleRevisionModel{}).Select("COALESCE(MAX(number), 0) AS number").Where("article_id = ?", model.ID).Scan(&last).Error
+	if err != nil {
+		return ArticleRevisionModel{}, err
+	}
+	revision := ArticleRevisionModel{
+		ArticleID:   model.ID,
+		Number:      last.Number + 1,
+		Author:      author,
+		AuthorID:    author.ID,
+		Title:       model.Title,
+		Description: model.Description,
+		Body:        model.Body,
+	}
+	err = tx.Create(&revision).Error
+	return revision, err
+}
+
+func (model *ArticleModel) getRevisions() ([]ArticleRevisionModel, error) {
+	db := common.GetDB()
+	var revisions []ArticleRevisionModel
+	tx := db.Begin()
+	tx.Where(ArticleRevisionModel{ArticleID: model.ID}).Order("number asc").Find(&revisions)
+	for i, _ := range revisions {
+		tx.Model(&revisions[i]).Related(&revisions[i].Author, "Author")
+		tx.Model(&revisions[i].Author).Related(&revisions[i].Author.UserModel)
+	}
+	err := tx.Commit().Error
+	return revisions, err
+}
+
+func (model *ArticleModel) getRevision(number uint) (ArticleRevisionModel, error) {
+	db := common.GetDB()
+	var revision ArticleRevisionModel
+	err := db.Where(ArticleRevisionModel{ArticleID: model.ID, Number: number}).First(&revision).Error
+	if err != nil {
+		return revision, err
+	}
+	db.Model(&revision).Related(&revision.Author, "Author")
+	db.Model(&revision.Author).Related(&revision.Author.UserModel)
+	return revision, nil
+}
+
+// Copy the content of an old revision back onto the article and record it as a new revision,
+// the history itself is never rewritten. With hide the article is hidden along, for quarantine.
+func (model *ArticleModel) restoreRevision(revision ArticleRevisionModel, author ArticleUserModel, hide bool) (ArticleRevisionModel, error) {
+	var restored ArticleRevisionModel
+	err := common.Transaction(func(tx *gorm.DB) error {
+		changes := map[string]interface{}{
+			"title":       revision.Title,
+			"description": revision.Description,
+			"body":        revision.Body,
+		}
+		if hide {
+			changes["hidden"] = true
+		}
+		err := tx.Model(model).Updates(changes).Error
+		if err != nil {
+			return err
+		}
+		if restored, err = model.saveRevision(tx, author); err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, ArticleUpdated{ArticleID: model.ID})
+	})
+	return restored, err
+}
+
+// Soft delete the matching articles together with their comments and favorites.
+// Everything deleted in one go shares the same deleted_at, which is how RestoreArticleModel finds it again.
+func DeleteArticleModel(condition interface{}) error {
+	db := common.GetDB()
+	var ids []uint
+	if err := db.Model(&ArticleModel{}).Where(condition).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return common.Transaction(func(tx *gorm.DB) error {
+		tx.Model(&CommentModel{}).Where("article_id in (?)", ids).UpdateColumn("deleted_at", now)
+		tx.Model(&FavoriteModel{}).Where("favorite_id in (?)", ids).UpdateColumn("deleted_at", now)
+		if err := tx.Model(&ArticleModel{}).Where("id in (?)", ids).UpdateColumn("deleted_at", now).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := common.PublishEvent(tx, ArticleDeleted{ArticleID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func DeleteCommentModel(condition interface{}) error {
+	db := common.GetDB()
+	err := db.Where(condition).Delete(CommentModel{}).Error
+	return err
+}
+
+// The deleted articles of author, most recently deleted first.
+func FindDeletedArticles(author ArticleUserModel) ([]ArticleModel, error) {
+	db := common.GetDB()
+	var models []ArticleModel
+	err := db.Unscoped().Where("author_id = ? AND deleted_at IS NOT NULL", author.ID).Order("deleted_at desc").Find(&models).Error
+	return models, err
+}
+
+// The comments author deleted one by one, the ones gone with their article come back with it instead.
+func FindDeletedComments(author ArticleUserModel) ([]CommentModel, error) {
+	db := common.GetDB()
+	var models []CommentModel
+	err := db.Unscoped().
+		Where("author_id = ? AND deleted_at IS NOT NULL", author.ID).
+		Where("article_id in (?)", db.Model(&ArticleModel{}).Select("id").QueryExpr()).
+		Order("deleted_at desc").Find(&models).Error
+	if err != nil {
+		return models, err
+	}
+	for i, _ := range models {
+		db.Model(&models[i]).Related(&models[i].Article, "Article")
+	}
+	return models, nil
+}
+
+func FindDeletedArticle(author ArticleUserModel, slug string) (ArticleModel, error) {
+	db := common.GetDB()
+	var model ArticleModel
+	err := db.Unscoped().Where("author_id = ? AND slug = ? AND deleted_at IS NOT NULL", author.ID, slug).First(&model).Error
+	return model, err
+}
+
+func FindDeletedComment(author ArticleUserModel, id uint) (CommentModel, error) {
+	db := common.GetDB()
+	var model CommentModel
+	err := db.Unscoped().Where("author_id = ? AND id = ? AND deleted_at IS NOT NULL", author.ID, id).First(&model).Error
+	if err != nil {
+		return model, err
+	}
+	// A comment can only come back onto an article which is still there
+	err = db.Model(&model).Related(&model.Article, "Article").Error
+	return model, err
+}
+
+// Bring back a deleted article with the comments and favorites deleted along with it.
+func RestoreArticleModel(model ArticleModel) error {
+	db := common.GetDB()
+	if model.DeletedAt == nil {
+		return nil
+	}
+	tx := db.Begin()
+	tx.Unscoped().Model(&CommentModel{}).Where("article_id = ? AND deleted_at = ?", model.ID, model.DeletedAt).UpdateColumn("deleted_at", nil)
+	tx.Unscoped().Model(&FavoriteModel{}).Where("favorite_id = ? AND deleted_at = ?", model.ID, model.DeletedAt).UpdateColumn("deleted_at", nil)
+	tx.Unscoped().Model(&ArticleModel{}).Where("id = ?", model.ID).UpdateColumn("deleted_at", nil)
+	err := tx.Commit().Error
+	return err
+}
+
+func RestoreCommentModel(model CommentModel) error {
+	db := common.GetDB()
+	err := db.Unscoped().Model(&CommentModel{}).Where("id = ?", model.ID).UpdateColumn("deleted_at", nil).Error
+	return err
+}
+
+// How long deleted content stays in the trash, TRASH_RETENTION overrides the 30 days default.
+var TrashRetention = common.GetEnvDuration("TRASH_RETENTION", 30*24*time.Hour)
+
+// Hard delete whatever was soft deleted before the given time, along with everything
+// that only existed for the purged articles.
+func PurgeTrash(before time.Time) error {
+	db := common.GetDB()
+	var ids []uint
+	var images []ArticleImageModel
+	db.Unscoped().Model(&ArticleModel{}).Where("deleted_at < ?", before).Pluck("id", &ids)
+
+	tx := db.Begin()
+	if len(ids) > 0 {
+		tx.Unscoped().Where("comment_id in (?)", tx.Unscoped().Model(&CommentModel{}).Select("id").Where("article_id in (?)", ids).QueryExpr()).Delete(CommentEditModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(CommentModel{})
+		tx.Unscoped().Where("favorite_id in (?)", ids).Delete(FavoriteModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ArticleRevisionModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ArticleSlugModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ReportModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(MentionModel{})
+		tx.Where("article_id in (?)", ids).Find(&images)
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ArticleImageModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ReadingListItemModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(SeriesPartModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ArticleAuthorModel{})
+		tx.Unscoped().Where("article_id in (?)", ids).Delete(ReactionModel{})
+		tx.Exec("DELETE FROM article_tags WHERE article_model_id in (?)", ids)
+		tx.Unscoped().Where("id in (?)", ids).Delete(ArticleModel{})
+	}
+	if commentIDs := purgeableComments(tx, before); len(commentIDs) > 0 {
+		tx.Unscoped().Where("comment_id in (?)", commentIDs).Delete(CommentEditModel{})
+		tx.Unscoped().Where("comment_id in (?)", commentIDs).Delete(ReportModel{})
+		tx.Unscoped().Where("comment_id in (?)", commentIDs).Delete(MentionModel{})
+		tx.Unscoped().Where("comment_id in (?)", commentIDs).Delete(ReactionModel{})
+		tx.Unscoped().Where("id in (?)", commentIDs).Delete(CommentModel{})
+	}
+	tx.Unscoped().Where("deleted_at < ?", before).Delete(FavoriteModel{})
+	err := tx.Commit().Error
+	if err == nil {
+		for _, model := range images {
+			deleteMedia(model.Key, model.ThumbnailKey)
+		}
+	}
+	return err
+}
+
+// Comments deleted before the given time, except the ones with replies which stay, deleted or not.
+// Those are kept as tombstones so the thread still hangs together.
+func purgeableComments(tx *gorm.DB, before time.Time) []uint {
+	var comments, replies []CommentModel
+	tx.Unscoped().Select("id, parent_id").Where("deleted_at < ?", before).Find(&comments)
+	if len(comments) == 0 {
+		return nil
+	}
+	purge := map[uint]bool{}
+	var ids []uint
+	for _, comment := range comments {
+		purge[comment.ID] = true
+		ids = append(ids, comment.ID)
+	}
+	tx.Unscoped().Select("id, parent_id").Where("parent_id in (?)", ids).Find(&replies)
+	for changed := true; changed; {
+		changed = false
+		for _, reply := range replies {
+			if purge[*reply.ParentID] && !purge[reply.ID] {
+				delete(purge, *reply.ParentID)
+				changed = true
+			}
+		}
+	}
+	ids = ids[:0]
+	for _, comment := range comments {
+		if purge[comment.ID] {
+			ids = append(ids, comment.ID)
+		}
+	}
+	return ids
+}
+
+// Purge what has been in the trash longer than retention, now and then every interval until stop is closed.
+//
+//	go RunTrashPurge(30*24*time.Hour, time.Hour, nil)
+func RunTrashPurge(retention, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := PurgeTrash(time.Now().Add(-retention)); err != nil {
+			fmt.Println("purge err: (RunTrashPurge) ", err)
+		}
+		if _, err := DeleteUnusedTags(); err != nil {
+			fmt.Println("purge err: (RunTrashPurge) ", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+var errAlreadyReported = errors.New("Already reported")
+
+// Narrow a report query down to the reports about the same article or comment as report.
+func (report ReportModel) sameTarget(db *gorm.DB) *gorm.DB {
+	if report.CommentID != nil {
+		return db.Where("comment_id = ?", *report.CommentID)
+	}
+	return db.Where("article_id = ? AND comment_id IS NULL", report.ArticleID)
+}
+
+func (report ReportModel) hideTarget(db *gorm.DB, hidden bool) error {
+	if report.CommentID != nil {
+		return db.Model(&CommentModel{}).Where("id = ?", *report.CommentID).UpdateColumn("hidden", hidden).Error
+	}
+	return db.Model(&ArticleModel{}).Where("id = ?", report.ArticleID).UpdateColumn("hidden", hidden).Error
+}
+
+// File an open report, hiding what it is about once ReportHideThreshold open reports pile up.
+// A reader can only have one open report on the same article or comment.
+func createReport(report *ReportModel) error {
+	report.Status = ReportOpen
+	openKey := fmt.Sprintf("%v:%v:%v", report.ArticleID, report.CommentID, report.ReporterID)
+	if report.CommentID != nil {
+		openKey = fmt.Sprintf("%v:%v:%v", report.ArticleID, *report.CommentID, report.ReporterID)
+	}
+	report.OpenKey = &openKey
+	return common.Transaction(func(tx *gorm.DB) error {
+		var count int
+		err := tx.Model(&ReportModel{}).Scopes(report.sameTarget).Where("reporter_id = ? AND status = ?", report.ReporterID, ReportOpen).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errAlreadyReported
+		}
+		if err := tx.Create(report).Error; err != nil {
+			if common.IsUniqueViolation(err) {
+				return errAlreadyReported
+			}
+			return err
+		}
+		if err := tx.Model(&ReportModel{}).Scopes(report.sameTarget).Where("status = ?", ReportOpen).Count(&count).Error; err != nil {
+			return err
+		}
+		if ReportHideThreshold > 0 && count >= ReportHideThreshold {
+			return report.hideTarget(tx, true)
+		}
+		return nil
+	})
+}
+
+func FindOneReport(condition interface{}) (ReportModel, error) {
+	db := common.GetDB()
+	var model ReportModel
+	err := db.Where(condition).First(&model).Error
+	return model, err
+}
+
+// The open reports, oldest first, along with what they are about, its author and how many open
+// reports there are on it. Deleted articles and comments are still loaded to give moderators context.
+func FindOpenReports(limit, offset int) ([]ReportModel, []int, int, error) {
+	db := common.GetDB()
+	var models []ReportModel
+	var count int
+	tx := db.Begin()
+	tx.Model(&ReportModel{}).Where("status = ?", ReportOpen).Count(&count)
+	tx.Where("status = ?", ReportOpen).Order("id asc").Offset(offset).Limit(limit).Find(&models)
+	targetCounts := make([]int, len(models))
+	for i, _ := range models {
+		report := &models[i]
+		tx.Model(&ReportModel{}).Scopes(report.sameTarget).Where("status = ?", ReportOpen).Count(&targetCounts[i])
+		tx.Model(report).Related(&report.Reporter, "Reporter")
+		tx.Model(&report.Reporter).Related(&report.Reporter.UserModel)
+		tx.Unscoped().Where("id = ?", report.ArticleID).First(&report.Article)
+		tx.Model(&report.Article).Related(&report.Article.Author, "Author")
+		tx.Model(&report.Article.Author).Related(&report.Article.Author.UserModel)
+		if report.CommentID != nil {
+			tx.Unscoped().Where("id = ?", *report.CommentID).First(&report.Comment)
+			tx.Model(&report.Comment).Related(&report.Comment.Author, "Author")
+			tx.Model(&report.Comment.Author).Related(&report.Comment.Author.UserModel)
+		}
+	}
+	err := tx.Commit().Error
+	return models, targetCounts, count, err
+}
+
+// What a moderator can do about a report, "dismiss" keeps the content and can not be combined.
+const (
+	ReportDismiss = "dismiss"
+	ReportHide    = "hide"
+	ReportDelete  = "delete"
+	ReportWarn    = "warn"
+	ReportSuspend = "suspend"
+)
+
+// Carry out actions on what report is about and close every open report on it.
+// Dismissing also shows content which got hidden by the report threshold again.
+func (report *ReportModel) resolve(actions []string, moderator ArticleUserModel, suspendFor time.Duration) error {
+	for _, action := range actions {
+		if action == ReportDismiss && len(actions) > 1 {
+			return errors.New("Dismiss can not be combined with other actions")
+		}
+	}
+	db := common.GetDB()
+	var author users.UserModel
+	if report.CommentID != nil {
+		var comment CommentModel
+		db.Unscoped().Where("id = ?", *report.CommentID).First(&comment)
+		db.Model(&comment).Related(&comment.Author, "Author")
+		db.Model(&comment.Author).Related(&author)
+	} else {
+		var article ArticleModel
+		db.Unscoped().Where("id = ?", report.ArticleID).First(&article)
+		db.Model(&article).Related(&article.Author, "Author")
+		db.Model(&article.Author).Related(&author)
+	}
+
+	status := ReportResolved
+	for _, action := range actions {
+		var err error
+		switch action {
+		case ReportDismiss:
+			status = ReportDismissed
+			err = report.hideTarget(db, false)
+		case ReportHide:
+			err = report.hideTarget(db, true)
+		case ReportDelete:
+			if report.CommentID != nil {
+				err = DeleteCommentModel([]uint{*report.CommentID})
+			} else {
+				err = DeleteArticleModel([]uint{report.ArticleID})
+			}
+		case ReportWarn:
+			err = author.Warn()
+		case ReportSuspend:
+			err = author.Suspend(time.Now().Add(suspendFor))
+		default:
+			err = errors.New("Unknown action " + action)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := db.Model(&ReportModel{}).Scopes(report.sameTarget).Where("status = ?", ReportOpen).Updates(map[string]interface{}{
+		"status":         status,
+		"action":         strings.Join(actions, ","),
+		"resolved_by_id": moderator.ID,
+		"open_key":       nil,
+	}).Error
+	if err == nil {
+		report.Status = status
+		report.Action = strings.Join(actions, ",")
+		report.ResolvedByID = moderator.ID
+	}
+	return err
+}
+
+// Whether the author of content posted the same text since, other than content itself.
+func isDuplicate(content common.Content, since time.Time) bool {
+	db := common.GetDB()
+	text := strings.TrimSpace(content.Text)
+	if text == "" || content.AuthorID == 0 {
+		return false
+	}
+	if content.Kind == "comment" {
+		var count int
+		db.Model(&CommentModel{}).Where("author_id = ? AND id <> ? AND created_at > ? AND body = ?", content.AuthorID, content.ID, since, content.Text).Count(&count)
+		return count > 0
+	}
+	var recent []ArticleModel
+	db.Select("title, description, body").Where("author_id = ? AND id <> ? AND created_at > ?", content.AuthorID, content.ID, since).Find(&recent)
+	for _, article := range recent {
+		if strings.TrimSpace(articleText(article.Title, article.Description, article.Body)) == text {
+			return true
+		}
+	}
+	return false
+}
+
+// Hide content the filters held back and queue it for moderators as a report without a reporter,
+// dismissing the report publishes it.
+func quarantine(articleID uint, commentID *uint, verdict common.Verdict) error {
+	report := ReportModel{
+		ArticleID: articleID,
+		CommentID: commentID,
+		Reason:    "filter",
+		Note:      verdict.Rule + ": " + verdict.Reason,
+	}
+	if err := report.hideTarget(common.GetDB(), true); err != nil {
+		return err
+	}
+	if err := createReport(&report); err != nil && err != errAlreadyReported {
+		return err
+	}
+	return nil
+}
+
+// An @ which doesn't follow a word character, so e-mail addresses don't count.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([A-Za-z0-9]+)`)
+
+// The usernames mentioned in text, each once in the order they first show up.
+func parseMentions(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[2]] {
+			seen[match[2]] = true
+			usernames = append(usernames, match[2])
+		}
+	}
+	return usernames
+}
+
+// Replace the mentions of an article, or of its comment when commentID is not nil, with the ones in text.
+// Names of unknown users are left alone. Returns all mentions along with the ones which weren't there before,
+// which get a UserMentioned event naming actorID.
+func saveMentions(articleID uint, commentID *uint, text string, actorID uint) ([]MentionModel, []MentionModel, error) {
+	db := common.GetDB()
+	mentions := []MentionModel{}
+	added := []MentionModel{}
+	target := func(db *gorm.DB) *gorm.DB {
+		if commentID != nil {
+			return db.Where("comment_id = ?", *commentID)
+		}
+		return db.Where("article_id = ? AND comment_id IS NULL", articleID)
+	}
+	var previous []MentionModel
+	db.Scopes(target).Find(&previous)
+	mentioned := map[uint]bool{}
+	for _, mention := range previous {
+		mentioned[mention.UserID] = true
+	}
+
+	usernames := parseMentions(text)
+	var userModels []users.UserModel
+	if len(usernames) > 0 {
+		db.Where("username in (?)", usernames).Find(&userModels)
+	}
+	usersByName := map[string]users.UserModel{}
+	for _, userModel := range userModels {
+		usersByName[userModel.Username] = userModel
+	}
+
+	tx := db.Begin()
+	tx.Unscoped().Scopes(target).Delete(MentionModel{})
+	for _, username := range usernames {
+		userModel, ok := usersByName[username]
+		if !ok {
+			continue
+		}
+		mention := MentionModel{ArticleID: articleID, CommentID: commentID, UserID: userModel.ID, Username: userModel.Username}
+		if err := tx.Create(&mention).Error; err != nil {
+			tx.Rollback()
+			return mentions, added, err
+		}
+		mentions = append(mentions, mention)
+		if mentioned[userModel.ID] {
+			continue
+		}
+		added = append(added, mention)
+		event := UserMentioned{ArticleID: articleID, CommentID: commentID, UserID: userModel.ID, ActorID: actorID}
+		if err := common.PublishEvent(tx, event); err != nil {
+			tx.Rollback()
+			return mentions, added, err
+		}
+	}
+	err := tx.Commit().Error
+	return mentions, added, err
+}
+
+// The users mentioned in the article itself, not counting its comments.
+func (article ArticleModel) getMentions() []MentionModel {
+	return articleMentions([]uint{article.ID})[article.ID]
+}
+
+// The mentions in the bodies of the articles with the given ids, in one query.
+func articleMentions(ids []uint) map[uint][]MentionModel {
+	byArticle := map[uint][]MentionModel{}
+	if len(ids) == 0 {
+		return byArticle
+	}
+	db := common.GetDB()
+	var mentions []MentionModel
+	db.Where("article_id in (?) AND comment_id IS NULL", ids).Order("id asc").Find(&mentions)
+	for _, mention := range mentions {
+		byArticle[mention.ArticleID] = append(byArticle[mention.ArticleID], mention)
+	}
+	return byArticle
+}
+
+// Fill in the mentions of comments with one query.
+func loadCommentMentions(db *gorm.DB, comments []CommentModel) {
+	var ids []uint
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	var mentions []MentionModel
+	db.Where("comment_id in (?)", ids).Order("id asc").Find(&mentions)
+	byComment := map[uint][]MentionModel{}
+	for _, mention := range mentions {
+		byComment[*mention.CommentID] = append(byComment[*mention.CommentID], mention)
+	}
+	for i, _ := range comments {
+		comments[i].Mentions = byComment[comments[i].ID]
+	}
+}
+
+// How often the digest goes out, 0 when it doesn't.
+func (subscription DigestSubscriptionModel) period() time.Duration {
+	switch subscription.Frequency {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// The digest subscription of self, with Frequency DigestOff when they never subscribed.
+func (self *ArticleUserModel) getDigest() DigestSubscriptionModel {
+	db := common.GetDB()
+	subscription := DigestSubscriptionModel{UserID: self.ID, Frequency: DigestOff}
+	db.Where(DigestSubscriptionModel{UserID: self.ID}).First(&subscription)
+	return subscription
+}
+
+func (self *ArticleUserModel) setDigest(frequency string) (DigestSubscriptionModel, error) {
+	db := common.GetDB()
+	subscription := self.getDigest()
+	subscription.Frequency = frequency
+	err := db.Save(&subscription).Error
+	return subscription, err
+}
+
+// The articles of the feed of self created after since, newest first, and how many there are in total.
+func (self *ArticleUserModel) newArticlesSince(since time.Time, limit int) ([]ArticleModel, int, error) {
+	db := common.GetDB()
+	var models []ArticleModel
+	var count int
+	query := self.feedQuery(db, false).Where("article_models.created_at > ?", since)
+	query.Count(&count)
+	err := query.Order("created_at desc").Limit(limit).Find(&models).Error
+	for i, _ := range models {
+		db.Model(&models[i]).Related(&models[i].Author, "Author")
+		db.Model(&models[i].Author).Related(&models[i].Author.UserModel)
+	}
+	return models, count, err
+}
+
+// Mail the digests which are due at now, and return how many went out. A digest covers the articles
+// since the previous one, or the last period for the first one, nothing is sent while there are none.
+// A failing subscriber doesn't hold up the others, they get retried on the next run.
+func SendDigests(mailer common.Mailer, now time.Time) (int, error) {
+	db := common.GetDB()
+	var subscriptions []DigestSubscriptionModel
+	err := db.Where("frequency in (?)", []string{DigestDaily, DigestWeekly}).Order("id asc").Find(&subscriptions).Error
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	var failed error
+	for _, subscription := range subscriptions {
+		since := now.Add(-subscription.period())
+		if subscription.LastSentAt != nil {
+			if subscription.LastSentAt.After(since) {
+				continue
+			}
+			since = *subscription.LastSentAt
+		}
+		db.Model(&subscription).Related(&subscription.User, "User")
+		db.Model(&subscription.User).Related(&subscription.User.UserModel)
+		articles, count, err := subscription.User.newArticlesSince(since, DigestMaxArticles)
+		if err != nil {
+			failed = err
+			continue
+		}
+		if count == 0 {
+			continue
+		}
+		message, err := DigestMessage(subscription, articles, count)
+		if err == nil {
+			err = mailer.Send(message)
+		}
+		if err != nil {
+			failed = err
+			continue
+		}
+		db.Model(&subscription).Update("last_sent_at", now)
+		sent++
+	}
+	return sent, failed
+}
+
+// Send the digests which are due, now and then every interval until stop is closed.
+//
+//	go RunDigests(common.MailerFromEnv(), time.Hour, nil)
+func RunDigests(mailer common.Mailer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := SendDigests(mailer, time.Now()); err != nil {
+			fmt.Println("digest err: (RunDigests) ", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func newFeedToken() string {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return common.RandString(48)
+	}
+	return hex.EncodeToString(token)
+}
+
+// The feed token of self, gorm.ErrRecordNotFound when there's none.
+func (self *ArticleUserModel) getFeedToken() (FeedTokenModel, error) {
+	db := common.GetDB()
+	var feedToken FeedTokenModel
+	err := db.Where(FeedTokenModel{UserID: self.ID}).First(&feedToken).Error
+	return feedToken, err
+}
+
+// Give self a new feed token, the previous one stops working.
+func (self *ArticleUserModel) resetFeedToken() (FeedTokenModel, error) {
+	feedToken := FeedTokenModel{UserID: self.ID, Token: newFeedToken()}
+	err := common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(FeedTokenModel{UserID: self.ID}).Delete(FeedTokenModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&feedToken).Error
+	})
+	return feedToken, err
+}
+
+func (self *ArticleUserModel) revokeFeedToken() error {
+	db := common.GetDB()
+	return db.Unscoped().Where(FeedTokenModel{UserID: self.ID}).Delete(FeedTokenModel{}).Error
+}
+
+// The user a feed token belongs to.
+func FindFeedTokenUser(token string) (ArticleUserModel, error) {
+	db := common.GetDB()
+	var feedToken FeedTokenModel
+	var user ArticleUserModel
+	if token == "" {
+		return user, gorm.ErrRecordNotFound
+	}
+	if err := db.Where(FeedTokenModel{Token: token}).First(&feedToken).Error; err != nil {
+		return user, err
+	}
+	err := db.Model(&feedToken).Related(&user, "User").Error
+	if err == nil {
+		err = db.Model(&user).Related(&user.UserModel).Error
+	}
+	return user, err
+}
+
+// A page of the frontend for the sitemap, Path is relative to common.AppURL.
+// LastModified is nil where nothing tells when the page changed.
+type SitemapEntry struct {
+	Path         string
+	LastModified *time.Time
+}
+
+type sitemapRow struct {
+	Name         string
+	LastModified *time.Time
+}
+
+type sitemapSection struct {
+	query func(db *gorm.DB) *gorm.DB
+	path  func(name string) string
+}
+
+// Visible articles, then the profiles and tags with at least one of them, each in a stable order
+// so the pages of a sitemap index don't shuffle between requests.
+var sitemapSections = []sitemapSection{
+	{
+		query: func(db *gorm.DB) *gorm.DB {
+			return db.Model(&ArticleModel{}).Scopes(visibleArticles).
+				Select("article_models.slug as name, article_models.updated_at as last_modified").
+				Order("article_models.id asc")
+		},
+		path: func(name string) string { return "/article/" + url.PathEscape(name) },
+	},
+	{
+		query: func(db *gorm.DB) *gorm.DB {
+			authors := db.Model(&ArticleModel{}).Scopes(visibleArticles).Select("author_id").QueryExpr()
+			return db.Table("user_models").Select("user_models.username as name").
+				Joins("join article_user_models on article_user_models.user_model_id = user_models.id").
+				Where("article_user_models.id in (?)", authors).
+				Order("user_models.id asc")
+		},
+		path: func(name string) string { return "/profile/" + url.PathEscape(name) },
+	},
+	{
+		query: func(db *gorm.DB) *gorm.DB {
+			tagged := db.Table("article_tags").Select("article_tags.tag_model_id").
+				Joins("join article_models on article_models.id = article_tags.article_model_id and article_models.deleted_at is null").
+				Scopes(visibleArticles).QueryExpr()
+			return db.Model(&TagModel{}).Select("tag_models.tag as name").
+				Where("tag_models.id in (?)", tagged).
+				Order("tag_models.id asc")
+		},
+		path: func(name string) string { return "/?tag=" + url.QueryEscape(name) },
+	},
+}
+
+// How many urls the sitemap has, and when the newest article in it changed.
+func CountSitemapEntries() (int, time.Time, error) {
+	db := common.GetDB()
+	total := 0
+	for _, section := range sitemapSections {
+		var count int
+		if err := section.query(db).Count(&count).Error; err != nil {
+			return 0, time.Time{}, err
+		}
+		total += count
+	}
+	var newest ArticleModel
+	db.Scopes(visibleArticles).Order("updated_at desc").Select("updated_at").First(&newest)
+	return total, newest.UpdatedAt, nil
+}
+
+// The urls of the sitemap from offset on, at most limit of them.
+func FindSitemapEntries(offset, limit int) ([]SitemapEntry, error) {
+	db := common.GetDB()
+	var entries []SitemapEntry
+	for _, section := range sitemapSections {
+		if limit <= 0 {
+			break
+		}
+		var count int
+		if err := section.query(db).Count(&count).Error; err != nil {
+			return entries, err
+		}
+		if offset >= count {
+			offset -= count
+			continue
+		}
+		var rows []sitemapRow
+		if err := section.query(db).Offset(offset).Limit(limit).Scan(&rows).Error; err != nil {
+			return entries, err
+		}
+		for _, row := range rows {
+			entries = append(entries, SitemapEntry{Path: section.path(row.Name), LastModified: row.LastModified})
+		}
+		offset = 0
+		limit -= len(rows)
+	}
+	return entries, nil
+}
+
+// Scale img down for the article and store it with its thumbnail.
+func (article ArticleModel) addImage(img image.Image, contentType string) (ArticleImageModel, error) {
+	prefix := fmt.Sprintf("articles/%v/", article.ID)
+	scaled := common.FitImage(img, ArticleImageMaxSize, ArticleImageMaxSize)
+	key, size, err := common.StoreImage(prefix, scaled, contentType)
+	if err != nil {
+		return ArticleImageModel{}, err
+	}
+	thumbnailKey, _, err := common.StoreImage(prefix, common.FitImage(img, ArticleThumbnailSize, ArticleThumbnailSize), contentType)
+	if err != nil {
+		deleteMedia(key)
+		return ArticleImageModel{}, err
+	}
+	model := ArticleImageModel{
+		ArticleID:    article.ID,
+		Key:          key,
+		ThumbnailKey: thumbnailKey,
+		ContentType:  contentType,
+		Width:        scaled.Bounds().Dx(),
+		Height:       scaled.Bounds().Dy(),
+		Size:         size,
+	}
+	if err := common.GetDB().Create(&model).Error; err != nil {
+		deleteMedia(key, thumbnailKey)
+		return model, err
+	}
+	return model, nil
+}
+
+func (article ArticleModel) getImages() ([]ArticleImageModel, error) {
+	db := common.GetDB()
+	var images []ArticleImageModel
+	err := db.Where(ArticleImageModel{ArticleID: article.ID}).Order("id asc").Find(&images).Error
+	return images, err
+}
+
+func (article ArticleModel) findImage(id uint) (ArticleImageModel, error) {
+	db := common.GetDB()
+	var model ArticleImageModel
+	err := db.Where("id = ? AND article_id = ?", id, article.ID).First(&model).Error
+	return model, err
+}
+
+// Images are gone for good once deleted, there's no trash for them.
+func (model ArticleImageModel) delete() error {
+	db := common.GetDB()
+	if err := db.Unscoped().Delete(&model).Error; err != nil {
+		return err
+	}
+	deleteMedia(model.Key, model.ThumbnailKey)
+	return nil
+}
+
+// Remove files from common.Media, failures only leave orphans behind so they are logged.
+func deleteMedia(keys ...string) {
+	for _, key := range keys {
+		if err := common.Media.Delete(key); err != nil {
+			fmt.Println("media err: (deleteMedia) ", err)
+		}
+	}
+}
+
+var errReadingListName = errors.New("You already have a list with this name")
+
+// The reading lists of self, oldest first.
+func (self *ArticleUserModel) getReadingLists() ([]ReadingListModel, error) {
+	db := common.GetDB()
+	var models []ReadingListModel
+	err := db.Where(ReadingListModel{OwnerID: self.ID}).Order("created_at").Find(&models).Error
+	return models, err
+}
+
+// The reading list of self with the given id, the lists of others are not found.
+func (self *ArticleUserModel) findReadingList(id string) (ReadingListModel, error) {
+	db := common.GetDB()
+	var model ReadingListModel
+	err := db.Where("id = ? AND owner_id = ?", id, self.ID).First(&model).Error
+	return model, err
+}
+
+func (self *ArticleUserModel) readingListNameTaken(name string, except uint) bool {
+	db := common.GetDB()
+	var count int
+	db.Model(&ReadingListModel{}).Where("owner_id = ? AND name = ? AND id <> ?", self.ID, name, except).Count(&count)
+	return count > 0
+}
+
+func (self *ArticleUserModel) createReadingList(name string) (ReadingListModel, error) {
+	model := ReadingListModel{OwnerID: self.ID, Name: name}
+	if self.readingListNameTaken(name, 0) {
+		return model, errReadingListName
+	}
+	err := common.GetDB().Create(&model).Error
+	return model, err
+}
+
+func (list *ReadingListModel) rename(name string) error {
+	owner := ArticleUserModel{}
+	owner.ID = list.OwnerID
+	if owner.readingListNameTaken(name, list.ID) {
+		return errReadingListName
+	}
+	list.Name = name
+	return common.GetDB().Model(list).Update("name", name).Error
+}
+
+// Items are removed for good, a list is a bookmark and not worth a trash.
+func (list ReadingListModel) delete() error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(ReadingListItemModel{ListID: list.ID}).Delete(ReadingListItemModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&list).Error
+	})
+}
+
+// The number of articles in the list readers get to see.
+func (list ReadingListModel) articlesCount() int {
+	db := common.GetDB()
+	var count int
+	db.Model(&ArticleModel{}).Scopes(visibleArticles).
+		Joins("join reading_list_item_models on reading_list_item_models.article_id = article_models.id").
+		Where("reading_list_item_models.list_id = ?", list.ID).Count(&count)
+	return count
+}
+
+// Put article at the end of the list, unless it is in there already.
+func (list ReadingListModel) addArticle(article ArticleModel) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		var item ReadingListItemModel
+		tx.Where(ReadingListItemModel{ListID: list.ID, ArticleID: article.ID}).First(&item)
+		if item.ID != 0 {
+			return nil
+		}
+		var last struct{ Position *int }
+		tx.Model(&ReadingListItemModel{}).Select("max(position) as position").Where(ReadingListItemModel{ListID: list.ID}).Scan(&last)
+		item = ReadingListItemModel{ListID: list.ID, ArticleID: article.ID}
+		if last.Position != nil {
+			item.Position = *last.Position + 1
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return tx.Model(&list).UpdateColumn("updated_at", item.CreatedAt).Error
+	})
+}
+
+func (list ReadingListModel) removeArticle(article ArticleModel) error {
+	db := common.GetDB()
+	return db.Unscoped().Where(ReadingListItemModel{ListID: list.ID, ArticleID: article.ID}).Delete(ReadingListItemModel{}).Error
+}
+
+// Move the articles with the given slugs to the top of the list in that order, the others
+// follow in the order they had. Every slug has to be in the list.
+func (list ReadingListModel) reorder(slugs []string) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		var items []ReadingListItemModel
+		tx.Where(ReadingListItemModel{ListID: list.ID}).Order("position").Find(&items)
+		ids := make([]uint, len(items))
+		for i, item := range items {
+			ids[i] = item.ArticleID
+		}
+		positions, err := movedToTop(tx, ids, slugs, "list")
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := tx.Model(&item).UpdateColumn("position", positions[item.ArticleID]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&list).UpdateColumn("updated_at", time.Now()).Error
+	})
+}
+
+// The positions of the articles ids, given in their current order, once the articles with the given
+// slugs moved to the top in that order. Slugs of articles outside of ids are an error naming container.
+func movedToTop(tx *gorm.DB, ids []uint, slugs []string, container string) (map[uint]int, error) {
+	var articles []ArticleModel
+	tx.Where("id in (?)", ids).Find(&articles)
+	slugIDs := map[string]uint{}
+	for _, article := range articles {
+		slugIDs[article.Slug] = article.ID
+	}
+	positions := map[uint]int{}
+	for _, slug := range slugs {
+		id, ok := slugIDs[slug]
+		if !ok {
+			return nil, fmt.Errorf("%v is not in the %v", slug, container)
+		}
+		if _, ok := positions[id]; !ok {
+			positions[id] = len(positions)
+		}
+	}
+	for _, id := range ids {
+		if _, ok := positions[id]; !ok {
+			positions[id] = len(positions)
+		}
+	}
+	return positions, nil
+}
+
+// Whether article is in any reading list of user.
+func (article ArticleModel) isBookmarkedBy(user ArticleUserModel) bool {
+	return articleBookmarks([]uint{article.ID}, user)[article.ID]
+}
+
+// Which of the articles with the given ids are in any reading list of user, in one query.
+func articleBookmarks(ids []uint, user ArticleUserModel) map[uint]bool {
+	bookmarked := map[uint]bool{}
+	if user.ID == 0 || len(ids) == 0 {
+		return bookmarked
+	}
+	db := common.GetDB()
+	var articleIDs []uint
+	db.Model(&ReadingListItemModel{}).
+		Joins("join reading_list_models on reading_list_models.id = reading_list_item_models.list_id and reading_list_models.deleted_at is null").
+		Where("reading_list_item_models.article_id in (?) AND reading_list_models.owner_id = ?", ids, user.ID).
+		Pluck("distinct reading_list_item_models.article_id", &articleIDs)
+	for _, id := range articleIDs {
+		bookmarked[id] = true
+	}
+	return bookmarked
+}
+
+var errArticleInSeries = errors.New("The article is part of another series")
+
+func FindOneSeries(condition interface{}) (SeriesModel, error) {
+	db := common.GetDB()
+	var model SeriesModel
+	tx := db.Begin()
+	if err := tx.Where(condition).First(&model).Error; err != nil {
+		tx.Rollback()
+		return model, err
+	}
+	tx.Model(&model).Related(&model.Author, "Author")
+	tx.Model(&model.Author).Related(&model.Author.UserModel)
+	err := tx.Commit().Error
+	return model, err
+}
+
+// A slug for a series titled title which no other series than seriesID has.
+func uniqueSeriesSlug(title string, seriesID uint) string {
+	db := common.GetDB()
+	base := slug.Make(title)
+	if base == "" {
+		base = "series"
+	}
+	candidate := base
+	for i := 2; ; i++ {
+		var count int
+		db.Unscoped().Model(&SeriesModel{}).Where("slug = ? AND id <> ?", candidate, seriesID).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%v-%v", base, i)
+	}
+}
+
+func (series *SeriesModel) Update(data interface{}) error {
+	db := common.GetDB()
+	err := db.Model(series).Update(data).Error
+	return err
+}
+
+// The series goes for good, its articles stay as they are.
+func (series SeriesModel) delete() error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(SeriesPartModel{SeriesID: series.ID}).Delete(SeriesPartModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&series).Error
+	})
+}
+
+// The articles of the series in order, with their authors. Deleted articles are left out, hidden
+// ones are not, see ArticleModel.visibleTo.
+func (series SeriesModel) getArticles() ([]ArticleModel, error) {
+	db := common.GetDB()
+	var models []ArticleModel
+	tx := db.Begin()
+	tx.Model(&ArticleModel{}).
+		Joins("join series_part_models on series_part_models.article_id = article_models.id").
+		Where("series_part_models.series_id = ?", series.ID).
+		Select("article_models.*").Order("series_part_models.position").Find(&models)
+	for i := range models {
+		tx.Model(&models[i]).Related(&models[i].Author, "Author")
+	}
+	err := tx.Commit().Error
+	return models, err
+}
+
+// Put article at the end of the series, unless it is in there already.
+func (series SeriesModel) addArticle(article ArticleModel) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		var part SeriesPartModel
+		tx.Where(SeriesPartModel{ArticleID: article.ID}).First(&part)
+		if part.ID != 0 {
+			if part.SeriesID != series.ID {
+				return errArticleInSeries
+			}
+			return nil
+		}
+		var last struct{ Position *int }
+		tx.Model(&SeriesPartModel{}).Select("max(position) as position").Where(SeriesPartModel{SeriesID: series.ID}).Scan(&last)
+		part = SeriesPartModel{SeriesID: series.ID, ArticleID: article.ID}
+		if last.Position != nil {
+			part.Position = *last.Position + 1
+		}
+		if err := tx.Create(&part).Error; err != nil {
+			return err
+		}
+		return tx.Model(&series).UpdateColumn("updated_at", part.CreatedAt).Error
+	})
+}
+
+func (series SeriesModel) removeArticle(article ArticleModel) error {
+	db := common.GetDB()
+	return db.Unscoped().Where(SeriesPartModel{SeriesID: series.ID, ArticleID: article.ID}).Delete(SeriesPartModel{}).Error
+}
+
+// Move the articles with the given slugs to the front of the series in that order, see movedToTop.
+func (series SeriesModel) reorder(slugs []string) error {
+	return common.Transaction(func(tx *gorm.DB) error {
+		var parts []SeriesPartModel
+		tx.Where(SeriesPartModel{SeriesID: series.ID}).Order("position").Find(&parts)
+		ids := make([]uint, len(parts))
+		for i, part := range parts {
+			ids[i] = part.ArticleID
+		}
+		positions, err := movedToTop(tx, ids, slugs, "series")
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			if err := tx.Model(&part).UpdateColumn("position", positions[part.ArticleID]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&series).UpdateColumn("updated_at", time.Now()).Error
+	})
+}
+
+// The series article is a part of along with all of its articles.
+func (article ArticleModel) getSeries() (SeriesModel, []ArticleModel, error) {
+	found, ok := articleSeries([]uint{article.ID})[article.ID]
+	if !ok {
+		return SeriesModel{}, nil, gorm.ErrRecordNotFound
+	}
+	return found.Series, found.Articles, nil
+}
+
+// A series with its articles in order, the way SeriesModel.getArticles has them.
+type seriesParts struct {
+	Series   SeriesModel
+	Articles []ArticleModel
+}
+
+// The series each of the articles with the given ids is a part of, in the same few queries however
+// many articles there are. Articles in no series are left out.
+func articleSeries(ids []uint) map[uint]seriesParts {
+	found := map[uint]seriesParts{}
+	if len(ids) == 0 {
+		return found
+	}
+	db := common.GetDB()
+	var seriesIDs []uint
+	db.Model(&SeriesPartModel{}).Where("article_id in (?)", ids).Pluck("distinct series_id", &seriesIDs)
+	if len(seriesIDs) == 0 {
+		return found
+	}
+	var seriesModels []SeriesModel
+	db.Where("id in (?)", seriesIDs).Find(&seriesModels)
+	var parts []SeriesPartModel
+	db.Where("series_id in (?)", seriesIDs).Order("position").Find(&parts)
+	articleIDs := make([]uint, len(parts))
+	for i, part := range parts {
+		articleIDs[i] = part.ArticleID
+	}
+	var articleModels []ArticleModel
+	db.Where("id in (?)", articleIDs).Find(&articleModels)
+	var authorIDs []uint
+	for _, model := range articleModels {
+		authorIDs = append(authorIDs, model.AuthorID)
+	}
+	var authors []ArticleUserModel
+	db.Where("id in (?)", authorIDs).Find(&authors)
+	authorsByID := map[uint]ArticleUserModel{}
+	for _, author := range authors {
+		authorsByID[author.ID] = author
+	}
+	articlesByID := map[uint]ArticleModel{}
+	for _, model := range articleModels {
+		model.Author = authorsByID[model.AuthorID]
+		articlesByID[model.ID] = model
+	}
+
+	bySeries := map[uint]*seriesParts{}
+	for _, series := range seriesModels {
+		bySeries[series.ID] = &seriesParts{Series: series, Articles: []ArticleModel{}}
+	}
+	partOf := map[uint]uint{}
+	for _, part := range parts {
+		series, ok := bySeries[part.SeriesID]
+		model, published := articlesByID[part.ArticleID]
+		if !ok || !published {
+			continue
+		}
+		series.Articles = append(series.Articles, model)
+		partOf[model.ID] = part.SeriesID
+	}
+	for _, id := range ids {
+		if seriesID, ok := partOf[id]; ok {
+			found[id] = *bySeries[seriesID]
+		}
+	}
+	return found
+}
+
+var (
+	errInviteAuthor   = errors.New("The user is an author of the article already")
+	errAlreadyInvited = errors.New("The user has been invited already")
+)
+
+// The co-authors of article in the order they joined, with their users.
+func (article ArticleModel) getCoauthors() ([]ArticleUserModel, error) {
+	return articleCoauthors([]uint{article.ID})[article.ID], nil
+}
+
+// The co-authors of each of the articles with the given ids, see getCoauthors, in the same three
+// queries however many articles there are.
+func articleCoauthors(ids []uint) map[uint][]ArticleUserModel {
+	coauthors := map[uint][]ArticleUserModel{}
+	if len(ids) == 0 {
+		return coauthors
+	}
+	db := common.GetDB()
+	var memberships []ArticleAuthorModel
+	db.Where("article_id in (?) AND accepted_at IS NOT NULL", ids).Order("accepted_at").Find(&memberships)
+	if len(memberships) == 0 {
+		return coauthors
+	}
+	authorIDs := make([]uint, len(memberships))
+	for i, membership := range memberships {
+		authorIDs[i] = membership.AuthorID
+	}
+	var authors []ArticleUserModel
+	db.Where("id in (?)", authorIDs).Find(&authors)
+	userIDs := make([]uint, len(authors))
+	for i, author := range authors {
+		userIDs[i] = author.UserModelID
+	}
+	var userModels []users.UserModel
+	db.Where("id in (?)", userIDs).Find(&userModels)
+	usersByID := map[uint]users.UserModel{}
+	for _, userModel := range userModels {
+		usersByID[userModel.ID] = userModel
+	}
+	authorsByID := map[uint]ArticleUserModel{}
+	for _, author := range authors {
+		author.UserModel = usersByID[author.UserModelID]
+		authorsByID[author.ID] = author
+	}
+	for _, membership := range memberships {
+		if author, ok := authorsByID[membership.AuthorID]; ok {
+			coauthors[membership.ArticleID] = append(coauthors[membership.ArticleID], author)
+		}
+	}
+	return coauthors
+}
+
+// The invitations of article nobody answered yet, with their invitees.
+func (article ArticleModel) getInvitations() ([]ArticleAuthorModel, error) {
+	db := common.GetDB()
+	var models []ArticleAuthorModel
+	tx := db.Begin()
+	tx.Where("article_id = ? AND accepted_at IS NULL", article.ID).Order("created_at").Find(&models)
+	for i := range models {
+		tx.Model(&models[i]).Related(&models[i].Author, "Author")
+		tx.Model(&models[i].Author).Related(&models[i].Author.UserModel)
+	}
+	err := tx.Commit().Error
+	return models, err
+}
+
+// Ask invitee to co-author article, inviter being its owner.
+func (article ArticleModel) invite(invitee, inviter ArticleUserModel) (ArticleAuthorModel, error) {
+	invitation := ArticleAuthorModel{ArticleID: article.ID, AuthorID: invitee.ID, InvitedByID: inviter.ID}
+	if invitee.ID == article.AuthorID {
+		return invitation, errInviteAuthor
+	}
+	err := common.Transaction(func(tx *gorm.DB) error {
+		var existing ArticleAuthorModel
+		tx.Where(ArticleAuthorModel{ArticleID: article.ID, AuthorID: invitee.ID}).First(&existing)
+		if existing.ID != 0 {
+			if existing.AcceptedAt != nil {
+				return errInviteAuthor
+			}
+			return errAlreadyInvited
+		}
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, CoauthorInvited{
+			InvitationID: invitation.ID,
+			ArticleID:    article.ID,
+			InviteeID:    invitee.UserModelID,
+			InviterID:    inviter.UserModelID,
+		})
+	})
+	return invitation, err
+}
+
+// Take author off article, whether they co-author it or are still invited.
+func (article ArticleModel) removeAuthor(author ArticleUserModel) error {
+	db := common.GetDB()
+	return db.Unscoped().Where(ArticleAuthorModel{ArticleID: article.ID, AuthorID: author.ID}).Delete(ArticleAuthorModel{}).Error
+}
+
+// The invitations self hasn't answered yet, newest first, with their articles and who sent them.
+func (self *ArticleUserModel) getInvitations() ([]ArticleAuthorModel, error) {
+	db := common.GetDB()
+	var models []ArticleAuthorModel
+	tx := db.Begin()
+	tx.Joins("join article_models on article_models.id = article_author_models.article_id and article_models.deleted_at is null").
+		Where("article_author_models.author_id = ? AND article_author_models.accepted_at IS NULL", self.ID).
+		Order("article_author_models.created_at desc").Select("article_author_models.*").Find(&models)
+	for i := range models {
+		tx.Model(&models[i]).Related(&models[i].Article, "Article")
+		tx.Model(&models[i]).Related(&models[i].InvitedBy, "InvitedBy")
+		tx.Model(&models[i].InvitedBy).Related(&models[i].InvitedBy.UserModel)
+	}
+	err := tx.Commit().Error
+	return models, err
+}
+
+// One of the invitations self hasn't answered yet.
+func (self *ArticleUserModel) findInvitation(id string) (ArticleAuthorModel, error) {
+	db := common.GetDB()
+	var model ArticleAuthorModel
+	err := db.Where("id = ? AND author_id = ? AND accepted_at IS NULL", id, self.ID).First(&model).Error
+	return model, err
+}
+
+func (invitation *ArticleAuthorModel) accept() error {
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	db := common.GetDB()
+	return db.Model(invitation).Update("accepted_at", now).Error
+}
+
+func (invitation ArticleAuthorModel) decline() error {
+	db := common.GetDB()
+	return db.Unscoped().Delete(&invitation).Error
+}
+
+func validReaction(reaction string) bool {
+	for _, name := range Reactions {
+		if name == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// Leave reaction on the article, or on its comment when commentID is set, or take it back if
+// user left it already. Returns whether the reaction is on now.
+func toggleReaction(articleID uint, commentID *uint, user ArticleUserModel, reaction string) (bool, error) {
+	target := ReactionModel{ArticleID: articleID, UserID: user.ID, Reaction: reaction}
+	if commentID != nil {
+		target.CommentID = *commentID
+	}
+	on := false
+	err := common.Transaction(func(tx *gorm.DB) error {
+		var existing ReactionModel
+		err := tx.Where("article_id = ? AND comment_id = ? AND user_id = ? AND reaction = ?", target.ArticleID, target.CommentID, target.UserID, target.Reaction).
+			First(&existing).Error
+		if err == nil {
+			return tx.Unscoped().Delete(&existing).Error
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		on = true
+		return tx.Create(&target).Error
+	})
+	// Another request left the same reaction between the lookup and the insert
+	if common.IsUniqueViolation(err) {
+		return true, nil
+	}
+	return on, err
+}
+
+// The reactions on the articles with the given ids as read by reader, see loadReactions.
+func articleReactions(ids []uint, reader ArticleUserModel) map[uint]ReactionSummary {
+	return loadReactions("article_id", "comment_id = 0 AND article_id in (?)", ids, reader)
+}
+
+// The reactions on the comments with the given ids as read by reader, see loadReactions.
+func commentReactions(ids []uint, reader ArticleUserModel) map[uint]ReactionSummary {
+	return loadReactions("comment_id", "comment_id in (?)", ids, reader)
+}
+
+type reactionCount struct {
+	TargetID uint
+	Reaction string
+	Count    int
+}
+
+// Summarize the reactions on a page of articles or comments in two queries, however long the page is.
+// Column holds their id in reaction_models, condition picks their reactions out of ids.
+func loadReactions(column, condition string, ids []uint, reader ArticleUserModel) map[uint]ReactionSummary {
+	summaries := map[uint]ReactionSummary{}
+	for _, id := range ids {
+		summaries[id] = ReactionSummary{Counts: map[string]int{}, Mine: map[string]bool{}}
+	}
+	if len(ids) == 0 {
+		return summaries
+	}
+	db := common.GetDB()
+	var counts []reactionCount
+	db.Model(&ReactionModel{}).Select(column+" as target_id, reaction, count(*) as count").
+		Where(condition, ids).Group(column + ", reaction").Scan(&counts)
+	for _, count := range counts {
+		summaries[count.TargetID].Counts[count.Reaction] = count.Count
+	}
+	if reader.ID == 0 {
+		return summaries
+	}
+	var mine []reactionCount
+	db.Model(&ReactionModel{}).Select(column+" as target_id, reaction").
+		Where(condition, ids).Where("user_id = ?", reader.ID).Scan(&mine)
+	for _, reaction := range mine {
+		summaries[reaction.TargetID].Mine[reaction.Reaction] = true
+	}
+	return summaries
 }
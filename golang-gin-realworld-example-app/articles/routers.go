@@ -1,12 +1,17 @@
 package articles
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"realworld-backend/common"
 	"realworld-backend/users"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func ArticlesRegister(router *gin.RouterGroup) {
@@ -16,19 +21,234 @@ func ArticlesRegister(router *gin.RouterGroup) {
 	router.POST("/:slug/favorite", ArticleFavorite)
 	router.DELETE("/:slug/favorite", ArticleUnfavorite)
 	router.POST("/:slug/comments", ArticleCommentCreate)
+	router.PUT("/:slug/comments/:id", ArticleCommentUpdate)
 	router.DELETE("/:slug/comments/:id", ArticleCommentDelete)
+	router.GET("/:slug/comments/:id/edits", users.RequireRole(users.RoleModerator), ArticleCommentEditList)
+	router.POST("/:slug/revisions/:n/restore", ArticleRevisionRestore)
+	router.POST("/:slug/report", ArticleReport)
+	router.POST("/:slug/comments/:id/report", ArticleCommentReport)
+	router.POST("/:slug/images", ArticleImageUpload)
+	router.DELETE("/:slug/images/:id", ArticleImageDelete)
+	router.POST("/:slug/authors", ArticleAuthorInvite)
+	router.DELETE("/:slug/authors/:username", ArticleAuthorRemove)
+	router.POST("/:slug/reactions/:reaction", ArticleReact)
+	router.POST("/:slug/comments/:id/reactions/:reaction", ArticleCommentReact)
 }
 
 func ArticlesAnonymousRegister(router *gin.RouterGroup) {
 	router.GET("/", ArticleList)
 	router.GET("/:slug", ArticleRetrieve)
 	router.GET("/:slug/comments", ArticleCommentList)
+	router.GET("/:slug/revisions", ArticleRevisionList)
+	router.GET("/:slug/revisions/:n", ArticleRevisionRetrieve)
+	router.GET("/:slug/revisions/:n/diff", ArticleRevisionDiff)
+	router.GET("/:slug/meta", ArticleMeta)
+	router.GET("/:slug/images", ArticleImageList)
+	router.GET("/:slug/images/:id", ArticleImageRetrieve)
+	router.GET("/:slug/authors", ArticleAuthorList)
+}
+
+// Mount it at the root, search engines look for /sitemap.xml.
+func SitemapRegister(router *gin.RouterGroup) {
+	router.GET("/sitemap.xml", Sitemap)
+	router.GET("/sitemaps/:page", SitemapPage)
+}
+
+func TrashRegister(router *gin.RouterGroup) {
+	router.GET("/trash", UserTrash)
+	router.POST("/trash/articles/:slug/restore", TrashArticleRestore)
+	router.POST("/trash/comments/:id/restore", TrashCommentRestore)
 }
 
 func TagsAnonymousRegister(router *gin.RouterGroup) {
 	router.GET("/", TagList)
 }
 
+func TagsRegister(router *gin.RouterGroup) {
+	router.POST("/:tag/follow", TagFollow)
+	router.DELETE("/:tag/follow", TagUnfollow)
+}
+
+func UserTagsRegister(router *gin.RouterGroup) {
+	router.GET("/tags", UserTagList)
+}
+
+func UserDigestRegister(router *gin.RouterGroup) {
+	router.GET("/digest", UserDigestRetrieve)
+	router.PUT("/digest", UserDigestUpdate)
+}
+
+func UserFeedTokenRegister(router *gin.RouterGroup) {
+	router.GET("/feed-token", FeedTokenRetrieve)
+	router.POST("/feed-token", FeedTokenReset)
+	router.DELETE("/feed-token", FeedTokenRevoke)
+}
+
+func UserReadingListRegister(router *gin.RouterGroup) {
+	router.GET("/lists", ReadingListList)
+	router.POST("/lists", ReadingListCreate)
+	router.GET("/lists/:id", ReadingListRetrieve)
+	router.PUT("/lists/:id", ReadingListUpdate)
+	router.DELETE("/lists/:id", ReadingListDelete)
+	router.PUT("/lists/:id/articles", ReadingListReorder)
+	router.POST("/lists/:id/articles/:slug", ReadingListAdd)
+	router.DELETE("/lists/:id/articles/:slug", ReadingListRemove)
+}
+
+// Invitations to co-author articles, see ArticleAuthorInvite.
+func UserInvitationRegister(router *gin.RouterGroup) {
+	router.GET("/invitations", InvitationList)
+	router.POST("/invitations/:id/accept", InvitationAccept)
+	router.POST("/invitations/:id/decline", InvitationDecline)
+}
+
+func SeriesAnonymousRegister(router *gin.RouterGroup) {
+	router.GET("/:slug", SeriesRetrieve)
+}
+
+func SeriesRegister(router *gin.RouterGroup) {
+	router.POST("/", SeriesCreate)
+	router.PUT("/:slug", SeriesUpdate)
+	router.DELETE("/:slug", SeriesDelete)
+	router.PUT("/:slug/articles", SeriesReorder)
+	router.POST("/:slug/articles/:article", SeriesAdd)
+	router.DELETE("/:slug/articles/:article", SeriesRemove)
+}
+
+// The unsubscribe links in digest emails, they work without logging in. Opening one only asks to
+// confirm, so link scanners and prefetching mail clients don't unsubscribe anyone.
+func DigestAnonymousRegister(router *gin.RouterGroup) {
+	router.GET("/unsubscribe", DigestUnsubscribeConfirm)
+	router.POST("/unsubscribe", DigestUnsubscribe)
+}
+
+// Mount it behind users.RequireRole(users.RoleModerator)
+func ModerationRegister(router *gin.RouterGroup) {
+	router.GET("/reports", ReportList)
+	router.POST("/reports/:id/resolve", ReportResolve)
+}
+
+// Hook the side effects of this package up to the domain events, see common.DispatchEvents.
+// Subscribers check the content is still there for readers, it may have been hidden since.
+func SubscribeEvents() {
+	common.Subscribe("articles.stream-article", func(meta common.EventMeta, event ArticleCreated) error {
+		return common.Stream.Publish("article", common.AuthorTopic(event.AuthorID), event.ArticleID)
+	})
+	common.Subscribe("articles.webhook-article-created", func(meta common.EventMeta, event ArticleCreated) error {
+		return dispatchArticleWebhook(meta, users.WebhookArticleCreated, event.ArticleID)
+	})
+	common.Subscribe("articles.webhook-article-updated", func(meta common.EventMeta, event ArticleUpdated) error {
+		return dispatchArticleWebhook(meta, users.WebhookArticleUpdated, event.ArticleID)
+	})
+	common.Subscribe("articles.webhook-article-deleted", func(meta common.EventMeta, event ArticleDeleted) error {
+		return dispatchArticleWebhook(meta, users.WebhookArticleDeleted, event.ArticleID)
+	})
+	common.Subscribe("articles.notify-favorite", func(meta common.EventMeta, event ArticleFavorited) error {
+		articleModel, err := findArticleByID(event.ArticleID)
+		if err != nil || articleModel.DeletedAt != nil || articleModel.Hidden {
+			return nil
+		}
+		return users.Notify(users.NotificationModel{
+			RecipientID:  articleModel.Author.UserModelID,
+			ActorID:      event.UserID,
+			Type:         users.NotificationFavorite,
+			ArticleSlug:  articleModel.Slug,
+			ArticleTitle: articleModel.Title,
+		})
+	})
+	common.Subscribe("articles.notify-comment", func(meta common.EventMeta, event CommentCreated) error {
+		commentModel, err := findCommentByID(event.CommentID)
+		if err != nil || !commentModel.visible() || commentModel.Article.Hidden {
+			return nil
+		}
+		var parentModel CommentModel
+		if commentModel.ParentID != nil {
+			parentModel, _ = commentModel.Article.findComment(*commentModel.ParentID)
+		}
+		notifyComment(commentModel, parentModel)
+		return nil
+	})
+	common.Subscribe("articles.stream-comment", func(meta common.EventMeta, event CommentCreated) error {
+		return common.Stream.Publish("comment", common.ArticleTopic(event.ArticleID), event.CommentID)
+	})
+	common.Subscribe("articles.webhook-comment-created", func(meta common.EventMeta, event CommentCreated) error {
+		commentModel, err := findCommentByID(event.CommentID)
+		if err != nil || !commentModel.visible() || commentModel.Article.Hidden {
+			return nil
+		}
+		return users.DispatchWebhook(meta.Key, users.WebhookCommentCreated, commentEventResponse(commentModel), commentModel.Article.Author.UserModelID, event.AuthorID)
+	})
+	common.Subscribe("articles.stream-comment-updated", func(meta common.EventMeta, event CommentUpdated) error {
+		return common.Stream.Publish("comment.updated", common.ArticleTopic(event.ArticleID), event.CommentID)
+	})
+	common.Subscribe("articles.webhook-comment-updated", func(meta common.EventMeta, event CommentUpdated) error {
+		commentModel, err := findCommentByID(event.CommentID)
+		if err != nil || !commentModel.visible() || commentModel.Article.Hidden {
+			return nil
+		}
+		return users.DispatchWebhook(meta.Key, users.WebhookCommentUpdated, commentEventResponse(commentModel), commentModel.Article.Author.UserModelID, commentModel.Author.UserModelID)
+	})
+	common.Subscribe("articles.notify-mention", func(meta common.EventMeta, event UserMentioned) error {
+		articleModel, err := findArticleByID(event.ArticleID)
+		if err != nil || articleModel.DeletedAt != nil || articleModel.Hidden {
+			return nil
+		}
+		notification := users.NotificationModel{
+			RecipientID:  event.UserID,
+			ActorID:      event.ActorID,
+			Type:         users.NotificationMention,
+			ArticleSlug:  articleModel.Slug,
+			ArticleTitle: articleModel.Title,
+		}
+		if event.CommentID != nil {
+			commentModel, err := articleModel.findComment(*event.CommentID)
+			if err != nil || !commentModel.visible() {
+				return nil
+			}
+			notification.CommentID = commentModel.ID
+		}
+		return users.Notify(notification)
+	})
+	common.Subscribe("articles.notify-invitation", func(meta common.EventMeta, event CoauthorInvited) error {
+		var invitation ArticleAuthorModel
+		if err := common.GetDB().First(&invitation, event.InvitationID).Error; err != nil || invitation.AcceptedAt != nil {
+			return nil
+		}
+		articleModel, err := findArticleByID(event.ArticleID)
+		if err != nil || articleModel.DeletedAt != nil {
+			return nil
+		}
+		return users.Notify(users.NotificationModel{
+			RecipientID:  event.InviteeID,
+			ActorID:      event.InviterID,
+			Type:         users.NotificationInvitation,
+			ArticleSlug:  articleModel.Slug,
+			ArticleTitle: articleModel.Title,
+		})
+	})
+}
+
+// Tell webhooks about an article, unless readers don't get to see it.
+func dispatchArticleWebhook(meta common.EventMeta, event string, articleID uint) error {
+	articleModel, err := findArticleByID(articleID)
+	if err != nil || articleModel.Hidden {
+		return nil
+	}
+	return users.DispatchWebhook(meta.Key, event, articleEventResponse(articleModel), articleModel.Author.UserModelID)
+}
+
+// Mount it behind users.AuthMiddleware(true)
+func StreamRegister(router *gin.RouterGroup) {
+	router.GET("", StreamEvents)
+}
+
+// Mount it behind users.RequireRole(users.RoleAdmin)
+func TagsAdminRegister(router *gin.RouterGroup) {
+	router.PUT("/:tag", TagRename)
+	router.POST("/:tag/merge", TagMerge)
+	router.DELETE("/unused", TagDeleteUnused)
+}
+
 func ArticleCreate(c *gin.Context) {
 	articleModelValidator := NewArticleModelValidator()
 	if err := articleModelValidator.Bind(c); err != nil {
@@ -36,12 +256,32 @@ func ArticleCreate(c *gin.Context) {
 		return
 	}
 	//fmt.Println(articleModelValidator.articleModel.Author.UserModel)
+	verdict := articleModelValidator.Filter()
+	if verdict.Action == common.VerdictReject {
+		c.JSON(http.StatusUnprocessableEntity, common.NewVerdictError(verdict))
+		return
+	}
 
-	if err := SaveOne(&articleModelValidator.articleModel); err != nil {
+	// Quarantined content is hidden as it's saved, so its events are never seen by readers
+	articleModelValidator.articleModel.Hidden = !verdict.Allowed()
+	if err := createArticle(&articleModelValidator.articleModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	_, _, err := saveMentions(articleModelValidator.articleModel.ID, nil, articleModelValidator.articleModel.Body, articleModelValidator.articleModel.Author.UserModelID)
+	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
 		return
 	}
 	serializer := ArticleSerializer{c, articleModelValidator.articleModel}
+	if !verdict.Allowed() {
+		if err := quarantine(articleModelValidator.articleModel.ID, nil, verdict); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"article": serializer.Response(), "verdict": verdict})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"article": serializer.Response()})
 }
 
@@ -52,7 +292,18 @@ func ArticleList(c *gin.Context) {
 	favorited := c.Query("favorited")
 	limit := c.Query("limit")
 	offset := c.Query("offset")
-	articleModels, modelCount, err := FindManyArticle(tag, author, limit, offset, favorited)
+	list := c.Query("list")
+	// Reading lists are private, the lists of others are as good as missing
+	if list != "" {
+		reader := GetArticleUserModel(c.MustGet("my_user_model").(users.UserModel))
+		listModel, err := reader.findReadingList(list)
+		if err != nil {
+			c.JSON(http.StatusNotFound, common.NewError("list", errors.New("Invalid list")))
+			return
+		}
+		list = strconv.Itoa(int(listModel.ID))
+	}
+	articleModels, modelCount, err := FindManyArticle(tag, author, limit, offset, favorited, list)
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid param")))
 		return
@@ -70,7 +321,8 @@ func ArticleFeed(c *gin.Context) {
 		return
 	}
 	articleUserModel := GetArticleUserModel(myUserModel)
-	articleModels, modelCount, err := articleUserModel.GetArticleFeed(limit, offset)
+	includeTags := c.Query("include") == "tags"
+	articleModels, modelCount, err := articleUserModel.GetArticleFeed(limit, offset, includeTags)
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid param")))
 		return
@@ -85,8 +337,22 @@ func ArticleRetrieve(c *gin.Context) {
 		ArticleFeed(c)
 		return
 	}
+	if slug == "feed.rss" || slug == "feed.atom" {
+		ArticleSyndication(c)
+		return
+	}
 	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
 	if err != nil {
+		// An old slug answers with a redirect hint to the current one
+		if currentSlug, err := FindCurrentSlug(slug); err == nil {
+			c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, slug)+currentSlug)
+			c.JSON(http.StatusMovedPermanently, gin.H{"redirect": gin.H{"slug": currentSlug}})
+			return
+		}
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	if !articleModel.visibleTo(c.MustGet("my_user_model").(users.UserModel)) {
 		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
 		return
 	}
@@ -94,6 +360,7 @@ func ArticleRetrieve(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
 }
 
+// The owner and the co-authors edit an article.
 func ArticleUpdate(c *gin.Context) {
 	slug := c.Param("slug")
 	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
@@ -101,24 +368,65 @@ func ArticleUpdate(c *gin.Context) {
 		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
 		return
 	}
+	if !articleModel.hasAuthor(c.MustGet("my_user_model").(users.UserModel)) {
+		c.JSON(http.StatusForbidden, common.NewError("articles", errors.New("Only the authors can edit the article")))
+		return
+	}
 	articleModelValidator := NewArticleModelValidatorFillWith(articleModel)
 	if err := articleModelValidator.Bind(c); err != nil {
 		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
 		return
 	}
+	verdict := articleModelValidator.Filter()
+	if verdict.Action == common.VerdictReject {
+		c.JSON(http.StatusUnprocessableEntity, common.NewVerdictError(verdict))
+		return
+	}
 
-	articleModelValidator.articleModel.ID = articleModel.ID
-	if err := articleModel.Update(articleModelValidator.articleModel); err != nil {
+	oldSlug := articleModel.Slug
+	if !verdict.Allowed() {
+		articleModelValidator.articleModel.Hidden = true
+	}
+	if err := articleModel.edit(articleModelValidator.articleModel, articleModelValidator.editor); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	if articleModel.Slug != oldSlug {
+		if err := articleModel.keepSlugHistory(oldSlug); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+	}
+	_, _, err = saveMentions(articleModel.ID, nil, articleModel.Body, articleModelValidator.editor.UserModelID)
+	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
 		return
 	}
 	serializer := ArticleSerializer{c, articleModel}
+	if !verdict.Allowed() {
+		if err := quarantine(articleModel.ID, nil, verdict); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"article": serializer.Response(), "verdict": verdict})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
 }
 
+// Only the owner deletes an article, co-authors can leave it instead.
 func ArticleDelete(c *gin.Context) {
 	slug := c.Param("slug")
-	err := DeleteArticleModel(&ArticleModel{Slug: slug})
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	if articleModel.Author.UserModelID != c.MustGet("my_user_model").(users.UserModel).ID {
+		c.JSON(http.StatusForbidden, common.NewError("articles", errors.New("Only the owner can delete the article")))
+		return
+	}
+	err = DeleteArticleModel(&ArticleModel{Slug: slug})
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
 		return
@@ -135,6 +443,10 @@ func ArticleFavorite(c *gin.Context) {
 	}
 	myUserModel := c.MustGet("my_user_model").(users.UserModel)
 	err = articleModel.favoriteBy(GetArticleUserModel(myUserModel))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
 	serializer := ArticleSerializer{c, articleModel}
 	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
 }
@@ -153,10 +465,8 @@ func ArticleUnfavorite(c *gin.Context) {
 }
 
 func ArticleCommentCreate(c *gin.Context) {
-	slug := c.Param("slug")
-	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
-	if err != nil {
-		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid slug")))
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
 		return
 	}
 	commentModelValidator := NewCommentModelValidator()
@@ -165,23 +475,181 @@ func ArticleCommentCreate(c *gin.Context) {
 		return
 	}
 	commentModelValidator.commentModel.Article = articleModel
+	var parentModel CommentModel
+	if parentID := commentModelValidator.Comment.ParentID; parentID != nil {
+		var err error
+		parentModel, err = articleModel.findComment(*parentID)
+		// A hidden comment reads as a tombstone, so it takes no replies either
+		if err != nil || !parentModel.visible() {
+			c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid parent id")))
+			return
+		}
+		if err := commentModelValidator.commentModel.setParent(parentModel); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("comment", err))
+			return
+		}
+	}
+	verdict := commentModelValidator.Filter()
+	if verdict.Action == common.VerdictReject {
+		c.JSON(http.StatusUnprocessableEntity, common.NewVerdictError(verdict))
+		return
+	}
 
-	if err := SaveOne(&commentModelValidator.commentModel); err != nil {
+	commentModelValidator.commentModel.Hidden = !verdict.Allowed()
+	if err := createComment(&commentModelValidator.commentModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	mentions, _, err := saveMentions(articleModel.ID, &commentModelValidator.commentModel.ID, commentModelValidator.commentModel.Body, commentModelValidator.commentModel.Author.UserModelID)
+	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
 		return
 	}
+	commentModelValidator.commentModel.Mentions = mentions
+	// The author gets the comment back as written, readers only get to see it once a moderator let it through
+	commentModelValidator.commentModel.Hidden = false
 	serializer := CommentSerializer{c, commentModelValidator.commentModel}
+	if !verdict.Allowed() {
+		if err := quarantine(articleModel.ID, &commentModelValidator.commentModel.ID, verdict); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"comment": serializer.Response(), "verdict": verdict})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"comment": serializer.Response()})
 }
 
+// Tell the article author about a new comment and, for a reply, the author of the parent comment.
+func notifyComment(commentModel CommentModel, parentModel CommentModel) {
+	notification := users.NotificationModel{
+		ActorID:      commentModel.Author.UserModelID,
+		ArticleSlug:  commentModel.Article.Slug,
+		ArticleTitle: commentModel.Article.Title,
+		CommentID:    commentModel.ID,
+	}
+	if parentModel.ID != 0 {
+		reply := notification
+		reply.RecipientID = parentModel.authorUserID()
+		reply.Type = users.NotificationReply
+		users.Notify(reply)
+		if reply.RecipientID == commentModel.Article.Author.UserModelID {
+			return
+		}
+	}
+	notification.RecipientID = commentModel.Article.Author.UserModelID
+	notification.Type = users.NotificationComment
+	users.Notify(notification)
+}
+
+func ArticleCommentUpdate(c *gin.Context) {
+	slug := c.Param("slug")
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid slug")))
+		return
+	}
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
+		return
+	}
+	commentModel, err := articleModel.findComment(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	articleUserModel := GetArticleUserModel(myUserModel)
+	if commentModel.AuthorID != articleUserModel.ID {
+		c.JSON(http.StatusForbidden, common.NewError("comment", errors.New("Only the author can edit a comment")))
+		return
+	}
+	commentModelValidator := NewCommentModelValidatorFillWith(commentModel)
+	if err := commentModelValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	verdict := commentModelValidator.Filter()
+	if verdict.Action == common.VerdictReject {
+		c.JSON(http.StatusUnprocessableEntity, common.NewVerdictError(verdict))
+		return
+	}
+	if err := commentModel.edit(commentModelValidator.Comment.Body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	// Quarantine before the mentions get saved, so they don't notify anyone
+	if !verdict.Allowed() {
+		if err := quarantine(articleModel.ID, &commentModel.ID, verdict); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+	}
+	mentions, _, err := saveMentions(articleModel.ID, &commentModel.ID, commentModel.Body, myUserModel.ID)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	commentModel.Author = articleUserModel
+	commentModel.Mentions = mentions
+	serializer := CommentSerializer{c, commentModel}
+	if !verdict.Allowed() {
+		c.JSON(http.StatusAccepted, gin.H{"comment": serializer.Response(), "verdict": verdict})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comment": serializer.Response()})
+}
+
+func ArticleCommentEditList(c *gin.Context) {
+	slug := c.Param("slug")
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid slug")))
+		return
+	}
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
+		return
+	}
+	commentModel, err := articleModel.findComment(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
+		return
+	}
+	editModels, err := commentModel.getEdits()
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Database error")))
+		return
+	}
+	serializer := CommentEditsSerializer{c, editModels}
+	c.JSON(http.StatusOK, gin.H{"edits": serializer.Response()})
+}
+
+// A comment can be deleted by its author, the authors of the article and moderators.
 func ArticleCommentDelete(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
 	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	id := uint(id64)
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
 		return
 	}
-	err = DeleteCommentModel([]uint{id})
+	commentModel, err := articleModel.findComment(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if commentModel.AuthorID != GetArticleUserModel(myUserModel).ID && !articleModel.hasAuthor(myUserModel) &&
+		!myUserModel.HasRole(users.RoleModerator) {
+		c.JSON(http.StatusForbidden, common.NewError("comment", errors.New("Only the author can delete a comment")))
+		return
+	}
+	err = DeleteCommentModel([]uint{commentModel.ID})
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
 		return
@@ -192,24 +660,1351 @@ func ArticleCommentDelete(c *gin.Context) {
 func ArticleCommentList(c *gin.Context) {
 	slug := c.Param("slug")
 	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
-	if err != nil {
+	if err != nil || !articleModel.visibleTo(c.MustGet("my_user_model").(users.UserModel)) {
 		c.JSON(http.StatusNotFound, common.NewError("comments", errors.New("Invalid slug")))
 		return
 	}
-	err = articleModel.getComments()
+	query := CommentQuery{Sort: c.Query("sort"), Tree: c.Query("view") == "tree"}
+	if query.Limit, err = strconv.Atoi(c.Query("limit")); err != nil || query.Limit <= 0 {
+		query.Limit = 20
+	}
+	if query.Offset, err = strconv.Atoi(c.Query("offset")); err != nil || query.Offset < 0 {
+		query.Offset = 0
+	}
+	count, err := articleModel.findComments(query)
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("comments", errors.New("Database error")))
 		return
 	}
 	serializer := CommentsSerializer{c, articleModel.Comments}
-	c.JSON(http.StatusOK, gin.H{"comments": serializer.Response()})
+	if query.Tree {
+		c.JSON(http.StatusOK, gin.H{"comments": serializer.TreeResponse(), "commentsCount": count})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comments": serializer.Response(), "commentsCount": count})
 }
+
+// ?sort=popular orders by usage instead of name, ?limit= caps the number of tags
 func TagList(c *gin.Context) {
-	tagModels, err := getAllTags()
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil {
+		limit = 0
+	}
+	tagCounts, err := FindTagCounts(c.Query("sort"), limit)
 	if err != nil {
 		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid param")))
 		return
 	}
+	serializer := TagCountsSerializer{c, tagCounts}
+	c.JSON(http.StatusOK, gin.H{"tags": serializer.TagsResponse(), "tagCounts": serializer.Response()})
+}
+
+func TagFollow(c *gin.Context) {
+	tagModel, err := FindOneTag(c.Param("tag"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("tag", errors.New("Invalid tag")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if err := tagModel.followedBy(GetArticleUserModel(myUserModel)); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := TagFollowSerializer{c, tagModel}
+	c.JSON(http.StatusOK, gin.H{"tag": serializer.Response()})
+}
+
+func TagUnfollow(c *gin.Context) {
+	tagModel, err := FindOneTag(c.Param("tag"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("tag", errors.New("Invalid tag")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if err := tagModel.unFollowedBy(GetArticleUserModel(myUserModel)); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := TagFollowSerializer{c, tagModel}
+	c.JSON(http.StatusOK, gin.H{"tag": serializer.Response()})
+}
+
+func UserTagList(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	tagModels, err := GetArticleUserModel(myUserModel).GetFollowedTags()
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("tags", errors.New("Database error")))
+		return
+	}
 	serializer := TagsSerializer{c, tagModels}
 	c.JSON(http.StatusOK, gin.H{"tags": serializer.Response()})
 }
+
+func TagRename(c *gin.Context) {
+	tagModel, err := FindOneTag(c.Param("tag"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("tag", errors.New("Invalid tag")))
+		return
+	}
+	tagRenameValidator := NewTagRenameValidator()
+	if err := tagRenameValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	tagModel, err = RenameTag(tagModel, tagRenameValidator.Tag.Name)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("tag", err))
+		return
+	}
+	serializer := TagSerializer{c, tagModel}
+	c.JSON(http.StatusOK, gin.H{"tag": serializer.Response()})
+}
+
+func TagMerge(c *gin.Context) {
+	fromModel, err := FindOneTag(c.Param("tag"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("tag", errors.New("Invalid tag")))
+		return
+	}
+	tagMergeValidator := NewTagMergeValidator()
+	if err := tagMergeValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	intoModel, err := FindOneTag(tagMergeValidator.Tag.Into)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("tag", errors.New("Invalid tag to merge into")))
+		return
+	}
+	if err := MergeTags(fromModel, intoModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("tag", err))
+		return
+	}
+	serializer := TagSerializer{c, intoModel}
+	c.JSON(http.StatusOK, gin.H{"tag": serializer.Response()})
+}
+
+func TagDeleteUnused(c *gin.Context) {
+	deleted, err := DeleteUnusedTags()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deletedCount": deleted})
+}
+
+func ArticleRevisionList(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	revisionModels, err := articleModel.getRevisions()
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("revisions", errors.New("Database error")))
+		return
+	}
+	serializer := RevisionsSerializer{c, revisionModels}
+	c.JSON(http.StatusOK, gin.H{"revisions": serializer.Response(), "revisionsCount": len(revisionModels)})
+}
+
+func ArticleRevisionRetrieve(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	revisionModel, err := findRevisionParam(c, articleModel, c.Param("n"))
+	if err != nil {
+		return
+	}
+	serializer := RevisionSerializer{c, revisionModel}
+	c.JSON(http.StatusOK, gin.H{"revision": serializer.Response()})
+}
+
+// Diff revision :n against ?from=m, the previous revision is used when from is not given.
+func ArticleRevisionDiff(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	toModel, err := findRevisionParam(c, articleModel, c.Param("n"))
+	if err != nil {
+		return
+	}
+	from := c.Query("from")
+	if from == "" {
+		from = strconv.FormatUint(uint64(toModel.Number-1), 10)
+	}
+	var fromModel ArticleRevisionModel
+	if from != "0" {
+		fromModel, err = findRevisionParam(c, articleModel, from)
+		if err != nil {
+			return
+		}
+	}
+	serializer := RevisionDiffSerializer{c, fromModel, toModel}
+	response, err := serializer.Response()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("diff", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"diff": response})
+}
+
+func ArticleRevisionRestore(c *gin.Context) {
+	slug := c.Param("slug")
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("revision", errors.New("Invalid slug")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if !articleModel.hasAuthor(myUserModel) {
+		c.JSON(http.StatusForbidden, common.NewError("revision", errors.New("Only the authors can restore a revision")))
+		return
+	}
+	revisionModel, err := findRevisionParam(c, articleModel, c.Param("n"))
+	if err != nil {
+		return
+	}
+	// Old content goes through the filters as they are now, like an edit would
+	editor := GetArticleUserModel(myUserModel)
+	verdict := filterContent(common.Content{
+		Kind:     "article",
+		ID:       articleModel.ID,
+		Text:     articleText(revisionModel.Title, revisionModel.Description, revisionModel.Body),
+		AuthorID: editor.ID,
+	}, myUserModel)
+	if verdict.Action == common.VerdictReject {
+		c.JSON(http.StatusUnprocessableEntity, common.NewVerdictError(verdict))
+		return
+	}
+	if _, err := articleModel.restoreRevision(revisionModel, editor, !verdict.Allowed()); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	if _, _, err := saveMentions(articleModel.ID, nil, articleModel.Body, myUserModel.ID); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ArticleSerializer{c, articleModel}
+	if !verdict.Allowed() {
+		if err := quarantine(articleModel.ID, nil, verdict); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"article": serializer.Response(), "verdict": verdict})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
+}
+
+// Look up the revision numbered by param, writing the 404 response itself when it can't be found.
+func findRevisionParam(c *gin.Context, articleModel ArticleModel, param string) (ArticleRevisionModel, error) {
+	number, err := strconv.ParseUint(param, 10, 32)
+	if err == nil {
+		var revisionModel ArticleRevisionModel
+		revisionModel, err = articleModel.getRevision(uint(number))
+		if err == nil {
+			return revisionModel, nil
+		}
+	}
+	c.JSON(http.StatusNotFound, common.NewError("revision", errors.New("Invalid revision number")))
+	return ArticleRevisionModel{}, err
+}
+
+func UserTrash(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	articleUserModel := GetArticleUserModel(myUserModel)
+	articleModels, err := FindDeletedArticles(articleUserModel)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("trash", errors.New("Database error")))
+		return
+	}
+	commentModels, err := FindDeletedComments(articleUserModel)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("trash", errors.New("Database error")))
+		return
+	}
+	serializer := TrashSerializer{c, articleModels, commentModels}
+	c.JSON(http.StatusOK, gin.H{"trash": serializer.Response()})
+}
+
+func TrashArticleRestore(c *gin.Context) {
+	slug := c.Param("slug")
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	articleModel, err := FindDeletedArticle(GetArticleUserModel(myUserModel), slug)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("trash", errors.New("Invalid slug")))
+		return
+	}
+	if err := RestoreArticleModel(articleModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	articleModel, err = FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("trash", errors.New("Invalid slug")))
+		return
+	}
+	serializer := ArticleSerializer{c, articleModel}
+	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
+}
+
+func TrashCommentRestore(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("trash", errors.New("Invalid id")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	articleUserModel := GetArticleUserModel(myUserModel)
+	commentModel, err := FindDeletedComment(articleUserModel, uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("trash", errors.New("Invalid id")))
+		return
+	}
+	if err := RestoreCommentModel(commentModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	commentModel.DeletedAt = nil
+	commentModel.Author = articleUserModel
+	serializer := CommentSerializer{c, commentModel}
+	c.JSON(http.StatusOK, gin.H{"comment": serializer.Response()})
+}
+
+func ArticleReport(c *gin.Context) {
+	slug := c.Param("slug")
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil || !articleModel.visibleTo(c.MustGet("my_user_model").(users.UserModel)) {
+		c.JSON(http.StatusNotFound, common.NewError("report", errors.New("Invalid slug")))
+		return
+	}
+	reportValidator := NewReportValidator()
+	if err := reportValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	reportValidator.reportModel.ArticleID = articleModel.ID
+	saveReport(c, reportValidator.reportModel)
+}
+
+func ArticleCommentReport(c *gin.Context) {
+	slug := c.Param("slug")
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil || !articleModel.visibleTo(c.MustGet("my_user_model").(users.UserModel)) {
+		c.JSON(http.StatusNotFound, common.NewError("report", errors.New("Invalid slug")))
+		return
+	}
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("report", errors.New("Invalid id")))
+		return
+	}
+	commentModel, err := articleModel.findComment(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("report", errors.New("Invalid id")))
+		return
+	}
+	reportValidator := NewReportValidator()
+	if err := reportValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	reportValidator.reportModel.ArticleID = articleModel.ID
+	reportValidator.reportModel.CommentID = &commentModel.ID
+	saveReport(c, reportValidator.reportModel)
+}
+
+func saveReport(c *gin.Context, reportModel ReportModel) {
+	if err := createReport(&reportModel); err == errAlreadyReported {
+		c.JSON(http.StatusConflict, common.NewError("report", err))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ReportSerializer{c, reportModel}
+	c.JSON(http.StatusCreated, gin.H{"report": serializer.Response()})
+}
+
+// The open reports, oldest first, paged with ?limit= and ?offset=
+func ReportList(c *gin.Context) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	reportModels, reportsCounts, count, err := FindOpenReports(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("reports", errors.New("Invalid param")))
+		return
+	}
+	serializer := ReportQueueSerializer{c, reportModels, reportsCounts}
+	c.JSON(http.StatusOK, gin.H{"reports": serializer.Response(), "reportsCount": count})
+}
+
+func ReportResolve(c *gin.Context) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("report", errors.New("Invalid id")))
+		return
+	}
+	reportModel, err := FindOneReport(uint(id64))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("report", errors.New("Invalid id")))
+		return
+	}
+	if reportModel.Status != ReportOpen {
+		c.JSON(http.StatusConflict, common.NewError("report", errors.New("Report is already closed")))
+		return
+	}
+	resolveValidator := NewReportResolveValidator()
+	if err := resolveValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	suspendFor := time.Duration(resolveValidator.Resolution.SuspendDays) * 24 * time.Hour
+	if err := reportModel.resolve(resolveValidator.Resolution.Actions, GetArticleUserModel(myUserModel), suspendFor); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("report", err))
+		return
+	}
+	serializer := ReportSerializer{c, reportModel}
+	c.JSON(http.StatusOK, gin.H{"report": serializer.Response()})
+}
+
+// How often an idle stream gets a comment line, so proxies in between don't time it out.
+var StreamHeartbeat = common.GetEnvDuration("STREAM_HEARTBEAT", 25*time.Second)
+
+// The most articles a single stream can follow the comments of.
+const streamMaxArticles = 50
+
+// Server-Sent Events about the comments on the articles named by ?articles=slug-a,slug-b, new articles by
+// the authors the user follows and the user's notifications. The topics are fixed when the stream opens,
+// a client following somebody new reconnects. A client which falls behind gets a "lagged" event and the
+// stream ends, it's expected to reconnect and catch up through the regular endpoints.
+func StreamEvents(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	topics := []string{common.UserTopic(myUserModel.ID)}
+	for _, following := range myUserModel.GetFollowings() {
+		topics = append(topics, common.AuthorTopic(following.ID))
+	}
+	slugs := []string{}
+	if articles := c.Query("articles"); articles != "" {
+		slugs = strings.Split(articles, ",")
+	}
+	if len(slugs) > streamMaxArticles {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("articles", fmt.Errorf("Can not follow more than %d articles", streamMaxArticles)))
+		return
+	}
+	for _, slug := range slugs {
+		articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+		if err != nil || !articleModel.visibleTo(myUserModel) {
+			c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+			return
+		}
+		topics = append(topics, common.ArticleTopic(articleModel.ID))
+	}
+
+	subscription := common.Stream.Subscribe(topics...)
+	defer subscription.Close()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	writeStreamEvent(c, 0, "ready", gin.H{"articles": slugs})
+
+	heartbeat := time.NewTicker(StreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				if subscription.Lagged() {
+					writeStreamEvent(c, 0, "lagged", gin.H{"message": "Too many events were waiting, reconnect to catch up"})
+				}
+				return
+			}
+			if data := streamEventData(c, myUserModel, event); data != nil {
+				writeStreamEvent(c, event.ID, event.Type, data)
+			}
+		}
+	}
+}
+
+// Load what an event is about the way the subscriber gets to see it, nil when it's gone or hidden from them.
+func streamEventData(c *gin.Context, myUserModel users.UserModel, event common.Event) interface{} {
+	switch event.Type {
+	case "comment", "comment.updated":
+		commentModel, err := findCommentByID(event.Ref)
+		if err != nil || !commentModel.visible() || !commentModel.Article.visibleTo(myUserModel) {
+			return nil
+		}
+		serializer := CommentSerializer{c, commentModel}
+		return gin.H{"article": gin.H{"slug": commentModel.Article.Slug}, "comment": serializer.Response()}
+	case "article":
+		var articleModel ArticleModel
+		articleModel.ID = event.Ref
+		articleModel, err := FindOneArticle(&articleModel)
+		if err != nil || !articleModel.visibleTo(myUserModel) {
+			return nil
+		}
+		serializer := ArticleSerializer{c, articleModel}
+		return gin.H{"article": serializer.Response()}
+	case "notification":
+		notificationModel, err := myUserModel.FindNotification(event.Ref)
+		if err != nil {
+			return nil
+		}
+		serializer := users.NotificationSerializer{C: c, NotificationModel: notificationModel}
+		return gin.H{"notification": serializer.Response()}
+	}
+	return nil
+}
+
+func writeStreamEvent(c *gin.Context, id uint64, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != 0 {
+		fmt.Fprintf(c.Writer, "id: %v\n", id)
+	}
+	fmt.Fprintf(c.Writer, "event: %v\ndata: %s\n\n", eventType, payload)
+	c.Writer.Flush()
+}
+
+func UserDigestRetrieve(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	subscriber := GetArticleUserModel(myUserModel)
+	serializer := DigestSerializer{c, subscriber.getDigest()}
+	c.JSON(http.StatusOK, gin.H{"digest": serializer.Response()})
+}
+
+func UserDigestUpdate(c *gin.Context) {
+	digestValidator := NewDigestValidator()
+	if err := digestValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	subscriber := GetArticleUserModel(myUserModel)
+	subscription, err := subscriber.setDigest(digestValidator.Digest.Frequency)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := DigestSerializer{c, subscription}
+	c.JSON(http.StatusOK, gin.H{"digest": serializer.Response()})
+}
+
+// The subscriber the token in ?token= was made for, see digestUnsubscribeURL.
+func findDigestSubscriberParam(c *gin.Context) (ArticleUserModel, bool) {
+	var subscriber ArticleUserModel
+	subject, err := common.VerifyToken(digestUnsubscribe, c.Query("token"))
+	id, parseErr := strconv.ParseUint(subject, 10, 32)
+	if err != nil || parseErr != nil {
+		c.JSON(http.StatusNotFound, common.NewError("token", errors.New("Invalid token")))
+		return subscriber, false
+	}
+	subscriber.ID = uint(id)
+	return subscriber, true
+}
+
+// A page with a button which POSTs back to the same link.
+func DigestUnsubscribeConfirm(c *gin.Context) {
+	if _, ok := findDigestSubscriberParam(c); !ok {
+		return
+	}
+	page, err := unsubscribePage(c.Request.URL.RequestURI(), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("page", err))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// Turn the digest off for whoever the token in ?token= was made for. Mail clients POST here for
+// one-click unsubscribing, see RFC 8058, browsers coming from the confirmation page get a page back.
+func DigestUnsubscribe(c *gin.Context) {
+	subscriber, ok := findDigestSubscriberParam(c)
+	if !ok {
+		return
+	}
+	subscription := subscriber.getDigest()
+	if subscription.ID != 0 && subscription.Frequency != DigestOff {
+		var err error
+		if subscription, err = subscriber.setDigest(DigestOff); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+	}
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		page, err := unsubscribePage(c.Request.URL.RequestURI(), true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.NewError("page", err))
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+		return
+	}
+	serializer := DigestSerializer{c, subscription}
+	c.JSON(http.StatusOK, gin.H{"digest": serializer.Response()})
+}
+
+// The article list as RSS or Atom, by ?tag=, ?author= or ?favorited= like ArticleList. With ?token=
+// it's the private feed of the user the feed token belongs to, like ArticleFeed.
+func ArticleSyndication(c *gin.Context) {
+	limit := c.Query("limit")
+	offset := c.Query("offset")
+	serializer := SyndicationSerializer{C: c, Title: "Conduit", Link: common.AppURL + "/"}
+	var err error
+	if token := c.Query("token"); token != "" {
+		subscriber, findErr := FindFeedTokenUser(token)
+		if findErr != nil {
+			c.JSON(http.StatusNotFound, common.NewError("token", errors.New("Invalid token")))
+			return
+		}
+		serializer.Title = "Conduit: " + subscriber.UserModel.Username + "'s feed"
+		serializer.Articles, _, err = subscriber.GetArticleFeed(limit, offset, c.Query("include") == "tags")
+	} else {
+		tag := c.Query("tag")
+		author := c.Query("author")
+		favorited := c.Query("favorited")
+		switch {
+		case tag != "":
+			serializer.Title = "Conduit: #" + tag
+		case author != "":
+			serializer.Title = "Conduit: articles by " + author
+			serializer.Link = common.AppURL + "/profile/" + url.PathEscape(author)
+		case favorited != "":
+			serializer.Title = "Conduit: favorited by " + favorited
+			serializer.Link = common.AppURL + "/profile/" + url.PathEscape(favorited) + "/favorites"
+		}
+		serializer.Articles, _, err = FindManyArticle(tag, author, limit, offset, favorited, "")
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid param")))
+		return
+	}
+
+	body, contentType := []byte(nil), "application/rss+xml; charset=utf-8"
+	if c.Param("slug") == "feed.atom" {
+		body, err = serializer.Atom()
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		body, err = serializer.RSS()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("feed", err))
+		return
+	}
+	common.ServeCached(c, contentType, body, serializer.LastModified())
+}
+
+func FeedTokenRetrieve(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	subscriber := GetArticleUserModel(myUserModel)
+	feedToken, err := subscriber.getFeedToken()
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("feedToken", errors.New("No feed token yet")))
+		return
+	}
+	serializer := FeedTokenSerializer{c, feedToken}
+	c.JSON(http.StatusOK, gin.H{"feedToken": serializer.Response()})
+}
+
+// Create the feed token, or replace it so that the old feed URLs stop working.
+func FeedTokenReset(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	subscriber := GetArticleUserModel(myUserModel)
+	feedToken, err := subscriber.resetFeedToken()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := FeedTokenSerializer{c, feedToken}
+	c.JSON(http.StatusCreated, gin.H{"feedToken": serializer.Response()})
+}
+
+func FeedTokenRevoke(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	subscriber := GetArticleUserModel(myUserModel)
+	if err := subscriber.revokeFeedToken(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feedToken": "Delete success"})
+}
+
+func ArticleMeta(c *gin.Context) {
+	slug := c.Param("slug")
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: slug})
+	if err != nil {
+		if currentSlug, err := FindCurrentSlug(slug); err == nil {
+			c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, slug+"/meta")+currentSlug+"/meta")
+			c.JSON(http.StatusMovedPermanently, gin.H{"redirect": gin.H{"slug": currentSlug}})
+			return
+		}
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	// Previews are public, so hidden articles get none even for their author
+	if articleModel.Hidden {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	serializer := ArticleMetaSerializer{c, articleModel}
+	c.JSON(http.StatusOK, gin.H{"meta": serializer.Response()})
+}
+
+// The sitemap, or the index of its pages once it has more than SitemapMaxURLs urls.
+func Sitemap(c *gin.Context) {
+	count, lastModified, err := CountSitemapEntries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("database", err))
+		return
+	}
+	var body []byte
+	if count > SitemapMaxURLs {
+		serializer := SitemapIndexSerializer{C: c, Pages: (count + SitemapMaxURLs - 1) / SitemapMaxURLs, LastModified: lastModified}
+		body, err = serializer.Response()
+	} else {
+		body, err = renderSitemapPage(c, 1)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("sitemap", err))
+		return
+	}
+	common.ServeCached(c, "application/xml; charset=utf-8", body, lastModified)
+}
+
+// A page of the sitemap index, /sitemaps/1.xml is the first.
+func SitemapPage(c *gin.Context) {
+	page, err := strconv.Atoi(strings.TrimSuffix(c.Param("page"), ".xml"))
+	count, lastModified, countErr := CountSitemapEntries()
+	if err != nil || countErr != nil || page < 1 || (page-1)*SitemapMaxURLs >= count {
+		c.JSON(http.StatusNotFound, common.NewError("sitemap", errors.New("Invalid page")))
+		return
+	}
+	body, err := renderSitemapPage(c, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("sitemap", err))
+		return
+	}
+	common.ServeCached(c, "application/xml; charset=utf-8", body, lastModified)
+}
+
+func renderSitemapPage(c *gin.Context, page int) ([]byte, error) {
+	entries, err := FindSitemapEntries((page-1)*SitemapMaxURLs, SitemapMaxURLs)
+	if err != nil {
+		return nil, err
+	}
+	serializer := SitemapSerializer{C: c, Entries: entries}
+	return serializer.Response()
+}
+
+// The article of the :slug param if the current user may see it, answering with 404 otherwise.
+func findVisibleArticleParam(c *gin.Context) (ArticleModel, bool) {
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: c.Param("slug")})
+	if err != nil || !articleModel.visibleTo(c.MustGet("my_user_model").(users.UserModel)) {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return articleModel, false
+	}
+	return articleModel, true
+}
+
+// Only the authors add and remove the images of an article.
+func findOwnArticleParam(c *gin.Context) (ArticleModel, bool) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return articleModel, false
+	}
+	if !articleModel.hasAuthor(c.MustGet("my_user_model").(users.UserModel)) {
+		c.JSON(http.StatusForbidden, common.NewError("articles", errors.New("Only the authors can change the images")))
+		return articleModel, false
+	}
+	return articleModel, true
+}
+
+func findImageParam(c *gin.Context, articleModel ArticleModel) (ArticleImageModel, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err == nil {
+		if imageModel, err := articleModel.findImage(uint(id)); err == nil {
+			return imageModel, true
+		}
+	}
+	c.JSON(http.StatusNotFound, common.NewError("image", errors.New("Invalid id")))
+	return ArticleImageModel{}, false
+}
+
+// Upload an image as the "image" field of a multipart form, it's scaled down and gets a thumbnail.
+func ArticleImageUpload(c *gin.Context) {
+	articleModel, ok := findOwnArticleParam(c)
+	if !ok {
+		return
+	}
+	img, contentType, err := common.ReadImageUpload(c, "image")
+	if err != nil {
+		c.JSON(common.UploadErrorStatus(err), common.NewError("image", err))
+		return
+	}
+	imageModel, err := articleModel.addImage(img, contentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("storage", err))
+		return
+	}
+	serializer := ArticleImageSerializer{c, imageModel}
+	c.JSON(http.StatusCreated, gin.H{"image": serializer.Response()})
+}
+
+func ArticleImageList(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	imageModels, err := articleModel.getImages()
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("images", errors.New("Database error")))
+		return
+	}
+	serializer := ArticleImagesSerializer{c, imageModels}
+	c.JSON(http.StatusOK, gin.H{"images": serializer.Response()})
+}
+
+// Redirect to a signed URL of the image, or of its thumbnail with ?size=thumbnail.
+func ArticleImageRetrieve(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	imageModel, ok := findImageParam(c, articleModel)
+	if !ok {
+		return
+	}
+	key := imageModel.Key
+	if c.Query("size") == "thumbnail" {
+		key = imageModel.ThumbnailKey
+	}
+	link := common.MediaURL(key)
+	if link == nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("storage", errors.New("Image unavailable")))
+		return
+	}
+	c.Redirect(http.StatusFound, *link)
+}
+
+func ArticleImageDelete(c *gin.Context) {
+	articleModel, ok := findOwnArticleParam(c)
+	if !ok {
+		return
+	}
+	imageModel, ok := findImageParam(c, articleModel)
+	if !ok {
+		return
+	}
+	if err := imageModel.delete(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"image": "Delete success"})
+}
+
+// The reading list of the current user in the :id param, answering 404 if there is none.
+func findReadingListParam(c *gin.Context) (ReadingListModel, bool) {
+	owner := GetArticleUserModel(c.MustGet("my_user_model").(users.UserModel))
+	listModel, err := owner.findReadingList(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("list", errors.New("Invalid id")))
+		return listModel, false
+	}
+	return listModel, true
+}
+
+func readingListError(c *gin.Context, err error) {
+	if err == errReadingListName {
+		c.JSON(http.StatusConflict, common.NewError("name", err))
+		return
+	}
+	c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+}
+
+func ReadingListList(c *gin.Context) {
+	owner := GetArticleUserModel(c.MustGet("my_user_model").(users.UserModel))
+	listModels, err := owner.getReadingLists()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ReadingListsSerializer{c, listModels}
+	c.JSON(http.StatusOK, gin.H{"lists": serializer.Response()})
+}
+
+func ReadingListCreate(c *gin.Context) {
+	readingListValidator := NewReadingListValidator()
+	if err := readingListValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	owner := GetArticleUserModel(c.MustGet("my_user_model").(users.UserModel))
+	listModel, err := owner.createReadingList(readingListValidator.List.Name)
+	if err != nil {
+		readingListError(c, err)
+		return
+	}
+	serializer := ReadingListSerializer{c, listModel}
+	c.JSON(http.StatusCreated, gin.H{"list": serializer.Response()})
+}
+
+// The articles of a list are read through /api/articles?list=:id
+func ReadingListRetrieve(c *gin.Context) {
+	listModel, ok := findReadingListParam(c)
+	if !ok {
+		return
+	}
+	serializer := ReadingListSerializer{c, listModel}
+	c.JSON(http.StatusOK, gin.H{"list": serializer.Response()})
+}
+
+func ReadingListUpdate(c *gin.Context) {
+	listModel, ok := findReadingListParam(c)
+	if !ok {
+		return
+	}
+	readingListValidator := NewReadingListValidator()
+	if err := readingListValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := listModel.rename(readingListValidator.List.Name); err != nil {
+		readingListError(c, err)
+		return
+	}
+	serializer := ReadingListSerializer{c, listModel}
+	c.JSON(http.StatusOK, gin.H{"list": serializer.Response()})
+}
+
+func ReadingListDelete(c *gin.Context) {
+	listModel, ok := findReadingListParam(c)
+	if !ok {
+		return
+	}
+	if err := listModel.delete(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"list": "Delete success"})
+}
+
+func ReadingListAdd(c *gin.Context) {
+	listModel, ok := findReadingListParam(c)
+	if !ok {
+		return
+	}
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	if err := listModel.addArticle(articleModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	listModel, _ = findReadingListParam(c)
+	serializer := ReadingListSerializer{c, listModel}
+	c.JSON(http.StatusOK, gin.H{"list": serializer.Response()})
+}
+
+// Articles hidden since they were saved can still be taken out.
+func ReadingListRemove(c *gin.Context) {
+	listModel, ok := findReadingListParam(c)
+	if !ok {
+		return
+	}
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: c.Param("slug")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	if err := listModel.removeArticle(articleModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ReadingListSerializer{c, listModel}
+	c.JSON(http.StatusOK, gin.H{"list": serializer.Response()})
+}
+
+func ReadingListReorder(c *gin.Context) {
+	listModel, ok := findReadingListParam(c)
+	if !ok {
+		return
+	}
+	orderValidator := NewArticleOrderValidator()
+	if err := orderValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := listModel.reorder(orderValidator.Articles); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("articles", err))
+		return
+	}
+	listModel, _ = findReadingListParam(c)
+	serializer := ReadingListSerializer{c, listModel}
+	c.JSON(http.StatusOK, gin.H{"list": serializer.Response()})
+}
+
+// The series in the :slug param, answering 404 if there is none.
+func findSeriesParam(c *gin.Context) (SeriesModel, bool) {
+	seriesModel, err := FindOneSeries(&SeriesModel{Slug: c.Param("slug")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("series", errors.New("Invalid slug")))
+		return seriesModel, false
+	}
+	return seriesModel, true
+}
+
+// Only its author changes a series.
+func findOwnSeriesParam(c *gin.Context) (SeriesModel, bool) {
+	seriesModel, ok := findSeriesParam(c)
+	if !ok {
+		return seriesModel, false
+	}
+	if seriesModel.Author.UserModelID != c.MustGet("my_user_model").(users.UserModel).ID {
+		c.JSON(http.StatusForbidden, common.NewError("series", errors.New("Only the author can change the series")))
+		return seriesModel, false
+	}
+	return seriesModel, true
+}
+
+// Respond with the series and the parts the current user gets to read.
+func seriesResponse(c *gin.Context, status int, seriesModel SeriesModel) {
+	articleModels, err := seriesModel.getArticles()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	serializer := SeriesSerializer{c, seriesModel, visibleParts(articleModels, myUserModel)}
+	c.JSON(status, gin.H{"series": serializer.Response()})
+}
+
+func SeriesRetrieve(c *gin.Context) {
+	seriesModel, ok := findSeriesParam(c)
+	if !ok {
+		return
+	}
+	seriesResponse(c, http.StatusOK, seriesModel)
+}
+
+func SeriesCreate(c *gin.Context) {
+	seriesModelValidator := NewSeriesModelValidator()
+	if err := seriesModelValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := SaveOne(&seriesModelValidator.seriesModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	seriesResponse(c, http.StatusCreated, seriesModelValidator.seriesModel)
+}
+
+func SeriesUpdate(c *gin.Context) {
+	seriesModel, ok := findOwnSeriesParam(c)
+	if !ok {
+		return
+	}
+	seriesModelValidator := NewSeriesModelValidatorFillWith(seriesModel)
+	if err := seriesModelValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := seriesModel.Update(seriesModelValidator.seriesModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	seriesResponse(c, http.StatusOK, seriesModel)
+}
+
+func SeriesDelete(c *gin.Context) {
+	seriesModel, ok := findOwnSeriesParam(c)
+	if !ok {
+		return
+	}
+	if err := seriesModel.delete(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"series": "Delete success"})
+}
+
+// Authors put their own articles into their series.
+func SeriesAdd(c *gin.Context) {
+	seriesModel, ok := findOwnSeriesParam(c)
+	if !ok {
+		return
+	}
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: c.Param("article")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	if articleModel.AuthorID != seriesModel.AuthorID {
+		c.JSON(http.StatusForbidden, common.NewError("articles", errors.New("Only your own articles can be part of your series")))
+		return
+	}
+	if err := seriesModel.addArticle(articleModel); err != nil {
+		if err == errArticleInSeries {
+			c.JSON(http.StatusConflict, common.NewError("articles", err))
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	seriesModel, _ = findSeriesParam(c)
+	seriesResponse(c, http.StatusOK, seriesModel)
+}
+
+func SeriesRemove(c *gin.Context) {
+	seriesModel, ok := findOwnSeriesParam(c)
+	if !ok {
+		return
+	}
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: c.Param("article")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	if err := seriesModel.removeArticle(articleModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	seriesResponse(c, http.StatusOK, seriesModel)
+}
+
+func SeriesReorder(c *gin.Context) {
+	seriesModel, ok := findOwnSeriesParam(c)
+	if !ok {
+		return
+	}
+	orderValidator := NewArticleOrderValidator()
+	if err := orderValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := seriesModel.reorder(orderValidator.Articles); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("articles", err))
+		return
+	}
+	seriesModel, _ = findSeriesParam(c)
+	seriesResponse(c, http.StatusOK, seriesModel)
+}
+
+// Authors see the pending invitations along with the authors.
+func ArticleAuthorList(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	serializer := ArticleAuthorsSerializer{C: c, Article: articleModel}
+	response := gin.H{"authors": serializer.Response()}
+	if articleModel.hasAuthor(c.MustGet("my_user_model").(users.UserModel)) {
+		invitationModels, err := articleModel.getInvitations()
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+		invitationsSerializer := InvitationsSerializer{c, invitationModels}
+		response["invitations"] = invitationsSerializer.Response()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// The owner invites another user to co-author the article, the user joins once they accept.
+func ArticleAuthorInvite(c *gin.Context) {
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: c.Param("slug")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if articleModel.Author.UserModelID != myUserModel.ID {
+		c.JSON(http.StatusForbidden, common.NewError("articles", errors.New("Only the owner can invite authors")))
+		return
+	}
+	invitationValidator := NewInvitationValidator()
+	if err := invitationValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	inviteeModel, err := users.FindOneUser(&users.UserModel{Username: invitationValidator.Author.Username})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("author", errors.New("Invalid username")))
+		return
+	}
+	invitationModel, err := articleModel.invite(GetArticleUserModel(inviteeModel), articleModel.Author)
+	if err != nil {
+		if err == errInviteAuthor || err == errAlreadyInvited {
+			c.JSON(http.StatusConflict, common.NewError("author", err))
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	invitationModel.Article = articleModel
+	invitationModel.Author = GetArticleUserModel(inviteeModel)
+	invitationModel.InvitedBy = articleModel.Author
+	serializer := InvitationSerializer{c, invitationModel}
+	c.JSON(http.StatusCreated, gin.H{"invitation": serializer.Response()})
+}
+
+// The owner takes a co-author off the article or withdraws an invitation, co-authors can leave by themselves.
+func ArticleAuthorRemove(c *gin.Context) {
+	articleModel, err := FindOneArticle(&ArticleModel{Slug: c.Param("slug")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("articles", errors.New("Invalid slug")))
+		return
+	}
+	authorModel, err := users.FindOneUser(&users.UserModel{Username: c.Param("username")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("author", errors.New("Invalid username")))
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if articleModel.Author.UserModelID != myUserModel.ID && authorModel.ID != myUserModel.ID {
+		c.JSON(http.StatusForbidden, common.NewError("articles", errors.New("Only the owner can remove authors")))
+		return
+	}
+	if authorModel.ID == articleModel.Author.UserModelID {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("author", errors.New("The owner can't leave the article")))
+		return
+	}
+	if err := articleModel.removeAuthor(GetArticleUserModel(authorModel)); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ArticleAuthorsSerializer{C: c, Article: articleModel}
+	c.JSON(http.StatusOK, gin.H{"authors": serializer.Response()})
+}
+
+func InvitationList(c *gin.Context) {
+	invitee := GetArticleUserModel(c.MustGet("my_user_model").(users.UserModel))
+	invitationModels, err := invitee.getInvitations()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := InvitationsSerializer{c, invitationModels}
+	c.JSON(http.StatusOK, gin.H{"invitations": serializer.Response()})
+}
+
+// An invitation of the current user in the :id param, answering 404 if there is none.
+func findInvitationParam(c *gin.Context) (ArticleAuthorModel, bool) {
+	invitee := GetArticleUserModel(c.MustGet("my_user_model").(users.UserModel))
+	invitationModel, err := invitee.findInvitation(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("invitation", errors.New("Invalid id")))
+		return invitationModel, false
+	}
+	return invitationModel, true
+}
+
+func InvitationAccept(c *gin.Context) {
+	invitationModel, ok := findInvitationParam(c)
+	if !ok {
+		return
+	}
+	articleModel, err := findArticleByID(invitationModel.ArticleID)
+	if err != nil || articleModel.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, common.NewError("invitation", errors.New("The article is gone")))
+		return
+	}
+	if err := invitationModel.accept(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ArticleSerializer{c, articleModel}
+	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
+}
+
+func InvitationDecline(c *gin.Context) {
+	invitationModel, ok := findInvitationParam(c)
+	if !ok {
+		return
+	}
+	if err := invitationModel.decline(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitation": "Decline success"})
+}
+
+// The reaction in the :reaction param, answering 422 unless it is one of Reactions.
+func reactionParam(c *gin.Context) (string, bool) {
+	reaction := c.Param("reaction")
+	if !validReaction(reaction) {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("reaction", fmt.Errorf("Unknown reaction, use one of %v", strings.Join(Reactions, ", "))))
+		return reaction, false
+	}
+	return reaction, true
+}
+
+// Leave a reaction on the article, or take it back when it's there already.
+func ArticleReact(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	reaction, ok := reactionParam(c)
+	if !ok {
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if _, err := toggleReaction(articleModel.ID, nil, GetArticleUserModel(myUserModel), reaction); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := ArticleSerializer{c, articleModel}
+	c.JSON(http.StatusOK, gin.H{"article": serializer.Response()})
+}
+
+// Leave a reaction on the comment, or take it back when it's there already.
+func ArticleCommentReact(c *gin.Context) {
+	articleModel, ok := findVisibleArticleParam(c)
+	if !ok {
+		return
+	}
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	var commentModel CommentModel
+	if err == nil {
+		commentModel, err = articleModel.findComment(uint(id64))
+	}
+	if err != nil || !commentModel.visible() {
+		c.JSON(http.StatusNotFound, common.NewError("comment", errors.New("Invalid id")))
+		return
+	}
+	reaction, ok := reactionParam(c)
+	if !ok {
+		return
+	}
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+	if _, err := toggleReaction(articleModel.ID, &commentModel.ID, GetArticleUserModel(myUserModel), reaction); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	commentModel, err = findCommentByID(commentModel.ID)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := CommentSerializer{c, commentModel}
+	c.JSON(http.StatusOK, gin.H{"comment": serializer.Response()})
+}
@@ -1,11 +1,26 @@
 package articles
 
 import (
-	"github.com/gosimple/slug"
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"realworld-backend/common"
 	"realworld-backend/users"
 	"github.com/gin-gonic/gin"
 )
 
+// Bodies are rendered from markdown into sanitized HTML only when the request asks with ?render=html
+func renderHTML(c *gin.Context) bool {
+	return c.Query("render") == "html"
+}
+
 type TagSerializer struct {
 	C *gin.Context
 	TagModel
@@ -29,13 +44,62 @@ func (s *TagsSerializer) Response() []string {
 	return response
 }
 
+type TagFollowSerializer struct {
+	C *gin.Context
+	TagModel
+}
+
+type TagFollowResponse struct {
+	Tag       string `json:"tag"`
+	Following bool   `json:"following"`
+}
+
+func (s *TagFollowSerializer) Response() TagFollowResponse {
+	myUserModel := s.C.MustGet("my_user_model").(users.UserModel)
+	return TagFollowResponse{
+		Tag:       s.Tag,
+		Following: s.isFollowedBy(GetArticleUserModel(myUserModel)),
+	}
+}
+
+type TagCountsSerializer struct {
+	C         *gin.Context
+	TagCounts []TagCount
+}
+
+type TagCountResponse struct {
+	Tag           string `json:"tag"`
+	ArticlesCount int    `json:"articlesCount"`
+}
+
+func (s *TagCountsSerializer) Response() []TagCountResponse {
+	response := []TagCountResponse{}
+	for _, tagCount := range s.TagCounts {
+		response = append(response, TagCountResponse{
+			Tag:           tagCount.Tag,
+			ArticlesCount: tagCount.ArticlesCount,
+		})
+	}
+	return response
+}
+
+// Just the names, in the same order
+func (s *TagCountsSerializer) TagsResponse() []string {
+	var tagModels []TagModel
+	for _, tagCount := range s.TagCounts {
+		tagModels = append(tagModels, tagCount.TagModel)
+	}
+	serializer := TagsSerializer{s.C, tagModels}
+	return serializer.Response()
+}
+
 type ArticleUserSerializer struct {
 	C *gin.Context
 	ArticleUserModel
 }
 
 func (s *ArticleUserSerializer) Response() users.ProfileResponse {
-	response := users.ProfileSerializer{s.C, s.ArticleUserModel.UserModel}
+	response := users.ProfileSerializer{C: s.C, UserModel: s.ArticleUserModel.UserModel}
 	return response.Response()
 }
 
@@ -45,17 +109,26 @@ type ArticleSerializer struct {
 }
 
 type ArticleResponse struct {
-	ID             uint                  `json:"-"`
-	Title          string                `json:"title"`
-	Slug           string                `json:"slug"`
-	Description    string                `json:"description"`
-	Body           string                `json:"body"`
-	CreatedAt      string                `json:"createdAt"`
-	UpdatedAt      string                `json:"updatedAt"`
-	Author         users.ProfileResponse `json:"author"`
-	Tags           []string              `json:"tagList"`
-	Favorite       bool                  `json:"favorited"`
-	FavoritesCount uint                  `json:"favoritesCount"`
+	ID             uint                    `json:"-"`
+	Title          string                  `json:"title"`
+	Slug           string                  `json:"slug"`
+	Description    string                  `json:"description"`
+	Body           *string                 `json:"body,omitempty"`
+	Excerpt        string                  `json:"excerpt,omitempty"`
+	BodyHTML       string                  `json:"bodyHtml,omitempty"`
+	CreatedAt      string                  `json:"createdAt"`
+	UpdatedAt      string                  `json:"updatedAt"`
+	Author         users.ProfileResponse   `json:"author"`
+	Authors        []ArticleAuthorResponse `json:"authors"`
+	Tags           []string                `json:"tagList"`
+	Favorite       bool                    `json:"favorited"`
+	FavoritesCount uint                    `json:"favoritesCount"`
+	Bookmarked     bool                    `json:"bookmarked"`
+	CommentsCount  uint                    `json:"commentsCount"`
+	Mentions       []MentionResponse       `json:"mentions"`
+	Series         *ArticleSeriesResponse  `json:"series,omitempty"`
+	Reactions      map[string]int          `json:"reactions"`
+	MyReactions    []string                `json:"myReactions"`
 }
 
 type ArticlesSerializer struct {
@@ -63,21 +136,79 @@ type ArticlesSerializer struct {
 	Articles []ArticleModel
 }
 
+// What an article response needs besides the article itself, see loadArticleExtras.
+type articleExtras struct {
+	Reactions     ReactionSummary
+	CommentsCount uint
+	Bookmarked    bool
+	Series        SeriesModel
+	SeriesParts   []ArticleModel
+	Coauthors     []ArticleUserModel
+	Mentions      []MentionModel
+}
+
+// Load the extras of the articles with the given ids as read by reader, in the same few queries
+// however many articles there are.
+func loadArticleExtras(ids []uint, reader ArticleUserModel) map[uint]articleExtras {
+	reactions := articleReactions(ids, reader)
+	commentsCounts := articleCommentsCounts(ids)
+	bookmarked := articleBookmarks(ids, reader)
+	series := articleSeries(ids)
+	coauthors := articleCoauthors(ids)
+	mentions := articleMentions(ids)
+	extras := map[uint]articleExtras{}
+	for _, id := range ids {
+		extras[id] = articleExtras{
+			Reactions:     reactions[id],
+			CommentsCount: commentsCounts[id],
+			Bookmarked:    bookmarked[id],
+			Series:        series[id].Series,
+			SeriesParts:   series[id].Articles,
+			Coauthors:     coauthors[id],
+			Mentions:      mentions[id],
+		}
+	}
+	return extras
+}
+
 func (s *ArticleSerializer) Response() ArticleResponse {
+	myArticleUserModel := GetArticleUserModel(s.C.MustGet("my_user_model").(users.UserModel))
+	return s.response(loadArticleExtras([]uint{s.ID}, myArticleUserModel)[s.ID], true)
+}
+
+// The response with the extras loaded already, lists load them for all their articles at once.
+// Without includeBody it carries an excerpt instead of the body, which isn't rendered either.
+func (s *ArticleSerializer) response(extras articleExtras, includeBody bool) ArticleResponse {
 	myUserModel := s.C.MustGet("my_user_model").(users.UserModel)
+	myArticleUserModel := GetArticleUserModel(myUserModel)
 	authorSerializer := ArticleUserSerializer{s.C, s.Author}
 	response := ArticleResponse{
 		ID:          s.ID,
-		Slug:        slug.Make(s.Title),
+		Slug:        s.Slug,
 		Title:       s.Title,
 		Description: s.Description,
-		Body:        s.Body,
 		CreatedAt:   s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
 		//UpdatedAt:      s.UpdatedAt.UTC().Format(time.RFC3339Nano),
 		UpdatedAt:      s.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
 		Author:         authorSerializer.Response(),
-		Favorite:       s.isFavoriteBy(GetArticleUserModel(myUserModel)),
+		Authors:        articleAuthorsResponse(s.C, s.Author, extras.Coauthors),
+		Favorite:       s.isFavoriteBy(myArticleUserModel),
 		FavoritesCount: s.favoritesCount(),
+		Bookmarked:     extras.Bookmarked,
+		CommentsCount:  extras.CommentsCount,
+		Mentions:       mentionsResponse(extras.Mentions),
+	}
+	response.Reactions, response.MyReactions = reactionsResponse(extras.Reactions)
+	if extras.Series.ID != 0 {
+		response.Series = articleSeriesResponse(extras.Series, visibleParts(extras.SeriesParts, myUserModel), s.ID)
+	}
+	if !includeBody {
+		response.Excerpt = excerpt(s.Body, excerptLength)
+	} else {
+		response.Body = &s.Body
+		if renderHTML(s.C) {
+			response.BodyHTML = common.RenderMarkdownCached(fmt.Sprintf("article:%v:%v", s.ID, s.UpdatedAt.UnixNano()), s.Body)
+		}
 	}
 	response.Tags = make([]string, 0)
 	for _, tag := range s.Tags {
@@ -87,11 +218,118 @@ func (s *ArticleSerializer) Response() ArticleResponse {
 	return response
 }
 
+// Lists carry an excerpt instead of the body, unless asked for with ?includeBody=true
 func (s *ArticlesSerializer) Response() []ArticleResponse {
+	includeBody := s.C.Query("includeBody") == "true"
 	response := []ArticleResponse{}
+	ids := make([]uint, len(s.Articles))
+	for i, article := range s.Articles {
+		ids[i] = article.ID
+	}
+	extras := loadArticleExtras(ids, GetArticleUserModel(s.C.MustGet("my_user_model").(users.UserModel)))
 	for _, article := range s.Articles {
 		serializer := ArticleSerializer{s.C, article}
-		response = append(response, serializer.Response())
+		response = append(response, serializer.response(extras[article.ID], includeBody))
+	}
+	return response
+}
+
+// Every reaction of Reactions with how often it was left, and the ones the reader left in the same order.
+func reactionsResponse(summary ReactionSummary) (map[string]int, []string) {
+	counts := map[string]int{}
+	mine := []string{}
+	for _, reaction := range Reactions {
+		counts[reaction] = summary.Counts[reaction]
+		if summary.Mine[reaction] {
+			mine = append(mine, reaction)
+		}
+	}
+	return counts, mine
+}
+
+const excerptLength = 200
+
+// Cut body down to about length characters at a word boundary.
+func excerpt(body string, length int) string {
+	runes := []rune(strings.Join(strings.Fields(body), " "))
+	if len(runes) <= length {
+		return string(runes)
+	}
+	cut := string(runes[:length])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// What webhooks are told about an article, the same whoever receives it.
+type ArticleEventResponse struct {
+	Slug        string   `json:"slug"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Body        string   `json:"body"`
+	Tags        []string `json:"tagList"`
+	Author      string   `json:"author"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+func articleEventResponse(article ArticleModel) ArticleEventResponse {
+	response := ArticleEventResponse{
+		Slug:        article.Slug,
+		Title:       article.Title,
+		Description: article.Description,
+		Body:        article.Body,
+		Tags:        []string{},
+		Author:      article.Author.UserModel.Username,
+		CreatedAt:   article.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		UpdatedAt:   article.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+	for _, tag := range article.Tags {
+		response.Tags = append(response.Tags, tag.Tag)
+	}
+	return response
+}
+
+// What webhooks are told about a comment, Article only has its slug and title.
+type CommentEventResponse struct {
+	ID        uint   `json:"id"`
+	Body      string `json:"body"`
+	Author    string `json:"author"`
+	ParentID  *uint  `json:"parentId"`
+	CreatedAt string `json:"createdAt"`
+	Article   struct {
+		Slug  string `json:"slug"`
+		Title string `json:"title"`
+	} `json:"article"`
+}
+
+func commentEventResponse(comment CommentModel) CommentEventResponse {
+	response := CommentEventResponse{
+		ID:        comment.ID,
+		Body:      comment.Body,
+		Author:    comment.Author.UserModel.Username,
+		ParentID:  comment.ParentID,
+		CreatedAt: comment.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+	response.Article.Slug = comment.Article.Slug
+	response.Article.Title = comment.Article.Title
+	return response
+}
+
+// Profile is where the API serves the mentioned user's profile.
+type MentionResponse struct {
+	Username string `json:"username"`
+	Profile  string `json:"profile"`
+}
+
+func mentionsResponse(mentions []MentionModel) []MentionResponse {
+	response := []MentionResponse{}
+	for _, mention := range mentions {
+		response = append(response, MentionResponse{
+			Username: mention.Username,
+			Profile:  "/api/profiles/" + mention.Username,
+		})
 	}
 	return response
 }
@@ -106,30 +344,984 @@ type CommentsSerializer struct {
 	Comments []CommentModel
 }
 
+// A deleted comment which still has replies is a tombstone: no body, no author.
 type CommentResponse struct {
-	ID        uint                  `json:"id"`
-	Body      string                `json:"body"`
-	CreatedAt string                `json:"createdAt"`
-	UpdatedAt string                `json:"updatedAt"`
-	Author    users.ProfileResponse `json:"author"`
+	ID           uint                   `json:"id"`
+	Body         string                 `json:"body"`
+	BodyHTML     string                 `json:"bodyHtml,omitempty"`
+	CreatedAt    string                 `json:"createdAt"`
+	UpdatedAt    string                 `json:"updatedAt"`
+	Author       *users.ProfileResponse `json:"author"`
+	ParentID     *uint                  `json:"parentId"`
+	RepliesCount int                    `json:"repliesCount"`
+	Edited       bool                   `json:"edited"`
+	Deleted      bool                   `json:"deleted,omitempty"`
+	Hidden       bool                   `json:"hidden,omitempty"`
+	Mentions     []MentionResponse      `json:"mentions,omitempty"`
+	Reactions    map[string]int         `json:"reactions"`
+	MyReactions  []string               `json:"myReactions"`
+	Replies      []CommentResponse      `json:"replies,omitempty"`
 }
 
 func (s *CommentSerializer) Response() CommentResponse {
-	authorSerializer := ArticleUserSerializer{s.C, s.Author}
+	myArticleUserModel := GetArticleUserModel(s.C.MustGet("my_user_model").(users.UserModel))
+	return s.response(commentReactions([]uint{s.ID}, myArticleUserModel)[s.ID])
+}
+
+// Tombstones go without reactions, see ArticleSerializer.response for why they are passed in.
+func (s *CommentSerializer) response(reactions ReactionSummary) CommentResponse {
 	response := CommentResponse{
-		ID:        s.ID,
-		Body:      s.Body,
-		CreatedAt: s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
-		UpdatedAt: s.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
-		Author:    authorSerializer.Response(),
+		ID:           s.ID,
+		CreatedAt:    s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		UpdatedAt:    s.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		ParentID:     s.ParentID,
+		RepliesCount: s.RepliesCount,
+		Edited:       s.EditedAt != nil,
+	}
+	if s.DeletedAt != nil {
+		response.Deleted = true
+		return response
+	}
+	if s.Hidden {
+		response.Hidden = true
+		return response
+	}
+	authorSerializer := ArticleUserSerializer{s.C, s.Author}
+	author := authorSerializer.Response()
+	response.Body = s.Body
+	response.Author = &author
+	response.Mentions = mentionsResponse(s.Mentions)
+	response.Reactions, response.MyReactions = reactionsResponse(reactions)
+	if renderHTML(s.C) {
+		response.BodyHTML = common.RenderMarkdownCached(fmt.Sprintf("comment:%v:%v", s.ID, s.UpdatedAt.UnixNano()), s.Body)
 	}
 	return response
 }
 
 func (s *CommentsSerializer) Response() []CommentResponse {
 	response := []CommentResponse{}
+	ids := make([]uint, len(s.Comments))
+	for i, comment := range s.Comments {
+		ids[i] = comment.ID
+	}
+	reactions := commentReactions(ids, GetArticleUserModel(s.C.MustGet("my_user_model").(users.UserModel)))
 	for _, comment := range s.Comments {
 		serializer := CommentSerializer{s.C, comment}
+		response = append(response, serializer.response(reactions[comment.ID]))
+	}
+	return response
+}
+
+// Nest replies under their parents, Comments must be sorted so that parents come first.
+func (s *CommentsSerializer) TreeResponse() []CommentResponse {
+	flat := s.Response()
+	children := map[uint][]int{}
+	var roots []int
+	index := map[uint]bool{}
+	for i, comment := range flat {
+		index[comment.ID] = true
+		if comment.ParentID != nil && index[*comment.ParentID] {
+			children[*comment.ParentID] = append(children[*comment.ParentID], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+	var build func(i int) CommentResponse
+	build = func(i int) CommentResponse {
+		comment := flat[i]
+		for _, child := range children[comment.ID] {
+			comment.Replies = append(comment.Replies, build(child))
+		}
+		return comment
+	}
+	response := []CommentResponse{}
+	for _, i := range roots {
+		response = append(response, build(i))
+	}
+	return response
+}
+
+type RevisionSerializer struct {
+	C *gin.Context
+	ArticleRevisionModel
+}
+
+type RevisionsSerializer struct {
+	C         *gin.Context
+	Revisions []ArticleRevisionModel
+}
+
+type RevisionResponse struct {
+	Number      uint                  `json:"number"`
+	Title       string                `json:"title"`
+	Description string                `json:"description"`
+	Body        string                `json:"body"`
+	CreatedAt   string                `json:"createdAt"`
+	Author      users.ProfileResponse `json:"author"`
+}
+
+func (s *RevisionSerializer) Response() RevisionResponse {
+	authorSerializer := ArticleUserSerializer{s.C, s.Author}
+	response := RevisionResponse{
+		Number:      s.Number,
+		Title:       s.Title,
+		Description: s.Description,
+		Body:        s.Body,
+		CreatedAt:   s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		Author:      authorSerializer.Response(),
+	}
+	return response
+}
+
+func (s *RevisionsSerializer) Response() []RevisionResponse {
+	response := []RevisionResponse{}
+	for _, revision := range s.Revisions {
+		serializer := RevisionSerializer{s.C, revision}
+		response = append(response, serializer.Response())
+	}
+	return response
+}
+
+// From may be an empty model, which diffs To against an empty article.
+type RevisionDiffSerializer struct {
+	C    *gin.Context
+	From ArticleRevisionModel
+	To   ArticleRevisionModel
+}
+
+type RevisionDiffResponse struct {
+	From        uint              `json:"from"`
+	To          uint              `json:"to"`
+	Title       []common.DiffLine `json:"title"`
+	Description []common.DiffLine `json:"description"`
+	Body        []common.DiffLine `json:"body"`
+}
+
+func (s *RevisionDiffSerializer) Response() (RevisionDiffResponse, error) {
+	response := RevisionDiffResponse{
+		From: s.From.Number,
+		To:   s.To.Number,
+	}
+	var err error
+	if response.Title, err = common.DiffLines(s.From.Title, s.To.Title); err != nil {
+		return response, err
+	}
+	if response.Description, err = common.DiffLines(s.From.Description, s.To.Description); err != nil {
+		return response, err
+	}
+	response.Body, err = common.DiffLines(s.From.Body, s.To.Body)
+	return response, err
+}
+
+type TrashSerializer struct {
+	C        *gin.Context
+	Articles []ArticleModel
+	Comments []CommentModel
+}
+
+type TrashArticleResponse struct {
+	Slug      string `json:"slug"`
+	Title     string `json:"title"`
+	DeletedAt string `json:"deletedAt"`
+	PurgeAt   string `json:"purgeAt"`
+}
+
+type TrashCommentResponse struct {
+	ID          uint   `json:"id"`
+	Body        string `json:"body"`
+	ArticleSlug string `json:"articleSlug"`
+	DeletedAt   string `json:"deletedAt"`
+	PurgeAt     string `json:"purgeAt"`
+}
+
+type TrashResponse struct {
+	Articles []TrashArticleResponse `json:"articles"`
+	Comments []TrashCommentResponse `json:"comments"`
+}
+
+func (s *TrashSerializer) Response() TrashResponse {
+	response := TrashResponse{
+		Articles: []TrashArticleResponse{},
+		Comments: []TrashCommentResponse{},
+	}
+	for _, article := range s.Articles {
+		response.Articles = append(response.Articles, TrashArticleResponse{
+			Slug:      article.Slug,
+			Title:     article.Title,
+			DeletedAt: article.DeletedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+			PurgeAt:   article.DeletedAt.Add(TrashRetention).UTC().Format("2006-01-02T15:04:05.999Z"),
+		})
+	}
+	for _, comment := range s.Comments {
+		response.Comments = append(response.Comments, TrashCommentResponse{
+			ID:          comment.ID,
+			Body:        comment.Body,
+			ArticleSlug: comment.Article.Slug,
+			DeletedAt:   comment.DeletedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+			PurgeAt:     comment.DeletedAt.Add(TrashRetention).UTC().Format("2006-01-02T15:04:05.999Z"),
+		})
+	}
+	return response
+}
+
+type CommentEditsSerializer struct {
+	C     *gin.Context
+	Edits []CommentEditModel
+}
+
+type CommentEditResponse struct {
+	Body     string `json:"body"`
+	EditedAt string `json:"editedAt"`
+}
+
+// EditedAt is when the body got replaced, which is when the edit was stored.
+func (s *CommentEditsSerializer) Response() []CommentEditResponse {
+	response := []CommentEditResponse{}
+	for _, edit := range s.Edits {
+		response = append(response, CommentEditResponse{
+			Body:     edit.Body,
+			EditedAt: edit.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		})
+	}
+	return response
+}
+
+type ReportSerializer struct {
+	C *gin.Context
+	ReportModel
+}
+
+type ReportResponse struct {
+	ID        uint   `json:"id"`
+	Reason    string `json:"reason"`
+	Note      string `json:"note"`
+	Status    string `json:"status"`
+	Action    string `json:"action,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (s *ReportSerializer) Response() ReportResponse {
+	return ReportResponse{
+		ID:        s.ID,
+		Reason:    s.Reason,
+		Note:      s.Note,
+		Status:    s.Status,
+		Action:    s.Action,
+		CreatedAt: s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+}
+
+// Reports in the moderation queue, ReportsCounts holds the number of open reports on the same content.
+type ReportQueueSerializer struct {
+	C             *gin.Context
+	Reports       []ReportModel
+	ReportsCounts []int
+}
+
+type ReportedArticleResponse struct {
+	Slug    string `json:"slug"`
+	Title   string `json:"title"`
+	Hidden  bool   `json:"hidden"`
+	Deleted bool   `json:"deleted"`
+}
+
+type ReportedCommentResponse struct {
+	ID      uint   `json:"id"`
+	Body    string `json:"body"`
+	Hidden  bool   `json:"hidden"`
+	Deleted bool   `json:"deleted"`
+}
+
+type ReportQueueResponse struct {
+	ReportResponse
+	ReportsCount int                      `json:"reportsCount"`
+	Reporter     users.ProfileResponse    `json:"reporter"`
+	Author       users.ProfileResponse    `json:"author"`
+	Article      ReportedArticleResponse  `json:"article"`
+	Comment      *ReportedCommentResponse `json:"comment,omitempty"`
+}
+
+func (s *ReportQueueSerializer) Response() []ReportQueueResponse {
+	response := []ReportQueueResponse{}
+	for i, report := range s.Reports {
+		reportSerializer := ReportSerializer{s.C, report}
+		reporterSerializer := ArticleUserSerializer{s.C, report.Reporter}
+		item := ReportQueueResponse{
+			ReportResponse: reportSerializer.Response(),
+			ReportsCount:   s.ReportsCounts[i],
+			Reporter:       reporterSerializer.Response(),
+			Article: ReportedArticleResponse{
+				Slug:    report.Article.Slug,
+				Title:   report.Article.Title,
+				Hidden:  report.Article.Hidden,
+				Deleted: report.Article.DeletedAt != nil,
+			},
+		}
+		author := report.Article.Author
+		if report.CommentID != nil {
+			author = report.Comment.Author
+			item.Comment = &ReportedCommentResponse{
+				ID:      report.Comment.ID,
+				Body:    report.Comment.Body,
+				Hidden:  report.Comment.Hidden,
+				Deleted: report.Comment.DeletedAt != nil,
+			}
+		}
+		authorSerializer := ArticleUserSerializer{s.C, author}
+		item.Author = authorSerializer.Response()
+		response = append(response, item)
+	}
+	return response
+}
+
+type DigestSerializer struct {
+	C *gin.Context
+	DigestSubscriptionModel
+}
+
+type DigestResponse struct {
+	Frequency  string  `json:"frequency"`
+	LastSentAt *string `json:"lastSentAt"`
+}
+
+func (s *DigestSerializer) Response() DigestResponse {
+	response := DigestResponse{Frequency: s.Frequency}
+	if s.LastSentAt != nil {
+		lastSentAt := s.LastSentAt.UTC().Format("2006-01-02T15:04:05.999Z")
+		response.LastSentAt = &lastSentAt
+	}
+	return response
+}
+
+//go:embed templates/digest.html templates/digest.txt templates/unsubscribe.html
+var digestTemplates embed.FS
+
+var (
+	digestHTML      = htmltemplate.Must(htmltemplate.ParseFS(digestTemplates, "templates/digest.html"))
+	digestText      = texttemplate.Must(texttemplate.ParseFS(digestTemplates, "templates/digest.txt"))
+	unsubscribeHTML = htmltemplate.Must(htmltemplate.ParseFS(digestTemplates, "templates/unsubscribe.html"))
+)
+
+const digestUnsubscribe = "digest-unsubscribe"
+
+// The link which turns the digest of subscriber off without logging in.
+func digestUnsubscribeURL(subscriber ArticleUserModel) string {
+	token := common.SignToken(digestUnsubscribe, fmt.Sprint(subscriber.ID))
+	return common.APIURL + "/api/digest/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// The page behind the unsubscribe link, asking to confirm by POSTing to unsubscribeURL, or telling
+// it's done once unsubscribed.
+func unsubscribePage(unsubscribeURL string, unsubscribed bool) ([]byte, error) {
+	data := struct {
+		UnsubscribeURL string
+		SettingsURL    string
+		Unsubscribed   bool
+	}{unsubscribeURL, common.AppURL + "/settings", unsubscribed}
+	var html bytes.Buffer
+	err := unsubscribeHTML.Execute(&html, data)
+	return html.Bytes(), err
+}
+
+type digestArticle struct {
+	Title       string
+	Description string
+	Author      string
+	URL         string
+}
+
+// The email listing articles, the first of the count new ones, for the digest subscription.
+func DigestMessage(subscription DigestSubscriptionModel, articles []ArticleModel, count int) (common.Message, error) {
+	data := struct {
+		Username       string
+		Frequency      string
+		Articles       []digestArticle
+		More           int
+		FeedURL        string
+		UnsubscribeURL string
+	}{
+		Username:       subscription.User.UserModel.Username,
+		Frequency:      subscription.Frequency,
+		More:           count - len(articles),
+		FeedURL:        common.AppURL + "/",
+		UnsubscribeURL: digestUnsubscribeURL(subscription.User),
+	}
+	for _, article := range articles {
+		data.Articles = append(data.Articles, digestArticle{
+			Title:       article.Title,
+			Description: article.Description,
+			Author:      article.Author.UserModel.Username,
+			URL:         articleURL(article),
+		})
+	}
+	var html, text bytes.Buffer
+	if err := digestHTML.Execute(&html, data); err != nil {
+		return common.Message{}, err
+	}
+	if err := digestText.Execute(&text, data); err != nil {
+		return common.Message{}, err
+	}
+	subject := fmt.Sprintf("%v new articles from authors you follow", count)
+	if count == 1 {
+		subject = "1 new article from authors you follow"
+	}
+	return common.Message{
+		To:      subscription.User.UserModel.Email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+type FeedTokenSerializer struct {
+	C *gin.Context
+	FeedTokenModel
+}
+
+type FeedTokenResponse struct {
+	Token     string `json:"token"`
+	RSS       string `json:"rss"`
+	Atom      string `json:"atom"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (s *FeedTokenSerializer) Response() FeedTokenResponse {
+	feedURL := common.APIURL + "/api/articles/feed.%v?token=" + s.Token
+	return FeedTokenResponse{
+		Token:     s.Token,
+		RSS:       fmt.Sprintf(feedURL, "rss"),
+		Atom:      fmt.Sprintf(feedURL, "atom"),
+		CreatedAt: s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+}
+
+type ReadingListSerializer struct {
+	C *gin.Context
+	ReadingListModel
+}
+
+type ReadingListsSerializer struct {
+	C     *gin.Context
+	Lists []ReadingListModel
+}
+
+type ReadingListResponse struct {
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	ArticlesCount int    `json:"articlesCount"`
+	CreatedAt     string `json:"createdAt"`
+	UpdatedAt     string `json:"updatedAt"`
+}
+
+func (s *ReadingListSerializer) Response() ReadingListResponse {
+	return ReadingListResponse{
+		ID:            s.ID,
+		Name:          s.Name,
+		ArticlesCount: s.articlesCount(),
+		CreatedAt:     s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		UpdatedAt:     s.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+}
+
+func (s *ReadingListsSerializer) Response() []ReadingListResponse {
+	response := []ReadingListResponse{}
+	for _, list := range s.Lists {
+		serializer := ReadingListSerializer{s.C, list}
+		response = append(response, serializer.Response())
+	}
+	return response
+}
+
+// The owner of Article followed by its co-authors, see ArticleRoleOwner.
+type ArticleAuthorsSerializer struct {
+	C       *gin.Context
+	Article ArticleModel
+}
+
+type ArticleAuthorResponse struct {
+	users.ProfileResponse
+	Role string `json:"role"`
+}
+
+func (s *ArticleAuthorsSerializer) Response() []ArticleAuthorResponse {
+	coauthors, _ := s.Article.getCoauthors()
+	return articleAuthorsResponse(s.C, s.Article.Author, coauthors)
+}
+
+// The owner first, then the co-authors in the order they joined.
+func articleAuthorsResponse(c *gin.Context, owner ArticleUserModel, coauthors []ArticleUserModel) []ArticleAuthorResponse {
+	ownerSerializer := ArticleUserSerializer{c, owner}
+	response := []ArticleAuthorResponse{{ProfileResponse: ownerSerializer.Response(), Role: ArticleRoleOwner}}
+	for _, coauthor := range coauthors {
+		serializer := ArticleUserSerializer{c, coauthor}
+		response = append(response, ArticleAuthorResponse{ProfileResponse: serializer.Response(), Role: ArticleRoleCoauthor})
+	}
+	return response
+}
+
+type InvitationSerializer struct {
+	C *gin.Context
+	ArticleAuthorModel
+}
+
+type InvitationsSerializer struct {
+	C           *gin.Context
+	Invitations []ArticleAuthorModel
+}
+
+type InvitationArticleResponse struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+// Article and InvitedBy are only loaded for the invitations of the invitee, Author for the ones of an article.
+type InvitationResponse struct {
+	ID        uint                       `json:"id"`
+	Article   *InvitationArticleResponse `json:"article,omitempty"`
+	Author    *users.ProfileResponse     `json:"author,omitempty"`
+	InvitedBy *users.ProfileResponse     `json:"invitedBy,omitempty"`
+	CreatedAt string                     `json:"createdAt"`
+}
+
+func (s *InvitationSerializer) Response() InvitationResponse {
+	response := InvitationResponse{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+	if s.Article.ID != 0 {
+		response.Article = &InvitationArticleResponse{Slug: s.Article.Slug, Title: s.Article.Title}
+	}
+	if s.Author.UserModel.ID != 0 {
+		serializer := ArticleUserSerializer{s.C, s.Author}
+		profile := serializer.Response()
+		response.Author = &profile
+	}
+	if s.InvitedBy.UserModel.ID != 0 {
+		serializer := ArticleUserSerializer{s.C, s.InvitedBy}
+		profile := serializer.Response()
+		response.InvitedBy = &profile
+	}
+	return response
+}
+
+func (s *InvitationsSerializer) Response() []InvitationResponse {
+	response := []InvitationResponse{}
+	for _, invitation := range s.Invitations {
+		serializer := InvitationSerializer{s.C, invitation}
+		response = append(response, serializer.Response())
+	}
+	return response
+}
+
+// Where an article is in its series, Position counts from 1. Prev and Next are the slugs of the parts around it.
+type ArticleSeriesResponse struct {
+	Slug       string  `json:"slug"`
+	Title      string  `json:"title"`
+	Position   int     `json:"position"`
+	PartsCount int     `json:"partsCount"`
+	Prev       *string `json:"prev"`
+	Next       *string `json:"next"`
+}
+
+// The parts of a series user gets to read.
+func visibleParts(parts []ArticleModel, user users.UserModel) []ArticleModel {
+	visible := []ArticleModel{}
+	for _, part := range parts {
+		if part.visibleTo(user) {
+			visible = append(visible, part)
+		}
+	}
+	return visible
+}
+
+// Nil when the article with articleID isn't among parts.
+func articleSeriesResponse(series SeriesModel, parts []ArticleModel, articleID uint) *ArticleSeriesResponse {
+	for i, part := range parts {
+		if part.ID != articleID {
+			continue
+		}
+		response := &ArticleSeriesResponse{
+			Slug:       series.Slug,
+			Title:      series.Title,
+			Position:   i + 1,
+			PartsCount: len(parts),
+		}
+		if i > 0 {
+			response.Prev = &parts[i-1].Slug
+		}
+		if i+1 < len(parts) {
+			response.Next = &parts[i+1].Slug
+		}
+		return response
+	}
+	return nil
+}
+
+// Articles are the parts of the series in order, the ones the reader can't see already left out.
+type SeriesSerializer struct {
+	C        *gin.Context
+	Series   SeriesModel
+	Articles []ArticleModel
+}
+
+type SeriesPartResponse struct {
+	Position    int    `json:"position"`
+	Slug        string `json:"slug"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type SeriesResponse struct {
+	Slug          string                `json:"slug"`
+	Title         string                `json:"title"`
+	Description   string                `json:"description"`
+	Author        users.ProfileResponse `json:"author"`
+	CreatedAt     string                `json:"createdAt"`
+	UpdatedAt     string                `json:"updatedAt"`
+	Articles      []SeriesPartResponse  `json:"articles"`
+	ArticlesCount int                   `json:"articlesCount"`
+}
+
+func (s *SeriesSerializer) Response() SeriesResponse {
+	authorSerializer := ArticleUserSerializer{s.C, s.Series.Author}
+	response := SeriesResponse{
+		Slug:          s.Series.Slug,
+		Title:         s.Series.Title,
+		Description:   s.Series.Description,
+		Author:        authorSerializer.Response(),
+		CreatedAt:     s.Series.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		UpdatedAt:     s.Series.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		Articles:      []SeriesPartResponse{},
+		ArticlesCount: len(s.Articles),
+	}
+	for i, article := range s.Articles {
+		response.Articles = append(response.Articles, SeriesPartResponse{
+			Position:    i + 1,
+			Slug:        article.Slug,
+			Title:       article.Title,
+			Description: article.Description,
+			CreatedAt:   article.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		})
+	}
+	return response
+}
+
+// Articles as an RSS 2.0 or Atom feed. Link is the page of the frontend the feed is about.
+type SyndicationSerializer struct {
+	C        *gin.Context
+	Title    string
+	Link     string
+	Articles []ArticleModel
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	Description string   `xml:"description"`
+	Author      string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     string         `xml:"author>name"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+func articleURL(article ArticleModel) string {
+	return common.AppURL + "/article/" + url.PathEscape(article.Slug)
+}
+
+// When the newest article of the feed changed, zero for an empty feed.
+func (s *SyndicationSerializer) LastModified() time.Time {
+	var lastModified time.Time
+	for _, article := range s.Articles {
+		if article.UpdatedAt.After(lastModified) {
+			lastModified = article.UpdatedAt
+		}
+	}
+	return lastModified
+}
+
+func (s *SyndicationSerializer) RSS() ([]byte, error) {
+	channel := rssChannel{Title: s.Title, Link: s.Link, Description: s.Title}
+	if lastModified := s.LastModified(); !lastModified.IsZero() {
+		channel.LastBuildDate = lastModified.UTC().Format(time.RFC1123Z)
+	}
+	for _, article := range s.Articles {
+		item := rssItem{
+			Title:       article.Title,
+			Link:        articleURL(article),
+			GUID:        articleURL(article),
+			Description: article.Description,
+			Author:      article.Author.UserModel.Username,
+			PubDate:     article.CreatedAt.UTC().Format(time.RFC1123Z),
+		}
+		for _, tag := range article.Tags {
+			item.Categories = append(item.Categories, tag.Tag)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return marshalXML(rssFeed{Version: "2.0", Channel: channel})
+}
+
+func (s *SyndicationSerializer) Atom() ([]byte, error) {
+	feed := atomFeed{
+		Title:   s.Title,
+		ID:      s.Link,
+		Updated: s.LastModified().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: common.APIURL + s.C.Request.URL.RequestURI(), Rel: "self"},
+			{Href: s.Link, Rel: "alternate"},
+		},
+	}
+	for _, article := range s.Articles {
+		entry := atomEntry{
+			Title:     article.Title,
+			ID:        articleURL(article),
+			Link:      atomLink{Href: articleURL(article), Rel: "alternate"},
+			Published: article.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   article.UpdatedAt.UTC().Format(time.RFC3339),
+			Author:    article.Author.UserModel.Username,
+			Summary:   article.Description,
+		}
+		for _, tag := range article.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag.Tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+func marshalXML(feed interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+type SitemapSerializer struct {
+	C       *gin.Context
+	Entries []SitemapEntry
+}
+
+func (s *SitemapSerializer) Response() ([]byte, error) {
+	urlSet := sitemapURLSet{URLs: []sitemapURL{}}
+	for _, entry := range s.Entries {
+		item := sitemapURL{Loc: common.AppURL + entry.Path}
+		if entry.LastModified != nil {
+			item.LastMod = entry.LastModified.UTC().Format(time.RFC3339)
+		}
+		urlSet.URLs = append(urlSet.URLs, item)
+	}
+	return marshalXML(urlSet)
+}
+
+// The sitemap index pointing at Pages sitemaps, see SitemapPage.
+type SitemapIndexSerializer struct {
+	C            *gin.Context
+	Pages        int
+	LastModified time.Time
+}
+
+func (s *SitemapIndexSerializer) Response() ([]byte, error) {
+	index := sitemapIndex{}
+	for page := 1; page <= s.Pages; page++ {
+		item := sitemapURL{Loc: fmt.Sprintf("%v/sitemaps/%v.xml", common.APIURL, page)}
+		if !s.LastModified.IsZero() {
+			item.LastMod = s.LastModified.UTC().Format(time.RFC3339)
+		}
+		index.Sitemaps = append(index.Sitemaps, item)
+	}
+	return marshalXML(index)
+}
+
+// The first image in a markdown body, ![alt](src), when it's absolute or relative to the frontend.
+var markdownImagePattern = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^)\s>]+)`)
+
+func articleImage(body string) string {
+	for _, match := range markdownImagePattern.FindAllStringSubmatch(body, -1) {
+		src := match[1]
+		if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
+			return src
+		}
+		if strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+			return common.AppURL + src
+		}
+	}
+	return ""
+}
+
+// What link previews of an article show, both as plain fields and as the Open Graph and Twitter
+// card meta tags the frontend puts in the page head.
+type ArticleMetaSerializer struct {
+	C *gin.Context
+	ArticleModel
+}
+
+type ArticleMetaResponse struct {
+	Title         string            `json:"title"`
+	Description   string            `json:"description"`
+	URL           string            `json:"url"`
+	Image         string            `json:"image"`
+	Author        string            `json:"author"`
+	AuthorURL     string            `json:"authorUrl"`
+	PublishedTime string            `json:"publishedTime"`
+	ModifiedTime  string            `json:"modifiedTime"`
+	Tags          []string          `json:"tagList"`
+	OpenGraph     map[string]string `json:"openGraph"`
+	Twitter       map[string]string `json:"twitter"`
+}
+
+func (s *ArticleMetaSerializer) Response() ArticleMetaResponse {
+	response := ArticleMetaResponse{
+		Title:         s.Title,
+		Description:   s.Description,
+		URL:           articleURL(s.ArticleModel),
+		Image:         articleImage(s.Body),
+		Author:        s.Author.UserModel.Username,
+		AuthorURL:     common.AppURL + "/profile/" + url.PathEscape(s.Author.UserModel.Username),
+		PublishedTime: s.CreatedAt.UTC().Format(time.RFC3339),
+		ModifiedTime:  s.UpdatedAt.UTC().Format(time.RFC3339),
+		Tags:          []string{},
+	}
+	if response.Description == "" {
+		response.Description = excerpt(s.Body, excerptLength)
+	}
+	card := "summary_large_image"
+	if response.Image == "" {
+		card = "summary"
+		if image := s.Author.UserModel.ImageURL(); image != nil {
+			response.Image = *image
+		}
+	}
+	for _, tag := range s.Tags {
+		response.Tags = append(response.Tags, tag.Tag)
+	}
+	response.OpenGraph = map[string]string{
+		"og:type":                "article",
+		"og:site_name":           "Conduit",
+		"og:title":               response.Title,
+		"og:description":         response.Description,
+		"og:url":                 response.URL,
+		"article:author":         response.AuthorURL,
+		"article:published_time": response.PublishedTime,
+		"article:modified_time":  response.ModifiedTime,
+	}
+	response.Twitter = map[string]string{
+		"twitter:card":        card,
+		"twitter:title":       response.Title,
+		"twitter:description": response.Description,
+	}
+	if response.Image != "" {
+		response.OpenGraph["og:image"] = response.Image
+		response.Twitter["twitter:image"] = response.Image
+	}
+	return response
+}
+
+type ArticleImageSerializer struct {
+	C *gin.Context
+	ArticleImageModel
+}
+
+// URL and ThumbnailURL are signed and expire, Link is the lasting address to put into the
+// article body, it redirects to a fresh signed URL.
+type ArticleImageResponse struct {
+	ID           uint    `json:"id"`
+	URL          *string `json:"url"`
+	ThumbnailURL *string `json:"thumbnailUrl"`
+	Link         string  `json:"link"`
+	ContentType  string  `json:"contentType"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	Size         int     `json:"size"`
+	CreatedAt    string  `json:"createdAt"`
+}
+
+func (s *ArticleImageSerializer) Response() ArticleImageResponse {
+	return ArticleImageResponse{
+		ID:           s.ID,
+		URL:          common.MediaURL(s.Key),
+		ThumbnailURL: common.MediaURL(s.ThumbnailKey),
+		Link:         fmt.Sprintf("%v/api/articles/%v/images/%v", common.APIURL, url.PathEscape(s.C.Param("slug")), s.ID),
+		ContentType:  s.ContentType,
+		Width:        s.Width,
+		Height:       s.Height,
+		Size:         s.Size,
+		CreatedAt:    s.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+}
+
+type ArticleImagesSerializer struct {
+	C      *gin.Context
+	Images []ArticleImageModel
+}
+
+func (s *ArticleImagesSerializer) Response() []ArticleImageResponse {
+	response := []ArticleImageResponse{}
+	for _, image := range s.Images {
+		serializer := ArticleImageSerializer{s.C, image}
 		response = append(response, serializer.Response())
 	}
 	return response
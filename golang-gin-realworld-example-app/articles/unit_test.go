@@ -1,7 +1,10 @@
 package articles
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"realworld-backend/common"
 	"realworld-backend/users"
@@ -19,13 +22,47 @@ func setupTestDB() *gorm.DB {
 	db.AutoMigrate(&FavoriteModel{})
 	db.AutoMigrate(&TagModel{})
 	db.AutoMigrate(&CommentModel{})
+	db.AutoMigrate(&ArticleRevisionModel{})
+	db.AutoMigrate(&ArticleSlugModel{})
+	db.AutoMigrate(&TagAliasModel{})
+	db.AutoMigrate(&TagFollowModel{})
+	db.AutoMigrate(&CommentEditModel{})
+	db.AutoMigrate(&ReportModel{})
+	db.AutoMigrate(&MentionModel{})
+	db.AutoMigrate(&DigestSubscriptionModel{})
+	db.AutoMigrate(&FeedTokenModel{})
+	db.AutoMigrate(&ArticleImageModel{})
+	db.AutoMigrate(&ReadingListModel{})
+	db.AutoMigrate(&ReadingListItemModel{})
+	db.AutoMigrate(&SeriesModel{})
+	db.AutoMigrate(&SeriesPartModel{})
+	db.AutoMigrate(&ArticleAuthorModel{})
+	db.AutoMigrate(&ReactionModel{})
 	db.AutoMigrate(&users.UserModel{})
 	db.AutoMigrate(&users.FollowModel{})
+	db.AutoMigrate(&common.OutboxModel{})
+	db.AutoMigrate(&common.OutboxReceiptModel{})
 	return db
 }
 
 // Teardown function
 func teardownTestDB(db *gorm.DB) {
+	db.DropTable(&MentionModel{})
+	db.DropTable(&DigestSubscriptionModel{})
+	db.DropTable(&FeedTokenModel{})
+	db.DropTable(&ArticleImageModel{})
+	db.DropTable(&ReadingListModel{})
+	db.DropTable(&ReadingListItemModel{})
+	db.DropTable(&SeriesModel{})
+	db.DropTable(&SeriesPartModel{})
+	db.DropTable(&ArticleAuthorModel{})
+	db.DropTable(&ReactionModel{})
+	db.DropTable(&ReportModel{})
+	db.DropTable(&CommentEditModel{})
+	db.DropTable(&TagFollowModel{})
+	db.DropTable(&TagAliasModel{})
+	db.DropTable(&ArticleSlugModel{})
+	db.DropTable(&ArticleRevisionModel{})
 	db.DropTable(&CommentModel{})
 	db.DropTable(&FavoriteModel{})
 	db.DropTable("article_tags")
@@ -34,6 +71,8 @@ func teardownTestDB(db *gorm.DB) {
 	db.DropTable(&ArticleUserModel{})
 	db.DropTable(&users.FollowModel{})
 	db.DropTable(&users.UserModel{})
+	db.DropTable(&common.OutboxReceiptModel{})
+	db.DropTable(&common.OutboxModel{})
 	db.Close()
 }
 
@@ -552,3 +591,1092 @@ func TestTagUniqueness(t *testing.T) {
 	err2 := db.Create(&tag2).Error
 	asserts.Error(err2, "Duplicate tag creation should fail")
 }
+
+// ==================== REVISION TESTS ====================
+
+// Test 21: Test Article Revisions Are Numbered And Immutable
+func TestArticleRevisions(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Revised Article", "Description", "First body", authorUser.ID)
+
+	first, err := article.saveRevision(db, authorUser)
+	asserts.NoError(err, "Saving first revision should not error")
+	asserts.Equal(uint(1), first.Number, "First revision should be numbered 1")
+
+	err = article.edit(ArticleModel{Body: "Second body"}, authorUser)
+	asserts.NoError(err, "Editing should not error")
+
+	revisions, err := article.getRevisions()
+	asserts.NoError(err, "Getting revisions should not error")
+	asserts.Equal(2, len(revisions), "Article should have 2 revisions")
+	asserts.Equal("First body", revisions[0].Body, "First revision should keep the old body")
+	asserts.Equal("Second body", revisions[1].Body, "Second revision should have the new body")
+	asserts.Equal(author.Username, revisions[0].Author.UserModel.Username, "Revision author should be loaded")
+
+	asserts.Equal(uint(2), revisions[1].Number, "Editing should save revision 2")
+
+	_, err = article.getRevision(3)
+	asserts.Error(err, "Missing revision should return error")
+
+	// Numbers continue after the highest one, even with a gap below
+	db.Unscoped().Delete(&revisions[0])
+	third, err := article.saveRevision(db, authorUser)
+	asserts.NoError(err, "Saving a revision should not error")
+	asserts.Equal(uint(3), third.Number, "Revisions should be numbered after the highest one")
+}
+
+// Test 22: Test Restoring A Revision Creates A New One
+func TestRestoreArticleRevision(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Restored Article", "Description", "Original body", authorUser.ID)
+	article.saveRevision(db, authorUser)
+	article.Update(ArticleModel{Body: "Changed body"})
+	article.saveRevision(db, authorUser)
+
+	first, _ := article.getRevision(1)
+	var updates, updatesBefore int
+	db.Model(&common.OutboxModel{}).Where("name = ?", "article.updated").Count(&updatesBefore)
+	restored, err := article.restoreRevision(first, authorUser, false)
+	asserts.NoError(err, "Restoring should not error")
+	db.Model(&common.OutboxModel{}).Where("name = ?", "article.updated").Count(&updates)
+	asserts.Equal(updatesBefore+1, updates, "Restoring should publish ArticleUpdated")
+	asserts.Equal(uint(3), restored.Number, "Restoring should append a new revision")
+	asserts.Equal("Original body", restored.Body, "Restored revision should carry the old body")
+
+	var reloaded ArticleModel
+	db.Where("id = ?", article.ID).First(&reloaded)
+	asserts.Equal("Original body", reloaded.Body, "Article body should be restored")
+
+	second, _ := article.getRevision(2)
+	asserts.Equal("Changed body", second.Body, "Older revisions should stay untouched")
+}
+
+// ==================== SLUG TESTS ====================
+
+// Test 23: Test Unique Slug Generation
+func TestUniqueSlug(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+
+	asserts.Equal("same-title", uniqueSlug("Same Title", 0), "Free slug should be used as is")
+	first := createTestArticle(db, "Same Title", "Description", "Body", authorUser.ID)
+	asserts.Equal("same-title-2", uniqueSlug("Same Title", 0), "Taken slug should get a suffix")
+	asserts.Equal("same-title", uniqueSlug("Same Title", first.ID), "An article should keep its own slug")
+	asserts.Equal("article", uniqueSlug("!!!!", 0), "Title without letters should still get a slug")
+
+	// Slugs of deleted articles stay taken
+	DeleteArticleModel(&ArticleModel{Slug: first.Slug})
+	asserts.Equal("same-title-2", uniqueSlug("Same Title", 0), "Deleted article slug should stay taken")
+}
+
+// Test 24: Test Slug History Resolves Old Slugs
+func TestSlugHistory(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Old Title", "Description", "Body", authorUser.ID)
+
+	article.Update(ArticleModel{Slug: "new-title"})
+	err := article.keepSlugHistory("old-title")
+	asserts.NoError(err, "Keeping slug history should not error")
+
+	current, err := FindCurrentSlug("old-title")
+	asserts.NoError(err, "Old slug should resolve")
+	asserts.Equal("new-title", current, "Old slug should resolve to the current slug")
+	asserts.Equal("old-title-2", uniqueSlug("Old Title", 0), "Old slug should not be reused by another article")
+	asserts.Equal("old-title", uniqueSlug("Old Title", article.ID), "Article may take back its old slug")
+
+	// Renaming back drops the slug from the history
+	article.Update(ArticleModel{Slug: "old-title"})
+	article.keepSlugHistory("new-title")
+	_, err = FindCurrentSlug("old-title")
+	asserts.Error(err, "Current slug should not be in the history")
+	current, _ = FindCurrentSlug("new-title")
+	asserts.Equal("old-title", current, "Previous slug should resolve after renaming back")
+}
+
+// Test 25: Test Excerpts Of Long Bodies
+func TestExcerpt(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.Equal("short body", excerpt("short   body", 20), "Short bodies should be kept, whitespace collapsed")
+	asserts.Equal("a long…", excerpt("a long body of text", 10), "Long bodies should be cut at a word boundary")
+	asserts.Equal("ééé…", excerpt("éééééé", 3), "Excerpt should count characters, not bytes")
+}
+
+// ==================== TRASH TESTS ====================
+
+// Test 26: Test Deleting And Restoring An Article Cascades
+func TestDeleteAndRestoreArticleCascade(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	reader := createTestUser(db, "reader", "reader@test.com")
+	readerUser := GetArticleUserModel(reader)
+	article := createTestArticle(db, "Trashed Article", "Description", "Body", authorUser.ID)
+	article.favoriteBy(readerUser)
+
+	kept := CommentModel{ArticleID: article.ID, AuthorID: readerUser.ID, Body: "Kept comment"}
+	removed := CommentModel{ArticleID: article.ID, AuthorID: readerUser.ID, Body: "Removed comment"}
+	db.Create(&kept)
+	db.Create(&removed)
+	DeleteCommentModel([]uint{removed.ID})
+
+	err := DeleteArticleModel(&ArticleModel{Slug: article.Slug})
+	asserts.NoError(err, "Deleting article should not error")
+	asserts.Equal(uint(0), article.favoritesCount(), "Favorites should be deleted with the article")
+	var count int
+	db.Model(&CommentModel{}).Where("article_id = ?", article.ID).Count(&count)
+	asserts.Equal(0, count, "Comments should be deleted with the article")
+
+	deleted, _ := FindDeletedArticles(authorUser)
+	asserts.Equal(1, len(deleted), "Deleted article should be in the author's trash")
+	comments, _ := FindDeletedComments(readerUser)
+	asserts.Equal(0, len(comments), "Comments of a deleted article should not be in the trash")
+
+	err = RestoreArticleModel(deleted[0])
+	asserts.NoError(err, "Restoring article should not error")
+	asserts.Equal(uint(1), article.favoritesCount(), "Favorites should come back with the article")
+	db.Model(&CommentModel{}).Where("article_id = ?", article.ID).Count(&count)
+	asserts.Equal(1, count, "Only comments deleted with the article should come back")
+
+	comments, _ = FindDeletedComments(readerUser)
+	asserts.Equal(1, len(comments), "Separately deleted comment should stay in the trash")
+	asserts.Equal(article.Slug, comments[0].Article.Slug, "Trashed comment should know its article")
+}
+
+// Test 27: Test Purging The Trash
+func TestPurgeTrash(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Purged Article", "Description", "Body", authorUser.ID)
+	article.setTags([]string{"purged"})
+	db.Save(&article)
+	db.Create(&CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Comment"})
+	fresh := createTestArticle(db, "Fresh Article", "Description", "Body", authorUser.ID)
+
+	DeleteArticleModel(&ArticleModel{Slug: article.Slug})
+	err := PurgeTrash(time.Now().Add(-time.Hour))
+	asserts.NoError(err, "Purging should not error")
+	var count int
+	db.Unscoped().Model(&ArticleModel{}).Where("id = ?", article.ID).Count(&count)
+	asserts.Equal(1, count, "Recently deleted article should not be purged")
+
+	DeleteArticleModel(&ArticleModel{Slug: fresh.Slug})
+	err = PurgeTrash(time.Now().Add(time.Second))
+	asserts.NoError(err, "Purging should not error")
+	db.Unscoped().Model(&ArticleModel{}).Count(&count)
+	asserts.Equal(0, count, "Old deleted articles should be purged")
+	db.Unscoped().Model(&CommentModel{}).Count(&count)
+	asserts.Equal(0, count, "Comments of purged articles should be purged")
+	db.Table("article_tags").Count(&count)
+	asserts.Equal(0, count, "Tag links of purged articles should be purged")
+}
+
+// ==================== TAG MANAGEMENT TESTS ====================
+
+// Test 28: Test Tag Names Are Normalized
+func TestSetTagsNormalizes(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Normalized Tags", "Description", "Body", authorUser.ID)
+
+	err := article.setTags([]string{"Go", " go ", "GO", "Web  Dev", ""})
+	asserts.NoError(err, "Setting tags should not error")
+	asserts.Equal(2, len(article.Tags), "Near duplicate tags should collapse")
+	asserts.Equal("go", article.Tags[0].Tag, "Tags should be lower case")
+	asserts.Equal("web-dev", article.Tags[1].Tag, "Words should be joined by dashes")
+}
+
+// Test 29: Test Tag Counts And Sorting
+func TestFindTagCounts(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	for i, tags := range [][]string{{"b", "a"}, {"b"}, {"b", "c"}} {
+		article := createTestArticle(db, fmt.Sprintf("Tagged Article %v", i), "Description", "Body", authorUser.ID)
+		article.setTags(tags)
+		db.Save(&article)
+	}
+	deleted := createTestArticle(db, "Deleted Tagged Article", "Description", "Body", authorUser.ID)
+	deleted.setTags([]string{"a", "d"})
+	db.Save(&deleted)
+	DeleteArticleModel(&ArticleModel{Slug: deleted.Slug})
+
+	counts, err := FindTagCounts("", 0)
+	asserts.NoError(err, "Counting tags should not error")
+	asserts.Equal(3, len(counts), "Tags only used by deleted articles should not be listed")
+	asserts.Equal("a", counts[0].Tag, "Tags should be sorted by name by default")
+	asserts.Equal(1, counts[0].ArticlesCount, "Deleted articles should not be counted")
+
+	counts, _ = FindTagCounts("popular", 2)
+	asserts.Equal(2, len(counts), "Limit should be applied")
+	asserts.Equal("b", counts[0].Tag, "Popular sort should put the most used tag first")
+	asserts.Equal(3, counts[0].ArticlesCount, "Count should match the number of articles")
+}
+
+// Test 30: Test Renaming And Merging Tags
+func TestRenameAndMergeTags(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	both := createTestArticle(db, "Both Tags", "Description", "Body", authorUser.ID)
+	both.setTags([]string{"go", "golang"})
+	db.Save(&both)
+	one := createTestArticle(db, "One Tag", "Description", "Body", authorUser.ID)
+	one.setTags([]string{"golang"})
+	db.Save(&one)
+
+	golang, _ := FindOneTag("golang")
+	golang, err := RenameTag(golang, "Go Lang")
+	asserts.NoError(err, "Renaming should not error")
+	asserts.Equal("go-lang", golang.Tag, "Renamed tag should be normalized")
+	found, _ := FindOneTag("golang")
+	asserts.Equal(golang.ID, found.ID, "Old name should resolve to the renamed tag")
+
+	goTag, _ := FindOneTag("go")
+	_, err = RenameTag(golang, "go")
+	asserts.Error(err, "Renaming onto an existing tag should fail")
+
+	err = MergeTags(golang, goTag)
+	asserts.NoError(err, "Merging should not error")
+	counts, _ := FindTagCounts("", 0)
+	asserts.Equal(1, len(counts), "Only the merged tag should be left")
+	asserts.Equal(2, counts[0].ArticlesCount, "Merged tag should have every article once")
+
+	found, _ = FindOneTag("golang")
+	asserts.Equal(goTag.ID, found.ID, "Aliases should follow the merge")
+	one.setTags([]string{"go-lang"})
+	asserts.Equal(goTag.ID, one.Tags[0].ID, "Writing a merged name should use the target tag")
+
+	db.Create(&TagModel{Tag: "unused"})
+	deletedCount, err := DeleteUnusedTags()
+	asserts.NoError(err, "Deleting unused tags should not error")
+	asserts.Equal(int64(1), deletedCount, "Only the unused tag should be deleted")
+
+	// A failed step rolls the whole rename back
+	db.DropTable(&TagAliasModel{})
+	defer db.AutoMigrate(&TagAliasModel{})
+	_, err = RenameTag(goTag, "Gopher")
+	asserts.Error(err, "Renaming without the alias table should fail")
+	found, err = FindOneTag("go")
+	asserts.NoError(err, "Tag should keep its name after a failed rename")
+	asserts.Equal(goTag.ID, found.ID, "Tag should be left as it was")
+}
+
+// ==================== FEED TESTS ====================
+
+// Test 31: Test Feed Of Followed Authors And Tags
+func TestArticleFeedWithTags(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	reader := createTestUser(db, "reader", "reader@test.com")
+	readerUser := GetArticleUserModel(reader)
+	followed := createTestUser(db, "followed", "followed@test.com")
+	followedUser := GetArticleUserModel(followed)
+	stranger := createTestUser(db, "stranger", "stranger@test.com")
+	strangerUser := GetArticleUserModel(stranger)
+	db.Create(&users.FollowModel{FollowingID: followed.ID, FollowedByID: reader.ID})
+
+	byFollowed := createTestArticle(db, "By Followed", "Description", "Body", followedUser.ID)
+	byFollowed.setTags([]string{"go"})
+	db.Save(&byFollowed)
+	tagged := createTestArticle(db, "Tagged By Stranger", "Description", "Body", strangerUser.ID)
+	tagged.setTags([]string{"go"})
+	db.Save(&tagged)
+	createTestArticle(db, "Untagged By Stranger", "Description", "Body", strangerUser.ID)
+
+	models, count, err := readerUser.GetArticleFeed("", "", false)
+	asserts.NoError(err, "Getting feed should not error")
+	asserts.Equal(1, count, "Feed should count articles of followed authors")
+	asserts.Equal(1, len(models), "Feed should only have articles of followed authors")
+
+	goTag, _ := FindOneTag("go")
+	asserts.False(goTag.isFollowedBy(readerUser), "Tag should not be followed at first")
+	goTag.followedBy(readerUser)
+	asserts.True(goTag.isFollowedBy(readerUser), "Tag should be followed")
+	tags, _ := readerUser.GetFollowedTags()
+	asserts.Equal(1, len(tags), "Followed tags should be listed")
+
+	models, count, err = readerUser.GetArticleFeed("", "", true)
+	asserts.NoError(err, "Getting feed should not error")
+	asserts.Equal(2, count, "Article by a followed author with a followed tag should count once")
+	asserts.Equal(2, len(models), "Feed should mix in articles with followed tags")
+	asserts.Equal("stranger", models[0].Author.UserModel.Username, "Feed should load authors")
+
+	goTag.unFollowedBy(readerUser)
+	asserts.False(goTag.isFollowedBy(readerUser), "Tag should be unfollowed")
+}
+
+// ==================== THREADED COMMENT TESTS ====================
+
+// Test 32: Test Replies Keep Deleted Parents As Tombstones
+func TestThreadedComments(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Threaded Article", "Description", "Body", authorUser.ID)
+
+	root := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Root"}
+	db.Create(&root)
+	reply := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Reply"}
+	asserts.NoError(reply.setParent(root), "Replying to a top level comment should work")
+	db.Create(&reply)
+	lonely := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Lonely"}
+	db.Create(&lonely)
+
+	DeleteCommentModel([]uint{root.ID})
+	DeleteCommentModel([]uint{lonely.ID})
+
+	err := article.getComments()
+	asserts.NoError(err, "Getting comments should not error")
+	asserts.Equal(2, len(article.Comments), "Deleted comment without replies should be dropped")
+	asserts.Equal(root.ID, article.Comments[0].ID, "Deleted parent should be kept")
+	asserts.NotNil(article.Comments[0].DeletedAt, "Deleted parent should be a tombstone")
+	asserts.Equal(1, article.Comments[0].RepliesCount, "Parent should count its reply")
+	asserts.Equal(uint(1), article.Comments[1].Depth, "Reply should be one level deep")
+	asserts.Equal("author", article.Comments[1].Author.UserModel.Username, "Reply author should be loaded")
+}
+
+// Test 33: Test Maximum Reply Depth
+func TestCommentMaxDepth(t *testing.T) {
+	asserts := assert.New(t)
+
+	defaultDepth := MaxCommentDepth
+	MaxCommentDepth = 2
+	defer func() { MaxCommentDepth = defaultDepth }()
+
+	root := CommentModel{}
+	root.ID = 1
+	reply := CommentModel{}
+	asserts.NoError(reply.setParent(root), "First level reply should be allowed")
+	reply.ID = 2
+	nested := CommentModel{}
+	asserts.Error(nested.setParent(reply), "Reply beyond the maximum depth should fail")
+}
+
+// Test 34: Test Editing A Comment Keeps Its History
+func TestCommentEdit(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Edited Comments", "Description", "Body", authorUser.ID)
+	comment := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "First"}
+	db.Create(&comment)
+	createdAt := comment.UpdatedAt
+
+	asserts.NoError(comment.edit("First"), "Editing to the same body should not error")
+	edits, _ := comment.getEdits()
+	asserts.Equal(0, len(edits), "Unchanged body should not be stored as an edit")
+	asserts.Nil(comment.EditedAt, "Unchanged body should not mark the comment edited")
+
+	asserts.NoError(comment.edit("Second"), "Editing should not error")
+	asserts.NoError(comment.edit("Third"), "Editing should not error")
+	asserts.Equal("Third", comment.Body, "Body should be updated")
+	asserts.NotNil(comment.EditedAt, "Comment should be marked edited")
+	asserts.True(comment.UpdatedAt.After(createdAt), "UpdatedAt should move on")
+
+	edits, _ = comment.getEdits()
+	asserts.Equal(2, len(edits), "Each edit should be stored")
+	asserts.Equal("First", edits[0].Body, "Oldest body should come first")
+	asserts.Equal("Second", edits[1].Body, "Previous body should be stored")
+	var updates int
+	db.Model(&common.OutboxModel{}).Where("name = ?", "comment.updated").Count(&updates)
+	asserts.Equal(2, updates, "Each edit should publish CommentUpdated")
+
+	// Without the history the body doesn't change either
+	db.DropTable(&CommentEditModel{})
+	defer db.AutoMigrate(&CommentEditModel{})
+	asserts.Error(comment.edit("Fourth"), "Editing should fail when the history can't be kept")
+	var reloaded CommentModel
+	db.First(&reloaded, comment.ID)
+	asserts.Equal("Third", reloaded.Body, "Body should stay when the history can't be kept")
+}
+
+// ==================== COMMENT PAGINATION TESTS ====================
+
+// Test 35: Test Paging And Sorting Comments
+func TestFindCommentsPaginated(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Paged Comments", "Description", "Body", authorUser.ID)
+	var comments []CommentModel
+	for i := 0; i < 5; i++ {
+		comment := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: fmt.Sprintf("Comment %d", i)}
+		db.Create(&comment)
+		comments = append(comments, comment)
+	}
+	reply := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Reply"}
+	reply.setParent(comments[2])
+	db.Create(&reply)
+
+	count, err := article.findComments(CommentQuery{Limit: 2, Offset: 1})
+	asserts.NoError(err, "Finding comments should not error")
+	asserts.Equal(6, count, "Count should cover every comment")
+	asserts.Equal(2, len(article.Comments), "Page should be limited")
+	asserts.Equal(comments[1].ID, article.Comments[0].ID, "Oldest order should skip the offset")
+	asserts.Equal("author", article.Comments[0].Author.UserModel.Username, "Authors should be loaded")
+
+	article.findComments(CommentQuery{Limit: 1, Sort: "newest"})
+	asserts.Equal(reply.ID, article.Comments[0].ID, "Newest comment should come first")
+
+	article.findComments(CommentQuery{Limit: 1, Sort: "top"})
+	asserts.Equal(comments[2].ID, article.Comments[0].ID, "Most replied comment should come first")
+	asserts.Equal(1, article.Comments[0].RepliesCount, "Replies should be counted")
+
+	count, _ = article.findComments(CommentQuery{Limit: 1, Offset: 2, Tree: true})
+	asserts.Equal(5, count, "Tree count should cover top level comments")
+	asserts.Equal(2, len(article.Comments), "Tree page should include the replies")
+	asserts.Equal(reply.ID, article.Comments[1].ID, "Reply should follow its parent")
+
+	article.findComments(CommentQuery{Limit: 2, Offset: 10})
+	asserts.Equal(0, len(article.Comments), "Offset past the end should be empty")
+	asserts.Equal(uint(6), article.commentsCount(), "commentsCount should count live comments")
+}
+
+// ==================== REPORT TESTS ====================
+
+// Test 36: Test Reports Hide Content At The Threshold
+func TestReportThresholdHides(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	defaultThreshold := ReportHideThreshold
+	ReportHideThreshold = 2
+	defer func() { ReportHideThreshold = defaultThreshold }()
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Reported Article", "Description", "Body", authorUser.ID)
+	readerA := GetArticleUserModel(createTestUser(db, "readera", "readera@test.com"))
+	readerB := GetArticleUserModel(createTestUser(db, "readerb", "readerb@test.com"))
+
+	asserts.NoError(createReport(&ReportModel{ArticleID: article.ID, ReporterID: readerA.ID, Reason: "spam"}), "Reporting should work")
+	asserts.Equal(errAlreadyReported, createReport(&ReportModel{ArticleID: article.ID, ReporterID: readerA.ID, Reason: "spam"}), "Reporting twice should fail")
+	articles, count, _ := FindManyArticle("", "", "20", "0", "", "")
+	asserts.Equal(1, count, "One report should not hide the article")
+
+	report := ReportModel{ArticleID: article.ID, ReporterID: readerB.ID, Reason: "hate"}
+	asserts.NoError(createReport(&report), "Second report should work")
+	articles, count, _ = FindManyArticle("", "", "20", "0", "", "")
+	asserts.Equal(0, count, "Article should be hidden at the threshold")
+	asserts.Equal(0, len(articles), "Hidden article should not be listed")
+	articles, count, _ = FindManyArticle("", "author", "20", "0", "", "")
+	asserts.Equal(0, count, "Hidden article should not be listed by author")
+
+	hidden, _ := FindOneArticle(&ArticleModel{Slug: article.Slug})
+	asserts.True(hidden.Hidden, "Article should be hidden")
+	asserts.True(hidden.visibleTo(author), "Author should still see the article")
+	asserts.False(hidden.visibleTo(readerA.UserModel), "Readers should not see the article")
+
+	moderator := GetArticleUserModel(createTestUser(db, "moderator", "moderator@test.com"))
+	asserts.NoError(report.resolve([]string{ReportDismiss}, moderator, 0), "Dismissing should work")
+	asserts.Equal(ReportDismissed, report.Status, "Report should be dismissed")
+	_, count, _ = FindManyArticle("", "", "20", "0", "", "")
+	asserts.Equal(1, count, "Dismissing should show the article again")
+	_, _, count, _ = FindOpenReports(20, 0)
+	asserts.Equal(0, count, "Every report on the article should be closed")
+}
+
+// Test 37: Test Resolving A Comment Report
+func TestReportResolve(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Reported Comments", "Description", "Body", authorUser.ID)
+	comment := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Buy now"}
+	db.Create(&comment)
+	reader := GetArticleUserModel(createTestUser(db, "reader", "reader@test.com"))
+
+	report := ReportModel{ArticleID: article.ID, CommentID: &comment.ID, ReporterID: reader.ID, Reason: "spam"}
+	asserts.NoError(createReport(&report), "Reporting a comment should work")
+
+	reports, reportsCounts, count, err := FindOpenReports(20, 0)
+	asserts.NoError(err, "Finding open reports should not error")
+	asserts.Equal(1, count, "Report should be open")
+	asserts.Equal(1, reportsCounts[0], "Open reports on the comment should be counted")
+	asserts.Equal("Buy now", reports[0].Comment.Body, "Reported comment should be loaded")
+	asserts.Equal("author", reports[0].Comment.Author.UserModel.Username, "Comment author should be loaded")
+	asserts.Equal("reader", reports[0].Reporter.UserModel.Username, "Reporter should be loaded")
+
+	moderator := GetArticleUserModel(createTestUser(db, "moderator", "moderator@test.com"))
+	asserts.Error(report.resolve([]string{ReportDismiss, ReportHide}, moderator, 0), "Dismiss should not combine")
+	asserts.NoError(report.resolve([]string{ReportDelete, ReportSuspend}, moderator, time.Hour), "Resolving should work")
+	asserts.Equal(ReportResolved, report.Status, "Report should be resolved")
+	asserts.Equal("delete,suspend", report.Action, "Actions should be recorded")
+
+	_, err = article.findComment(comment.ID)
+	asserts.Error(err, "Comment should be deleted")
+	suspended, _ := users.FindOneUser(&users.UserModel{ID: author.ID})
+	asserts.True(suspended.IsSuspended(), "Author should be suspended")
+	asserts.Equal(uint(1), suspended.Warnings, "Suspension should count as a warning")
+}
+
+// ==================== CONTENT FILTER TESTS ====================
+
+// Test 38: Test Duplicates Are Rejected And Quarantine Hides
+func TestDuplicateAndQuarantine(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Filtered Article", "Description", "Body", authorUser.ID)
+	comment := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Me too"}
+	db.Create(&comment)
+
+	filter := duplicateFilter{time.Hour}
+	repost := common.Content{Kind: "comment", Text: "Me too", AuthorID: authorUser.ID}
+	asserts.Equal(common.VerdictReject, filter.Check(repost).Action, "Same comment again should be a duplicate")
+	repost.ID = comment.ID
+	asserts.True(filter.Check(repost).Allowed(), "A comment should not duplicate itself")
+	other := common.Content{Kind: "article", Text: articleText("Filtered Article", "Description", "Body"), AuthorID: authorUser.ID}
+	asserts.Equal(common.VerdictReject, filter.Check(other).Action, "Same article again should be a duplicate")
+	other.Text = articleText("Filtered Article", "Description", "Another body")
+	asserts.True(filter.Check(other).Allowed(), "Different article should not be a duplicate")
+
+	verdict := common.Verdict{Action: common.VerdictQuarantine, Rule: "link-limit", Reason: "Too many links"}
+	asserts.NoError(quarantine(article.ID, &comment.ID, verdict), "Quarantine should work")
+	asserts.NoError(quarantine(article.ID, &comment.ID, verdict), "Quarantine twice should not error")
+	reports, _, count, _ := FindOpenReports(20, 0)
+	asserts.Equal(1, count, "Quarantine should queue one report")
+	asserts.Equal("filter", reports[0].Reason, "Report should come from the filter")
+	asserts.Equal(uint(0), article.commentsCount(), "Quarantined comment should not be counted")
+}
+
+// ==================== MENTION TESTS ====================
+
+// Test 39: Test Parsing And Saving Mentions
+func TestMentions(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	asserts.Equal([]string{"alice", "bob"}, parseMentions("@alice and @bob, thanks @alice! Mail me@example.com"), "Mentions should be found once and e-mails skipped")
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	alice := createTestUser(db, "alice", "alice@test.com")
+	createTestUser(db, "bob", "bob@test.com")
+	article := createTestArticle(db, "Mentioning Article", "Description", "Body", authorUser.ID)
+
+	mentions, added, err := saveMentions(article.ID, nil, "Hi @alice and @nobody", 0)
+	asserts.NoError(err, "Saving mentions should not error")
+	asserts.Equal(1, len(mentions), "Unknown users should not be mentioned")
+	asserts.Equal(alice.ID, added[0].UserID, "New mention should be reported as added")
+
+	mentions, added, _ = saveMentions(article.ID, nil, "Hi @alice and @bob", 0)
+	asserts.Equal(2, len(mentions), "Both users should be mentioned")
+	asserts.Equal(1, len(added), "Only the new mention should be added")
+	asserts.Equal("bob", added[0].Username, "Bob should be the new mention")
+	asserts.Equal(2, len(article.getMentions()), "Article mentions should be stored")
+
+	comment := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "@bob look"}
+	db.Create(&comment)
+	saveMentions(article.ID, &comment.ID, comment.Body, 0)
+	asserts.Equal(2, len(article.getMentions()), "Comment mentions should not count for the article")
+	article.getComments()
+	asserts.Equal("bob", article.Comments[0].Mentions[0].Username, "Comment mentions should be loaded")
+}
+
+// ==================== DIGEST TESTS ====================
+
+// Test 40: Test Digests Go Out Once Per Period With New Articles Only
+func TestSendDigests(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	reader := createTestUser(db, "reader", "reader@test.com")
+	readerUser := GetArticleUserModel(reader)
+	followed := createTestUser(db, "followed", "followed@test.com")
+	followedUser := GetArticleUserModel(followed)
+	stranger := createTestUser(db, "stranger", "stranger@test.com")
+	strangerUser := GetArticleUserModel(stranger)
+	db.Create(&users.FollowModel{FollowingID: followed.ID, FollowedByID: reader.ID})
+	createTestArticle(db, "By Followed", "Worth a read", "Body", followedUser.ID)
+	createTestArticle(db, "By Stranger", "Description", "Body", strangerUser.ID)
+	hidden := createTestArticle(db, "Hidden By Followed", "Description", "Body", followedUser.ID)
+	db.Model(&hidden).Update("hidden", true)
+
+	mailer := &common.MemoryMailer{}
+	now := time.Now()
+	sent, err := SendDigests(mailer, now)
+	asserts.NoError(err, "Sending digests should not error")
+	asserts.Equal(0, sent, "Nothing should be sent without subscriptions")
+
+	subscription, _ := readerUser.setDigest(DigestDaily)
+	asserts.Equal(DigestDaily, readerUser.getDigest().Frequency, "Subscription should be saved")
+	sent, _ = SendDigests(mailer, now)
+	asserts.Equal(1, sent, "Due digest should be sent")
+	messages := mailer.Messages()
+	asserts.Equal("reader@test.com", messages[0].To, "Digest should go to the subscriber")
+	asserts.Equal("1 new article from authors you follow", messages[0].Subject, "Subject should count new articles")
+	asserts.Contains(messages[0].Text, "By Followed by followed", "Text should list the article")
+	asserts.Contains(messages[0].HTML, "Worth a read", "HTML should show the description")
+	asserts.NotContains(messages[0].Text, "Stranger", "Articles of other authors should be left out")
+	asserts.NotContains(messages[0].Text, "Hidden", "Hidden articles should be left out")
+	asserts.Contains(messages[0].Headers["List-Unsubscribe"], "/api/digest/unsubscribe?token=", "Digest should carry an unsubscribe link")
+
+	sent, _ = SendDigests(mailer, now.Add(time.Hour))
+	asserts.Equal(0, sent, "Digest should not be sent twice within a day")
+	sent, _ = SendDigests(mailer, now.Add(25*time.Hour))
+	asserts.Equal(0, sent, "Digest should not be sent without new articles")
+
+	later := createTestArticle(db, "Later By Followed", "Description", "Body", followedUser.ID)
+	db.Model(&later).Update("created_at", now.Add(time.Hour))
+	sent, _ = SendDigests(mailer, now.Add(25*time.Hour))
+	asserts.Equal(1, sent, "Digest should be sent once there is something new")
+	asserts.Contains(mailer.Messages()[1].Text, "Later By Followed", "Digest should list the new article")
+	asserts.NotContains(mailer.Messages()[1].Text, "\nBy Followed by followed", "Digest should not repeat what was sent")
+
+	db.First(&subscription, subscription.ID)
+	asserts.WithinDuration(now.Add(25*time.Hour), *subscription.LastSentAt, time.Second, "Last sent time should be tracked")
+	readerUser.setDigest(DigestOff)
+	sent, _ = SendDigests(mailer, now.Add(30*24*time.Hour))
+	asserts.Equal(0, sent, "Digest should not be sent once turned off")
+}
+
+// ==================== SYNDICATION TESTS ====================
+
+// Test 41: Test Feed Tokens And The RSS Feed
+func TestFeedTokensAndRSS(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	reader := createTestUser(db, "reader", "reader@test.com")
+	readerUser := GetArticleUserModel(reader)
+	_, err := readerUser.getFeedToken()
+	asserts.Error(err, "There should be no feed token at first")
+
+	feedToken, err := readerUser.resetFeedToken()
+	asserts.NoError(err, "Creating a feed token should not error")
+	asserts.Equal(48, len(feedToken.Token), "Feed token should be random hex")
+	found, err := FindFeedTokenUser(feedToken.Token)
+	asserts.NoError(err, "Feed token should be found")
+	asserts.Equal("reader", found.UserModel.Username, "Feed token should belong to its user")
+
+	rotated, _ := readerUser.resetFeedToken()
+	asserts.NotEqual(feedToken.Token, rotated.Token, "Resetting should make a new token")
+	_, err = FindFeedTokenUser(feedToken.Token)
+	asserts.Error(err, "Old token should stop working")
+	asserts.NoError(readerUser.revokeFeedToken(), "Revoking should not error")
+	_, err = FindFeedTokenUser(rotated.Token)
+	asserts.Error(err, "Revoked token should stop working")
+	_, err = FindFeedTokenUser("")
+	asserts.Error(err, "Empty token should not match")
+
+	older := createTestArticle(db, "Older & Wiser", "First <one>", "Body", readerUser.ID)
+	db.Model(&older).Update("created_at", time.Now().Add(-time.Hour))
+	createTestArticle(db, "Newer", "Second", "Body", readerUser.ID)
+	models, _, _ := FindManyArticle("", "", "", "", "", "")
+	asserts.Equal("Newer", models[0].Title, "Articles should be listed newest first")
+
+	serializer := SyndicationSerializer{Title: "Conduit", Link: "http://localhost/", Articles: models}
+	asserts.Equal(models[0].UpdatedAt, serializer.LastModified(), "Last modified should be the newest update")
+	body, err := serializer.RSS()
+	asserts.NoError(err, "Rendering RSS should not error")
+	rss := string(body)
+	asserts.Contains(rss, `<rss version="2.0">`, "Feed should be RSS 2.0")
+	asserts.Contains(rss, "<title>Older &amp; Wiser</title>", "Titles should be escaped")
+	asserts.Contains(rss, "<description>First &lt;one&gt;</description>", "Descriptions should be escaped")
+	asserts.Contains(rss, "/article/"+older.Slug+"</link>", "Items should link to the article")
+	asserts.Less(strings.Index(rss, "Newer"), strings.Index(rss, "Older"), "Items should be newest first")
+}
+
+// ==================== SEO TESTS ====================
+
+// Test 42: Test Sitemap Entries Span Articles, Profiles And Tags
+func TestSitemapEntries(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	lurker := createTestUser(db, "lurker", "lurker@test.com")
+	GetArticleUserModel(lurker)
+	first := createTestArticle(db, "First Article", "Description", "Body", authorUser.ID)
+	first.setTags([]string{"go"})
+	db.Save(&first)
+	hidden := createTestArticle(db, "Hidden Article", "Description", "Body", authorUser.ID)
+	hidden.setTags([]string{"secret"})
+	hidden.Hidden = true
+	db.Save(&hidden)
+
+	count, lastModified, err := CountSitemapEntries()
+	asserts.NoError(err, "Counting sitemap entries should not error")
+	asserts.Equal(3, count, "Sitemap should have the visible article, its author and its tag")
+	asserts.WithinDuration(first.UpdatedAt, lastModified, time.Second, "Last modified should be the newest visible article")
+
+	entries, err := FindSitemapEntries(0, 10)
+	asserts.NoError(err, "Finding sitemap entries should not error")
+	asserts.Equal(3, len(entries), "Every entry should be found")
+	asserts.Equal("/article/"+first.Slug, entries[0].Path, "Articles should come first")
+	asserts.NotNil(entries[0].LastModified, "Articles should know when they changed")
+	asserts.Equal("/profile/author", entries[1].Path, "Authors should follow")
+	asserts.Nil(entries[1].LastModified, "Profiles have no modification time")
+	asserts.Equal("/?tag=go", entries[2].Path, "Tags should come last")
+
+	entries, _ = FindSitemapEntries(1, 1)
+	asserts.Equal(1, len(entries), "Pages should be limited")
+	asserts.Equal("/profile/author", entries[0].Path, "Offset should carry over sections")
+	entries, _ = FindSitemapEntries(3, 10)
+	asserts.Equal(0, len(entries), "Past the end there should be nothing")
+
+	asserts.Equal("https://img.test/a.png", articleImage("Intro\n\n![cover](https://img.test/a.png)"), "Absolute images should be found")
+	asserts.Equal(common.AppURL+"/a.png", articleImage("![](/a.png)"), "Relative images should be made absolute")
+	asserts.Equal("", articleImage("![x](javascript:alert(1)) no images"), "Other links should be skipped")
+}
+
+// Test 43: Test Reading Lists Keep Their Order And Stay Private
+func TestReadingLists(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	reader := GetArticleUserModel(createTestUser(db, "reader", "reader@test.com"))
+	other := GetArticleUserModel(createTestUser(db, "other", "other@test.com"))
+	first := createTestArticle(db, "First Article", "Description", "Body", authorUser.ID)
+	second := createTestArticle(db, "Second Article", "Description", "Body", authorUser.ID)
+	third := createTestArticle(db, "Third Article", "Description", "Body", authorUser.ID)
+
+	list, err := reader.createReadingList("Later")
+	asserts.NoError(err, "Creating a list should not error")
+	_, err = reader.createReadingList("Later")
+	asserts.Equal(errReadingListName, err, "Names should be unique per user")
+	_, err = other.createReadingList("Later")
+	asserts.NoError(err, "Others can use the same name")
+
+	for _, article := range []ArticleModel{first, second, third, first} {
+		asserts.NoError(list.addArticle(article), "Adding articles should not error")
+	}
+	asserts.Equal(3, list.articlesCount(), "Articles should be in a list once")
+	asserts.True(first.isBookmarkedBy(reader), "Saved articles should be bookmarked")
+	asserts.False(first.isBookmarkedBy(other), "Lists should be private")
+
+	slugs := func() []string {
+		models, _, _ := FindManyArticle("", "", "20", "0", "", fmt.Sprint(list.ID))
+		var slugs []string
+		for _, model := range models {
+			slugs = append(slugs, model.Slug)
+		}
+		return slugs
+	}
+	asserts.Equal([]string{first.Slug, second.Slug, third.Slug}, slugs(), "Lists should keep the order articles were added in")
+	asserts.NoError(list.reorder([]string{third.Slug}), "Reordering should not error")
+	asserts.Equal([]string{third.Slug, first.Slug, second.Slug}, slugs(), "Reordered articles should come first")
+	asserts.Error(list.reorder([]string{"missing"}), "Articles outside the list can't be ordered")
+
+	asserts.NoError(list.removeArticle(third), "Removing should not error")
+	asserts.Equal([]string{first.Slug, second.Slug}, slugs(), "Removed articles should be gone")
+	asserts.NoError(list.delete(), "Deleting the list should not error")
+	asserts.False(first.isBookmarkedBy(reader), "Articles of deleted lists aren't bookmarked")
+	_, err = reader.findReadingList(fmt.Sprint(list.ID))
+	asserts.Error(err, "Deleted lists should be gone")
+}
+
+// Test 44: Test Series Keep Their Parts In Order
+func TestSeries(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	reader := createTestUser(db, "reader", "reader@test.com")
+	first := createTestArticle(db, "Part One", "Description", "Body", authorUser.ID)
+	second := createTestArticle(db, "Part Two", "Description", "Body", authorUser.ID)
+	third := createTestArticle(db, "Part Three", "Description", "Body", authorUser.ID)
+
+	series := SeriesModel{Slug: uniqueSeriesSlug("Go Basics", 0), Title: "Go Basics", AuthorID: authorUser.ID}
+	asserts.NoError(SaveOne(&series), "Creating a series should not error")
+	asserts.Equal("go-basics-2", uniqueSeriesSlug("Go Basics", 0), "Series slugs should be unique")
+	asserts.Equal("go-basics", uniqueSeriesSlug("Go Basics", series.ID), "A series keeps its own slug")
+	other := SeriesModel{Slug: "other", Title: "Other", AuthorID: authorUser.ID}
+	SaveOne(&other)
+
+	for _, article := range []ArticleModel{first, second, third, first} {
+		asserts.NoError(series.addArticle(article), "Adding parts should not error")
+	}
+	asserts.Equal(errArticleInSeries, other.addArticle(first), "An article is part of one series only")
+	asserts.NoError(series.reorder([]string{second.Slug}), "Reordering should not error")
+	parts, _ := series.getArticles()
+	asserts.Equal([]uint{second.ID, first.ID, third.ID}, []uint{parts[0].ID, parts[1].ID, parts[2].ID}, "Reordered parts should come first")
+
+	found, parts, err := first.getSeries()
+	asserts.NoError(err, "Finding the series of a part should not error")
+	asserts.Equal(series.ID, found.ID, "The part should know its series")
+	info := articleSeriesResponse(found, parts, first.ID)
+	asserts.Equal(2, info.Position, "Positions should count from 1")
+	asserts.Equal(second.Slug, *info.Prev, "Prev should be the part before")
+	asserts.Equal(third.Slug, *info.Next, "Next should be the part after")
+
+	third.Hidden = true
+	db.Save(&third)
+	_, parts, _ = first.getSeries()
+	info = articleSeriesResponse(found, visibleParts(parts, reader), first.ID)
+	asserts.Nil(info.Next, "Hidden parts should be skipped")
+	asserts.Equal(2, info.PartsCount, "Hidden parts shouldn't be counted")
+	asserts.Nil(articleSeriesResponse(found, visibleParts(parts, reader), third.ID), "Hidden parts have no place in the series")
+
+	asserts.NoError(series.removeArticle(second), "Removing a part should not error")
+	_, _, err = second.getSeries()
+	asserts.Error(err, "Removed parts should have no series")
+	asserts.NoError(series.delete(), "Deleting the series should not error")
+	_, _, err = first.getSeries()
+	asserts.Error(err, "Parts of a deleted series should be free")
+	asserts.NoError(other.addArticle(first), "Freed articles can join another series")
+}
+
+// Test 45: Test Co-Authors Join By Invitation
+func TestCoauthors(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	owner := createTestUser(db, "owner", "owner@test.com")
+	ownerUser := GetArticleUserModel(owner)
+	coauthor := createTestUser(db, "coauthor", "coauthor@test.com")
+	coauthorUser := GetArticleUserModel(coauthor)
+	article := createTestArticle(db, "Written Together", "Description", "Body", ownerUser.ID)
+	article, _ = FindOneArticle(&ArticleModel{Slug: article.Slug})
+
+	_, err := article.invite(ownerUser, ownerUser)
+	asserts.Equal(errInviteAuthor, err, "The owner can't be invited")
+	invitation, err := article.invite(coauthorUser, ownerUser)
+	asserts.NoError(err, "Inviting should not error")
+	_, err = article.invite(coauthorUser, ownerUser)
+	asserts.Equal(errAlreadyInvited, err, "Users are invited once")
+	asserts.False(article.hasAuthor(coauthor), "Invited users aren't authors yet")
+	_, count, _ := FindManyArticle("", "coauthor", "20", "0", "", "")
+	asserts.Equal(0, count, "Invitations don't list the article under the invitee")
+
+	invitations, _ := coauthorUser.getInvitations()
+	asserts.Equal(1, len(invitations), "The invitee should see the invitation")
+	asserts.Equal(article.Slug, invitations[0].Article.Slug, "Invitations should come with their article")
+	found, err := coauthorUser.findInvitation(fmt.Sprint(invitation.ID))
+	asserts.NoError(err, "The invitee should find the invitation")
+	_, err = ownerUser.findInvitation(fmt.Sprint(invitation.ID))
+	asserts.Error(err, "Others can't answer the invitation")
+	asserts.NoError(found.accept(), "Accepting should not error")
+
+	asserts.True(article.hasAuthor(coauthor), "Accepted invitations make co-authors")
+	asserts.True(article.hasAuthor(owner), "The owner stays an author")
+	coauthors, _ := article.getCoauthors()
+	asserts.Equal(1, len(coauthors), "The co-author should be listed")
+	asserts.Equal("coauthor", coauthors[0].UserModel.Username, "Co-authors come with their users")
+	models, count, _ := FindManyArticle("", "coauthor", "20", "0", "", "")
+	asserts.Equal(1, count, "Co-authored articles are listed under the co-author")
+	asserts.Equal(article.ID, models[0].ID, "The co-authored article should be found")
+	_, err = article.invite(coauthorUser, ownerUser)
+	asserts.Equal(errInviteAuthor, err, "Co-authors can't be invited again")
+
+	asserts.NoError(article.removeAuthor(coauthorUser), "Removing a co-author should not error")
+	asserts.False(article.hasAuthor(coauthor), "Removed co-authors lose their rights")
+	invitation, _ = article.invite(coauthorUser, ownerUser)
+	asserts.NoError(invitation.decline(), "Declining should not error")
+	invitations, _ = coauthorUser.getInvitations()
+	asserts.Equal(0, len(invitations), "Declined invitations are gone")
+}
+
+// Test 46: Test Reactions Toggle And Load For A Whole Page
+func TestReactions(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	authorUser := GetArticleUserModel(createTestUser(db, "author", "author@test.com"))
+	reader := GetArticleUserModel(createTestUser(db, "reader", "reader@test.com"))
+	other := GetArticleUserModel(createTestUser(db, "other", "other@test.com"))
+	first := createTestArticle(db, "First Article", "Description", "Body", authorUser.ID)
+	second := createTestArticle(db, "Second Article", "Description", "Body", authorUser.ID)
+	comment := CommentModel{ArticleID: first.ID, AuthorID: authorUser.ID, Body: "A comment"}
+	db.Create(&comment)
+
+	on, err := toggleReaction(first.ID, nil, reader, "like")
+	asserts.NoError(err, "Reacting should not error")
+	asserts.True(on, "The first toggle should leave the reaction")
+	toggleReaction(first.ID, nil, other, "like")
+	toggleReaction(first.ID, nil, reader, "love")
+	toggleReaction(second.ID, nil, other, "laugh")
+	toggleReaction(first.ID, &comment.ID, reader, "hooray")
+	on, _ = toggleReaction(first.ID, nil, reader, "love")
+	asserts.False(on, "The second toggle should take the reaction back")
+	err = db.Create(&ReactionModel{ArticleID: first.ID, UserID: reader.ID, Reaction: "like"}).Error
+	asserts.True(common.IsUniqueViolation(err), "A reaction should only be left once on the article")
+	err = db.Create(&ReactionModel{ArticleID: first.ID, CommentID: comment.ID, UserID: reader.ID, Reaction: "hooray"}).Error
+	asserts.True(common.IsUniqueViolation(err), "A reaction should only be left once on the comment")
+
+	summaries := articleReactions([]uint{first.ID, second.ID}, reader)
+	asserts.Equal(map[string]int{"like": 2}, summaries[first.ID].Counts, "Reactions should be counted per article")
+	asserts.Equal(map[string]bool{"like": true}, summaries[first.ID].Mine, "The reader's own reactions should be marked")
+	asserts.Equal(map[string]int{"laugh": 1}, summaries[second.ID].Counts, "Every article of the page should be summarized")
+	asserts.Empty(summaries[second.ID].Mine, "Reactions of others aren't the reader's")
+	asserts.Empty(articleReactions([]uint{first.ID}, ArticleUserModel{})[first.ID].Mine, "Anonymous readers have no reactions")
+
+	comments := commentReactions([]uint{comment.ID}, reader)
+	asserts.Equal(map[string]int{"hooray": 1}, comments[comment.ID].Counts, "Comment reactions should be kept apart")
+	asserts.True(comments[comment.ID].Mine["hooray"], "The reader's comment reaction should be marked")
+
+	counts, mine := reactionsResponse(summaries[first.ID])
+	asserts.Equal(len(Reactions), len(counts), "Every reaction should be in the response")
+	asserts.Equal(0, counts["love"], "Reactions taken back count 0")
+	asserts.Equal([]string{"like"}, mine, "Own reactions follow the configured order")
+	asserts.True(validReaction("like"), "Configured reactions are valid")
+	asserts.False(validReaction("angry"), "Other reactions are not")
+}
+
+// Test 47: Test Purging Keeps Deleted Comments Which Still Have Replies
+func TestPurgeTrashKeepsRepliedComments(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := createTestUser(db, "author", "author@test.com")
+	authorUser := GetArticleUserModel(author)
+	article := createTestArticle(db, "Threaded Article", "Description", "Body", authorUser.ID)
+	parent := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Parent"}
+	db.Create(&parent)
+	middle := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Middle", ParentID: &parent.ID}
+	db.Create(&middle)
+	reply := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Reply", ParentID: &middle.ID}
+	db.Create(&reply)
+	lonely := CommentModel{ArticleID: article.ID, AuthorID: authorUser.ID, Body: "Lonely"}
+	db.Create(&lonely)
+
+	DeleteCommentModel([]uint{parent.ID, middle.ID, lonely.ID})
+	err := PurgeTrash(time.Now().Add(time.Second))
+	asserts.NoError(err, "Purging should not error")
+	var count int
+	db.Unscoped().Model(&CommentModel{}).Where("id in (?)", []uint{parent.ID, middle.ID}).Count(&count)
+	asserts.Equal(2, count, "Deleted comments leading to a live reply should be kept")
+	db.Unscoped().Model(&CommentModel{}).Where("id = ?", lonely.ID).Count(&count)
+	asserts.Equal(0, count, "Deleted comments without replies should be purged")
+
+	DeleteCommentModel([]uint{reply.ID})
+	PurgeTrash(time.Now().Add(time.Second))
+	db.Unscoped().Model(&CommentModel{}).Where("article_id = ?", article.ID).Count(&count)
+	asserts.Equal(0, count, "The whole thread should be purged once every reply is deleted")
+}
+
+// Test 48: Test Article Extras Load For A Whole Page
+func TestLoadArticleExtras(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	ownerUser := GetArticleUserModel(createTestUser(db, "owner", "owner@test.com"))
+	coauthorUser := GetArticleUserModel(createTestUser(db, "coauthor", "coauthor@test.com"))
+	reader := GetArticleUserModel(createTestUser(db, "reader", "reader@test.com"))
+	first := createTestArticle(db, "First Article", "Description", "Body", ownerUser.ID)
+	second := createTestArticle(db, "Second Article", "Description", "Body", ownerUser.ID)
+	lonely := createTestArticle(db, "Lonely Article", "Description", "Body", ownerUser.ID)
+
+	db.Create(&CommentModel{ArticleID: first.ID, AuthorID: reader.ID, Body: "One"})
+	db.Create(&CommentModel{ArticleID: first.ID, AuthorID: reader.ID, Body: "Two"})
+	db.Create(&CommentModel{ArticleID: second.ID, AuthorID: reader.ID, Body: "Three"})
+	list, _ := reader.createReadingList("Later")
+	list.addArticle(second)
+	series := SeriesModel{Slug: "pair", Title: "Pair", AuthorID: ownerUser.ID}
+	SaveOne(&series)
+	series.addArticle(first)
+	series.addArticle(second)
+	invitation, _ := first.invite(coauthorUser, ownerUser)
+	invitation.accept()
+	db.Create(&MentionModel{ArticleID: second.ID, UserID: reader.UserModelID, Username: "reader"})
+
+	extras := loadArticleExtras([]uint{first.ID, second.ID, lonely.ID}, reader)
+	asserts.Equal(uint(2), extras[first.ID].CommentsCount, "Comments should be counted per article")
+	asserts.Equal(uint(1), extras[second.ID].CommentsCount, "Comments should be counted per article")
+	asserts.Equal(uint(0), extras[lonely.ID].CommentsCount, "Articles without comments count 0")
+	asserts.False(extras[first.ID].Bookmarked, "Only saved articles are bookmarked")
+	asserts.True(extras[second.ID].Bookmarked, "Saved articles should be bookmarked")
+	asserts.Equal(series.ID, extras[second.ID].Series.ID, "Parts should know their series")
+	asserts.Equal([]uint{first.ID, second.ID}, []uint{extras[second.ID].SeriesParts[0].ID, extras[second.ID].SeriesParts[1].ID}, "Parts should come in order")
+	asserts.Equal(uint(0), extras[lonely.ID].Series.ID, "Articles outside a series have none")
+	asserts.Equal(1, len(extras[first.ID].Coauthors), "Co-authors should be loaded per article")
+	asserts.Equal("coauthor", extras[first.ID].Coauthors[0].UserModel.Username, "Co-authors come with their users")
+	asserts.Equal(0, len(extras[second.ID].Coauthors), "Articles without co-authors have none")
+	asserts.Equal(1, len(extras[second.ID].Mentions), "Mentions should be loaded per article")
+	asserts.Equal(0, len(extras[first.ID].Mentions), "Articles without mentions have none")
+}
+
+// Test 49: Test One Open Report Per Reader And Target
+func TestReportOpenKey(t *testing.T) {
+	asserts := assert.New(t)
+	db := setupTestDB()
+	defer teardownTestDB(db)
+
+	author := GetArticleUserModel(createTestUser(db, "author", "author@test.com"))
+	article := createTestArticle(db, "Reported Twice", "Description", "Body", author.ID)
+	reader := GetArticleUserModel(createTestUser(db, "reader", "reader@test.com"))
+
+	report := ReportModel{ArticleID: article.ID, ReporterID: reader.ID, Reason: "spam"}
+	asserts.NoError(createReport(&report), "Reporting should work")
+	duplicate := ReportModel{ArticleID: article.ID, ReporterID: reader.ID, Reason: "spam", Status: ReportOpen, OpenKey: report.OpenKey}
+	err := db.Create(&duplicate).Error
+	asserts.True(common.IsUniqueViolation(err), "A second open report should break the unique index")
+
+	moderator := GetArticleUserModel(createTestUser(db, "moderator", "moderator@test.com"))
+	asserts.NoError(report.resolve([]string{ReportDismiss}, moderator, 0), "Dismissing should work")
+	again := ReportModel{ArticleID: article.ID, ReporterID: reader.ID, Reason: "spam"}
+	asserts.NoError(createReport(&again), "Reporting again after a resolve should work")
+	var open int
+	db.Model(&ReportModel{}).Where("open_key IS NOT NULL").Count(&open)
+	asserts.Equal(1, open, "Only the new report should hold the open key")
+}
@@ -1,20 +1,67 @@
 package articles
 
 import (
-	"github.com/gosimple/slug"
 	"realworld-backend/common"
 	"realworld-backend/users"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"strings"
+	"time"
 )
 
+// Upper limit of an article body in bytes, ARTICLE_MAX_BODY_SIZE overrides the 1 MB default.
+var MaxArticleBodySize = common.GetEnvInt("ARTICLE_MAX_BODY_SIZE", 1<<20)
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("articlebody", func(fl validator.FieldLevel) bool {
+			return len(fl.Field().String()) <= MaxArticleBodySize
+		})
+	}
+}
+
+// New and edited articles and comments go through these filters, see common.ContentFiltersFromEnv for
+// the settings. Posting the same text again within CONTENT_DUPLICATE_WINDOW, 24h by default, is rejected.
+var ContentFilters = append(common.ContentFiltersFromEnv(), duplicateFilter{common.GetEnvDuration("CONTENT_DUPLICATE_WINDOW", 24*time.Hour)})
+
+type duplicateFilter struct {
+	Window time.Duration
+}
+
+func (f duplicateFilter) Check(content common.Content) common.Verdict {
+	if isDuplicate(content, time.Now().Add(-f.Window)) {
+		return common.Verdict{Action: common.VerdictReject, Rule: "duplicate", Reason: "The same was posted a moment ago"}
+	}
+	return common.Verdict{Action: common.VerdictAllow}
+}
+
+// Moderators are trusted to post whatever they need to.
+func filterContent(content common.Content, author users.UserModel) common.Verdict {
+	if author.HasRole(users.RoleModerator) {
+		return common.Verdict{Action: common.VerdictAllow}
+	}
+	if author.JoinedAt != nil {
+		content.AuthorSince = *author.JoinedAt
+	}
+	return ContentFilters.Check(content)
+}
+
+// Everything of an article the content filters look at.
+func articleText(title, description, body string) string {
+	return strings.Join([]string{title, description, body}, "\n\n")
+}
+
 type ArticleModelValidator struct {
 	Article struct {
 		Title       string   `form:"title" json:"title" binding:"required,min=4"`
 		Description string   `form:"description" json:"description" binding:"max=2048"`
-		Body        string   `form:"body" json:"body" binding:"max=2048"`
+		Body        string   `form:"body" json:"body" binding:"articlebody"`
 		Tags        []string `form:"tagList" json:"tagList"`
+		UpdateSlug  bool     `form:"updateSlug" json:"updateSlug"`
 	} `json:"article"`
-	articleModel ArticleModel `json:"-"`
+	articleModel ArticleModel     `json:"-"`
+	editor       ArticleUserModel `json:"-"`
 }
 
 func NewArticleModelValidator() ArticleModelValidator {
@@ -23,6 +70,9 @@ func NewArticleModelValidator() ArticleModelValidator {
 
 func NewArticleModelValidatorFillWith(articleModel ArticleModel) ArticleModelValidator {
 	articleModelValidator := NewArticleModelValidator()
+	articleModelValidator.articleModel.ID = articleModel.ID
+	articleModelValidator.articleModel.Slug = articleModel.Slug
+	articleModelValidator.articleModel.Author = articleModel.Author
 	articleModelValidator.Article.Title = articleModel.Title
 	articleModelValidator.Article.Description = articleModel.Description
 	articleModelValidator.Article.Body = articleModel.Body
@@ -39,18 +89,36 @@ func (s *ArticleModelValidator) Bind(c *gin.Context) error {
 	if err != nil {
 		return err
 	}
-	s.articleModel.Slug = slug.Make(s.Article.Title)
+	// The slug of an existing article only follows its title when asked for
+	if s.articleModel.ID == 0 || s.Article.UpdateSlug {
+		s.articleModel.Slug = uniqueSlug(s.Article.Title, s.articleModel.ID)
+	}
 	s.articleModel.Title = s.Article.Title
 	s.articleModel.Description = s.Article.Description
 	s.articleModel.Body = s.Article.Body
-	s.articleModel.Author = GetArticleUserModel(myUserModel)
+	// Co-authors edit an article without taking it over
+	s.editor = GetArticleUserModel(myUserModel)
+	if s.articleModel.ID == 0 {
+		s.articleModel.Author = s.editor
+	}
 	s.articleModel.setTags(s.Article.Tags)
 	return nil
 }
 
+// Run the bound article through ContentFilters, call it after Bind.
+func (s *ArticleModelValidator) Filter() common.Verdict {
+	return filterContent(common.Content{
+		Kind:     "article",
+		ID:       s.articleModel.ID,
+		Text:     articleText(s.articleModel.Title, s.articleModel.Description, s.articleModel.Body),
+		AuthorID: s.editor.ID,
+	}, s.editor.UserModel)
+}
+
 type CommentModelValidator struct {
 	Comment struct {
-		Body string `form:"body" json:"body" binding:"max=2048"`
+		Body     string `form:"body" json:"body" binding:"max=2048"`
+		ParentID *uint  `form:"parentId" json:"parentId"`
 	} `json:"comment"`
 	commentModel CommentModel `json:"-"`
 }
@@ -59,6 +127,13 @@ func NewCommentModelValidator() CommentModelValidator {
 	return CommentModelValidator{}
 }
 
+func NewCommentModelValidatorFillWith(commentModel CommentModel) CommentModelValidator {
+	commentModelValidator := NewCommentModelValidator()
+	commentModelValidator.commentModel.ID = commentModel.ID
+	commentModelValidator.Comment.Body = commentModel.Body
+	return commentModelValidator
+}
+
 func (s *CommentModelValidator) Bind(c *gin.Context) error {
 	myUserModel := c.MustGet("my_user_model").(users.UserModel)
 
@@ -70,3 +145,182 @@ func (s *CommentModelValidator) Bind(c *gin.Context) error {
 	s.commentModel.Author = GetArticleUserModel(myUserModel)
 	return nil
 }
+
+// Run the bound comment through ContentFilters, call it after Bind.
+func (s *CommentModelValidator) Filter() common.Verdict {
+	return filterContent(common.Content{
+		Kind:     "comment",
+		ID:       s.commentModel.ID,
+		Text:     s.commentModel.Body,
+		AuthorID: s.commentModel.Author.ID,
+	}, s.commentModel.Author.UserModel)
+}
+
+type TagRenameValidator struct {
+	Tag struct {
+		Name string `form:"name" json:"name" binding:"required,max=255"`
+	} `json:"tag"`
+}
+
+func NewTagRenameValidator() TagRenameValidator {
+	return TagRenameValidator{}
+}
+
+func (s *TagRenameValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, s)
+}
+
+type TagMergeValidator struct {
+	Tag struct {
+		Into string `form:"into" json:"into" binding:"required"`
+	} `json:"tag"`
+}
+
+func NewTagMergeValidator() TagMergeValidator {
+	return TagMergeValidator{}
+}
+
+func (s *TagMergeValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, s)
+}
+
+type ReportValidator struct {
+	Report struct {
+		Reason string `form:"reason" json:"reason" binding:"required,oneof=spam harassment hate violence sexual misinformation other"`
+		Note   string `form:"note" json:"note" binding:"max=1024"`
+	} `json:"report"`
+	reportModel ReportModel `json:"-"`
+}
+
+func NewReportValidator() ReportValidator {
+	return ReportValidator{}
+}
+
+func (s *ReportValidator) Bind(c *gin.Context) error {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+
+	err := common.Bind(c, s)
+	if err != nil {
+		return err
+	}
+	s.reportModel.Reason = s.Report.Reason
+	s.reportModel.Note = s.Report.Note
+	s.reportModel.ReporterID = GetArticleUserModel(myUserModel).ID
+	return nil
+}
+
+// SuspendDays is how long "suspend" keeps the author from writing, 7 days when left out.
+type ReportResolveValidator struct {
+	Resolution struct {
+		Actions     []string `form:"actions" json:"actions" binding:"required,min=1,dive,oneof=dismiss hide delete warn suspend"`
+		SuspendDays int      `form:"suspendDays" json:"suspendDays" binding:"min=0,max=3650"`
+	} `json:"resolution"`
+}
+
+func NewReportResolveValidator() ReportResolveValidator {
+	return ReportResolveValidator{}
+}
+
+func (s *ReportResolveValidator) Bind(c *gin.Context) error {
+	err := common.Bind(c, s)
+	if err != nil {
+		return err
+	}
+	if s.Resolution.SuspendDays == 0 {
+		s.Resolution.SuspendDays = 7
+	}
+	return nil
+}
+
+type DigestValidator struct {
+	Digest struct {
+		Frequency string `form:"frequency" json:"frequency" binding:"required,oneof=daily weekly off"`
+	} `json:"digest"`
+}
+
+func NewDigestValidator() DigestValidator {
+	return DigestValidator{}
+}
+
+func (s *DigestValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, s)
+}
+
+type ReadingListValidator struct {
+	List struct {
+		Name string `form:"name" json:"name" binding:"required,max=100"`
+	} `json:"list"`
+}
+
+func NewReadingListValidator() ReadingListValidator {
+	return ReadingListValidator{}
+}
+
+func (s *ReadingListValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, s)
+}
+
+// The slugs of a reading list or series in the order they should come first, see movedToTop.
+type ArticleOrderValidator struct {
+	Articles []string `form:"articles" json:"articles" binding:"required,min=1"`
+}
+
+func NewArticleOrderValidator() ArticleOrderValidator {
+	return ArticleOrderValidator{}
+}
+
+func (s *ArticleOrderValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, s)
+}
+
+type SeriesModelValidator struct {
+	Series struct {
+		Title       string `form:"title" json:"title" binding:"required,min=4"`
+		Description string `form:"description" json:"description" binding:"max=2048"`
+	} `json:"series"`
+	seriesModel SeriesModel `json:"-"`
+}
+
+func NewSeriesModelValidator() SeriesModelValidator {
+	return SeriesModelValidator{}
+}
+
+func NewSeriesModelValidatorFillWith(seriesModel SeriesModel) SeriesModelValidator {
+	seriesModelValidator := NewSeriesModelValidator()
+	seriesModelValidator.seriesModel.ID = seriesModel.ID
+	seriesModelValidator.seriesModel.Slug = seriesModel.Slug
+	seriesModelValidator.Series.Title = seriesModel.Title
+	seriesModelValidator.Series.Description = seriesModel.Description
+	return seriesModelValidator
+}
+
+// The slug is made from the title once, links to a series keep working when it gets renamed.
+func (s *SeriesModelValidator) Bind(c *gin.Context) error {
+	myUserModel := c.MustGet("my_user_model").(users.UserModel)
+
+	err := common.Bind(c, s)
+	if err != nil {
+		return err
+	}
+	if s.seriesModel.ID == 0 {
+		s.seriesModel.Slug = uniqueSeriesSlug(s.Series.Title, 0)
+	}
+	s.seriesModel.Title = s.Series.Title
+	s.seriesModel.Description = s.Series.Description
+	s.seriesModel.Author = GetArticleUserModel(myUserModel)
+	return nil
+}
+
+type InvitationValidator struct {
+	Author struct {
+		Username string `form:"username" json:"username" binding:"required"`
+	} `json:"author"`
+}
+
+func NewInvitationValidator() InvitationValidator {
+	return InvitationValidator{}
+}
+
+func (s *InvitationValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, s)
+}
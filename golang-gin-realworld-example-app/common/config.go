@@ -0,0 +1,42 @@
+package common
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Settings are read from the environment, each one has a default so the app runs without any.
+//
+//	limit := GetEnvInt("ARTICLE_MAX_BODY_SIZE", 1<<20)
+func GetEnv(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return def
+}
+
+// Read an integer setting, a malformed value falls back to def.
+func GetEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(GetEnv(key, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// Read a duration setting such as "720h", a malformed value falls back to def.
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetEnv(key, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// Where the frontend and this API are reachable from outside, for links which leave the app such as
+// the ones in emails. APP_URL and API_URL override them, without a trailing slash.
+var (
+	AppURL = GetEnv("APP_URL", "http://localhost:4100")
+	APIURL = GetEnv("API_URL", "http://localhost:3000")
+)
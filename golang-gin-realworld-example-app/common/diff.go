@@ -0,0 +1,170 @@
+package common
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// One line of a line-level diff, Op is one of DiffEqual, DiffInsert or DiffDelete.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Diffs whose changed region spans more lines than this, counting both sides, are refused.
+const MaxDiffLines = 10000
+
+var ErrDiffTooLarge = errors.New("Too large to diff")
+
+// Compute a line-level diff which turns `from` into `to`, using Myers' algorithm in linear space.
+// ErrDiffTooLarge is returned when the changed region exceeds MaxDiffLines.
+//
+//	lines, err := DiffLines("a\nb", "a\nc")  // equal "a", delete "b", insert "c"
+func DiffLines(from, to string) ([]DiffLine, error) {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	prefix, suffix := commonEnds(a, b)
+	if len(a)+len(b)-2*(prefix+suffix) > MaxDiffLines {
+		return nil, ErrDiffTooLarge
+	}
+	return diffLines(a, b), nil
+}
+
+// Length of the common prefix and suffix of a and b, these never overlap.
+func commonEnds(a, b []string) (int, int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+func diffLines(a, b []string) []DiffLine {
+	// Common prefix and suffix don't need to go through the bisection.
+	prefix, suffix := commonEnds(a, b)
+
+	diff := []DiffLine{}
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{DiffEqual, line})
+	}
+	diff = append(diff, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{DiffEqual, line})
+	}
+	return diff
+}
+
+// Diff a and b, which share no common prefix or suffix, by finding where the forward and
+// reverse shortest edit paths meet and recursing on both halves.
+func diffMiddle(a, b []string) []DiffLine {
+	diff := []DiffLine{}
+	if len(a) == 0 || len(b) == 0 {
+		for _, line := range a {
+			diff = append(diff, DiffLine{DiffDelete, line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{DiffInsert, line})
+		}
+		return diff
+	}
+
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	// forward[offset+k] is the furthest x reached on diagonal k from the start,
+	// reverse[offset+k] the same from the end.
+	forward := make([]int, 2*maxD+2)
+	reverse := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i] = -1
+		reverse[i] = -1
+	}
+	forward[offset+1] = 0
+	reverse[offset+1] = 0
+	delta := n - m
+	// With an odd delta the paths meet while extending forward, otherwise in reverse.
+	front := delta%2 != 0
+	// Diagonals which ran off the edges are trimmed from the search.
+	kStart, kEnd, rStart, rEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + kStart; k <= d-kEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if x > n {
+				kEnd += 2
+			} else if y > m {
+				kStart += 2
+			} else if front {
+				r := offset + delta - k
+				if r >= 0 && r < len(reverse) && reverse[r] != -1 && x >= n-reverse[r] {
+					return append(diffLines(a[:x], b[:y]), diffLines(a[x:], b[y:])...)
+				}
+			}
+		}
+		for k := -d + rStart; k <= d-rEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && reverse[offset+k-1] < reverse[offset+k+1]) {
+				x = reverse[offset+k+1]
+			} else {
+				x = reverse[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			reverse[offset+k] = x
+			if x > n {
+				rEnd += 2
+			} else if y > m {
+				rStart += 2
+			} else if !front {
+				f := offset + delta - k
+				if f >= 0 && f < len(forward) && forward[f] != -1 {
+					fx := forward[f]
+					fy := offset + fx - f
+					if fx >= n-x {
+						return append(diffLines(a[:fx], b[:fy]), diffLines(a[fx:], b[fy:])...)
+					}
+				}
+			}
+		}
+	}
+
+	// No line in common.
+	for _, line := range a {
+		diff = append(diff, DiffLine{DiffDelete, line})
+	}
+	for _, line := range b {
+		diff = append(diff, DiffLine{DiffInsert, line})
+	}
+	return diff
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,190 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Something which happened in the domain, such as an article being created. Events are plain
+// structs which marshal to JSON, EventName tells subscribers apart and has to be unique per type.
+type DomainEvent interface {
+	EventName() string
+}
+
+// An event stored in the same transaction as the change it's about, so there's no event without
+// the change and no change without its event. Key identifies it towards subscribers.
+type OutboxModel struct {
+	gorm.Model
+	Key          string `gorm:"unique_index"`
+	Name         string
+	Payload      string `gorm:"type:text"`
+	Attempts     int
+	Error        string     `gorm:"size:1024"`
+	DispatchedAt *time.Time `gorm:"index"`
+}
+
+// Subscriber handled the event with Key, it won't get it again.
+type OutboxReceiptModel struct {
+	gorm.Model
+	Key        string `gorm:"unique_index:idx_outbox_receipt"`
+	Subscriber string `gorm:"unique_index:idx_outbox_receipt"`
+}
+
+// What a subscriber gets to know about an event besides its payload. Subscribers get an event
+// at least once, Key stays the same across retries so side effects outside the database can be deduplicated.
+type EventMeta struct {
+	Key        string
+	Name       string
+	OccurredAt time.Time
+}
+
+// OUTBOX_MAX_ATTEMPTS dispatches, 10 by default, before an event with a failing subscriber is given up on.
+var OutboxMaxAttempts = GetEnvInt("OUTBOX_MAX_ATTEMPTS", 10)
+
+// Store event in the outbox as part of tx.
+//
+//	err := PublishEvent(tx, ArticleCreated{ArticleID: article.ID})
+func PublishEvent(tx *gorm.DB, event DomainEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxModel{
+		Key:     fmt.Sprintf("%v-%v", time.Now().UnixNano(), RandString(12)),
+		Name:    event.EventName(),
+		Payload: string(payload),
+	}).Error
+}
+
+// Run fn in a transaction, rolled back when fn fails. The dispatcher gets woken up once it's committed.
+//
+//	err := Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Save(&article).Error; err != nil {
+//			return err
+//		}
+//		return PublishEvent(tx, ArticleCreated{ArticleID: article.ID})
+//	})
+func Transaction(fn func(tx *gorm.DB) error) error {
+	tx := GetDB().Begin()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	select {
+	case dispatcherWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+type eventHandler func(meta EventMeta, payload []byte) error
+
+var (
+	subscribersMutex sync.RWMutex
+	subscribers      = map[string]map[string]eventHandler{}
+)
+
+// Call handle with every event of type E. Subscriber names the handler for the receipts, subscribing
+// again under the same name replaces it.
+//
+//	Subscribe("users.notify-follow", func(meta EventMeta, event UserFollowed) error { ... })
+func Subscribe[E DomainEvent](subscriber string, handle func(meta EventMeta, event E) error) {
+	var zero E
+	name := zero.EventName()
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	if subscribers[name] == nil {
+		subscribers[name] = map[string]eventHandler{}
+	}
+	subscribers[name][subscriber] = func(meta EventMeta, payload []byte) error {
+		var event E
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return err
+		}
+		return handle(meta, event)
+	}
+}
+
+// The subscribers of the event called name, ordered by their name.
+func subscribersOf(name string) ([]string, map[string]eventHandler) {
+	subscribersMutex.RLock()
+	defer subscribersMutex.RUnlock()
+	handlers := map[string]eventHandler{}
+	var names []string
+	for subscriber, handle := range subscribers[name] {
+		handlers[subscriber] = handle
+		names = append(names, subscriber)
+	}
+	sort.Strings(names)
+	return names, handlers
+}
+
+var (
+	dispatching    sync.Mutex
+	dispatcherWake = make(chan struct{}, 1)
+)
+
+// Hand the events waiting in the outbox to their subscribers, oldest first, and return how many were handled.
+// An event is done once every subscriber handled it, a failing subscriber gets it again on the next run
+// while the others, having left a receipt, don't.
+func DispatchEvents() (int, error) {
+	dispatching.Lock()
+	defer dispatching.Unlock()
+	db := GetDB()
+	var events []OutboxModel
+	err := db.Where("dispatched_at IS NULL AND attempts < ?", OutboxMaxAttempts).Order("id asc").Limit(100).Find(&events).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		meta := EventMeta{Key: event.Key, Name: event.Name, OccurredAt: event.CreatedAt}
+		names, handlers := subscribersOf(event.Name)
+		var failed error
+		for _, subscriber := range names {
+			var count int
+			db.Model(&OutboxReceiptModel{}).Where(OutboxReceiptModel{Key: event.Key, Subscriber: subscriber}).Count(&count)
+			if count > 0 {
+				continue
+			}
+			if err := handlers[subscriber](meta, []byte(event.Payload)); err != nil {
+				failed = fmt.Errorf("%v: %v", subscriber, err)
+				continue
+			}
+			db.Create(&OutboxReceiptModel{Key: event.Key, Subscriber: subscriber})
+		}
+		if failed != nil {
+			db.Model(&event).Updates(map[string]interface{}{"attempts": event.Attempts + 1, "error": failed.Error()})
+			continue
+		}
+		now := time.Now()
+		db.Model(&event).Updates(map[string]interface{}{"attempts": event.Attempts + 1, "error": "", "dispatched_at": &now})
+	}
+	return len(events), nil
+}
+
+// Dispatch events as they get committed, and every interval for the retries, until stop is closed.
+//
+//	go RunEventDispatcher(time.Second, nil)
+func RunEventDispatcher(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := DispatchEvents(); err != nil {
+			fmt.Println("events err: (RunEventDispatcher) ", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-dispatcherWake:
+		case <-stop:
+			return
+		}
+	}
+}
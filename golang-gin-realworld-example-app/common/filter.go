@@ -0,0 +1,158 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// What a content filter makes of a piece of content, ordered from mild to strict.
+const (
+	VerdictAllow      = "allow"
+	VerdictQuarantine = "quarantine"
+	VerdictReject     = "reject"
+)
+
+var verdictRank = map[string]int{VerdictAllow: 0, VerdictQuarantine: 1, VerdictReject: 2}
+
+// Action is one of the Verdict constants, Rule names the filter which decided and Reason tells the author why.
+type Verdict struct {
+	Action string `json:"action"`
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (v Verdict) Allowed() bool {
+	return v.Action == "" || v.Action == VerdictAllow
+}
+
+// Something an author wants to publish. ID is 0 for new content, AuthorSince is zero when
+// it's not known how long the author has had an account.
+type Content struct {
+	Kind        string
+	ID          uint
+	Text        string
+	AuthorID    uint
+	AuthorSince time.Time
+}
+
+// A single rule of the content filter pipeline.
+type ContentFilter interface {
+	Check(content Content) Verdict
+}
+
+// The content filter pipeline, every filter gets to look at the content and the strictest verdict wins.
+//
+//	verdict := ContentFilters{NewBannedWordsFilter(words, VerdictReject), LinkLimitFilter{5, VerdictQuarantine}}.Check(content)
+type ContentFilters []ContentFilter
+
+func (filters ContentFilters) Check(content Content) Verdict {
+	verdict := Verdict{Action: VerdictAllow}
+	for _, filter := range filters {
+		v := filter.Check(content)
+		if verdictRank[v.Action] > verdictRank[verdict.Action] {
+			verdict = v
+		}
+		if verdict.Action == VerdictReject {
+			break
+		}
+	}
+	return verdict
+}
+
+// Wrap a verdict the same way NewError wraps an error.
+//
+//	{"errors": {"content": {"action": "reject", "rule": "banned-words", "reason": "..."}}}
+func NewVerdictError(verdict Verdict) CommonError {
+	res := CommonError{}
+	res.Errors = make(map[string]interface{})
+	res.Errors["content"] = verdict
+	return res
+}
+
+// Content using any of the banned words, matched as whole words ignoring case, gets Action.
+type BannedWordsFilter struct {
+	pattern *regexp.Regexp
+	Action  string
+}
+
+func NewBannedWordsFilter(words []string, action string) BannedWordsFilter {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	filter := BannedWordsFilter{Action: action}
+	if len(quoted) > 0 {
+		filter.pattern = regexp.MustCompile(`(?i)(^|\W)(` + strings.Join(quoted, "|") + `)($|\W)`)
+	}
+	return filter
+}
+
+func (f BannedWordsFilter) Check(content Content) Verdict {
+	if f.pattern != nil && f.pattern.MatchString(content.Text) {
+		return Verdict{f.Action, "banned-words", "Content uses a banned word"}
+	}
+	return Verdict{Action: VerdictAllow}
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+
+// Count the links in text, bare URLs as well as markdown links.
+func CountLinks(text string) int {
+	return len(linkPattern.FindAllString(text, -1))
+}
+
+// Content with more than Max links gets Action.
+type LinkLimitFilter struct {
+	Max    int
+	Action string
+}
+
+func (f LinkLimitFilter) Check(content Content) Verdict {
+	if CountLinks(content.Text) > f.Max {
+		return Verdict{f.Action, "link-limit", fmt.Sprintf("Content has more than %d links", f.Max)}
+	}
+	return Verdict{Action: VerdictAllow}
+}
+
+// Accounts younger than MinAge can't post links, anything they post with a link gets Action.
+type NewAccountFilter struct {
+	MinAge time.Duration
+	Action string
+}
+
+func (f NewAccountFilter) Check(content Content) Verdict {
+	if content.AuthorSince.IsZero() || time.Since(content.AuthorSince) >= f.MinAge {
+		return Verdict{Action: VerdictAllow}
+	}
+	if CountLinks(content.Text) > 0 {
+		return Verdict{f.Action, "new-account", "New accounts can not post links yet"}
+	}
+	return Verdict{Action: VerdictAllow}
+}
+
+// The filters configured through the environment:
+//
+//	CONTENT_BANNED_WORDS         comma separated words which get content rejected
+//	CONTENT_BANNED_WORDS_FILE    a file with one more banned word per line
+//	CONTENT_MAX_LINKS            links allowed before content gets quarantined, 10 by default
+//	CONTENT_NEW_ACCOUNT_AGE      how long accounts count as new, 24h by default
+func ContentFiltersFromEnv() ContentFilters {
+	filters := ContentFilters{}
+	words := strings.Split(GetEnv("CONTENT_BANNED_WORDS", ""), ",")
+	if path := GetEnv("CONTENT_BANNED_WORDS_FILE", ""); path != "" {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			words = append(words, strings.Split(string(data), "\n")...)
+		} else {
+			fmt.Println("filter err: (ContentFiltersFromEnv) ", err)
+		}
+	}
+	filters = append(filters, NewBannedWordsFilter(words, VerdictReject))
+	filters = append(filters, LinkLimitFilter{GetEnvInt("CONTENT_MAX_LINKS", 10), VerdictQuarantine})
+	filters = append(filters, NewAccountFilter{GetEnvDuration("CONTENT_NEW_ACCOUNT_AGE", 24*time.Hour), VerdictQuarantine})
+	return filters
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The image formats uploads may have, with the extension they are stored under once re-encoded.
+// GIFs are stored as PNG, only their first frame is kept.
+var ImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".png",
+}
+
+var (
+	ErrUploadMissing    = errors.New("No file uploaded")
+	ErrUploadTooLarge   = errors.New("File too large")
+	ErrUnsupportedImage = errors.New("Unsupported image type, use JPEG, PNG or GIF")
+	ErrImageTooLarge    = errors.New("Image has too many pixels")
+)
+
+// Uploads are limited to UPLOAD_MAX_SIZE bytes, 2MB by default, and UPLOAD_MAX_PIXELS pixels,
+// 24 million by default, so a small file can't decode into a huge image.
+var (
+	UploadMaxSize   = int64(GetEnvInt("UPLOAD_MAX_SIZE", 2<<20))
+	UploadMaxPixels = GetEnvInt("UPLOAD_MAX_PIXELS", 24000000)
+)
+
+// Read the image uploaded in the multipart form field and return it with the content type
+// sniffed from its bytes, whatever the client claimed.
+func ReadImageUpload(c *gin.Context, field string) (image.Image, string, error) {
+	header, err := c.FormFile(field)
+	if err != nil {
+		return nil, "", ErrUploadMissing
+	}
+	if header.Size > UploadMaxSize {
+		return nil, "", ErrUploadTooLarge
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, UploadMaxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > UploadMaxSize {
+		return nil, "", ErrUploadTooLarge
+	}
+	return DecodeImage(data)
+}
+
+// Decode an image after checking its type and size, see ImageTypes and UploadMaxPixels.
+func DecodeImage(data []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := ImageTypes[contentType]; !ok {
+		return nil, "", ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	if config.Width*config.Height > UploadMaxPixels {
+		return nil, "", ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	return img, contentType, nil
+}
+
+// The status an upload error answers with.
+func UploadErrorStatus(err error) int {
+	switch err {
+	case ErrUploadTooLarge, ErrImageTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrUnsupportedImage:
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// Scale img down to fit into width x height keeping its aspect ratio, smaller images are left as they are.
+func FitImage(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width && bounds.Dy() <= height {
+		return img
+	}
+	scaledWidth, scaledHeight := width, bounds.Dy()*width/bounds.Dx()
+	if scaledHeight > height {
+		scaledWidth, scaledHeight = bounds.Dx()*height/bounds.Dy(), height
+	}
+	return resample(img, bounds, max(scaledWidth, 1), max(scaledHeight, 1))
+}
+
+// Scale and crop img around its center so it fills width x height exactly, as for avatars.
+func FillImage(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	crop := bounds
+	if bounds.Dx()*height > bounds.Dy()*width {
+		cropWidth := bounds.Dy() * width / height
+		crop.Min.X += (bounds.Dx() - cropWidth) / 2
+		crop.Max.X = crop.Min.X + cropWidth
+	} else {
+		cropHeight := bounds.Dx() * height / width
+		crop.Min.Y += (bounds.Dy() - cropHeight) / 2
+		crop.Max.Y = crop.Min.Y + cropHeight
+	}
+	return resample(img, crop, width, height)
+}
+
+// Scale the area of img down or up to width x height, every pixel is the average of the source
+// pixels it covers. Colors are averaged premultiplied so transparent pixels don't bleed.
+func resample(img image.Image, area image.Rectangle, width, height int) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	draw.Draw(src, src.Bounds(), img, area.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * area.Dy() / height
+		y1 := max((y+1)*area.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * area.Dx() / width
+			x1 := max((x+1)*area.Dx()/width, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8((sum[i] + count/2) / count)
+			}
+		}
+	}
+	return dst
+}
+
+// Encode img for storage, JPEGs stay JPEG and everything else becomes PNG so transparency survives.
+// Returns the data with its content type and extension.
+func EncodeImage(img image.Image, contentType string) ([]byte, string, string, error) {
+	var data bytes.Buffer
+	if contentType == "image/jpeg" {
+		err := jpeg.Encode(&data, img, &jpeg.Options{Quality: 85})
+		return data.Bytes(), "image/jpeg", ".jpg", err
+	}
+	err := png.Encode(&data, img)
+	return data.Bytes(), "image/png", ".png", err
+}
+
+// Encode img and put it into Media under prefix with a random name, returning its key and size.
+//
+//	key, size, err := StoreImage("avatars/1/", FillImage(img, 256, 256), contentType)
+func StoreImage(prefix string, img image.Image, contentType string) (string, int, error) {
+	data, contentType, extension, err := EncodeImage(img, contentType)
+	if err != nil {
+		return "", 0, err
+	}
+	key := prefix + RandString(16) + extension
+	return key, len(data), Media.Put(key, data, contentType)
+}
+
+// A signed URL for key in Media, nil for no key. Errors are logged, a missing image shouldn't fail the response.
+func MediaURL(key string) *string {
+	if key == "" {
+		return nil
+	}
+	link, err := Media.URL(key, MediaURLTTL)
+	if err != nil {
+		fmt.Println("media err: (MediaURL) ", err)
+		return nil
+	}
+	return &link
+}
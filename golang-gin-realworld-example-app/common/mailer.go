@@ -0,0 +1,138 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An email with a plain text and an HTML version, Headers are added as they are.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Encode the message as a multipart/alternative email from from.
+func (m Message) Bytes(from string) []byte {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		writer, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		writer.Write([]byte(part.content))
+	}
+	parts.Close()
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           m.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	for key, value := range m.Headers {
+		headers[key] = value
+	}
+	var keys []string
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var message bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&message, "%v: %v\r\n", key, headers[key])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes()
+}
+
+// Sends emails, so the app doesn't have to care whether they go out over SMTP or into a file.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// Sends through an SMTP server at Addr ("host:port"), Auth may be nil.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (mailer SMTPMailer) Send(message Message) error {
+	return smtp.SendMail(mailer.Addr, mailer.Auth, mailer.From, []string{message.To}, message.Bytes(mailer.From))
+}
+
+// Writes every email into Dir as an .eml file, for development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (mailer FileMailer) Send(message Message) error {
+	if err := os.MkdirAll(mailer.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%v-%v.eml", time.Now().UnixNano(), RandString(6))
+	return ioutil.WriteFile(filepath.Join(mailer.Dir, name), message.Bytes(mailer.From), 0644)
+}
+
+// Keeps every email in memory, for tests.
+type MemoryMailer struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+func (mailer *MemoryMailer) Send(message Message) error {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	mailer.messages = append(mailer.messages, message)
+	return nil
+}
+
+// The emails sent so far, oldest first.
+func (mailer *MemoryMailer) Messages() []Message {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	return append([]Message{}, mailer.messages...)
+}
+
+// The mailer configured through the environment:
+//
+//	MAIL_FROM          sender address, "RealWorld <noreply@localhost>" by default
+//	MAIL_SMTP_ADDR     "host:port" of the SMTP server, without it mail goes into MAIL_DIR
+//	MAIL_SMTP_USER     user for PLAIN authentication, if the server wants it
+//	MAIL_SMTP_PASSWORD
+//	MAIL_DIR           where mail goes without an SMTP server, "mail" by default
+func MailerFromEnv() Mailer {
+	from := GetEnv("MAIL_FROM", "RealWorld <noreply@localhost>")
+	addr := GetEnv("MAIL_SMTP_ADDR", "")
+	if addr == "" {
+		return FileMailer{Dir: GetEnv("MAIL_DIR", "mail"), From: from}
+	}
+	mailer := SMTPMailer{Addr: addr, From: from}
+	if user := GetEnv("MAIL_SMTP_USER", ""); user != "" {
+		host := strings.Split(addr, ":")[0]
+		mailer.Auth = smtp.PlainAuth("", user, GetEnv("MAIL_SMTP_PASSWORD", ""), host)
+	}
+	return mailer
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// The allowlist of user generated content: scripts, styles, event handlers and
+// javascript:/data: URLs are stripped, links get rel="nofollow".
+var sanitizer = bluemonday.UGCPolicy()
+
+// Render markdown into HTML which is safe to put into a page as is.
+//
+//	html := RenderMarkdown("# Title\n\n<script>alert(1)</script>")  // "<h1>Title</h1>\n"
+func RenderMarkdown(source string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return sanitizer.Sanitize(source)
+	}
+	return sanitizer.Sanitize(buf.String())
+}
+
+// Rendered HTML is cached by a key naming the content version, e.g. "article:1:<updated_at>",
+// so an edit never gets an old rendering.
+var MarkdownCache = NewLRUCache(1024)
+
+// Render source with RenderMarkdown, reusing the cached HTML stored under key.
+func RenderMarkdownCached(key, source string) string {
+	if html, ok := MarkdownCache.Get(key); ok {
+		return html
+	}
+	html := RenderMarkdown(source)
+	MarkdownCache.Set(key, html)
+	return html
+}
+
+// A string cache which drops the least recently used entry once it's full, safe for concurrent use.
+type LRUCache struct {
+	size  int
+	mutex sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value string
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (cache *LRUCache) Get(key string) (string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.items[key]
+	if !ok {
+		return "", false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*lruEntry).value, true
+}
+
+func (cache *LRUCache) Set(key, value string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.items[key]; ok {
+		element.Value.(*lruEntry).value = value
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.items[key] = cache.order.PushFront(&lruEntry{key, value})
+	if cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reject request bodies larger than limit bytes with 413 before any handler reads them.
+//
+//	r.Use(BodySizeLimit(2 << 20))
+func BodySizeLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil {
+			return
+		}
+		if c.Request.ContentLength > limit {
+			abortTooLarge(c)
+			return
+		}
+		// Content-Length may be missing or wrong, so count what is actually read.
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				abortTooLarge(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, NewError("body", err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+}
+
+func abortTooLarge(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, NewError("body", errors.New("Request body too large")))
+}
@@ -0,0 +1,361 @@
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Where uploaded files live. Keys are slash separated paths such as "avatars/1/abc.jpg",
+// URL hands out a link which works for about expires without any other credentials.
+type Storage interface {
+	Put(key string, body []byte, contentType string) error
+	Get(key string) (io.ReadCloser, string, error)
+	Delete(key string) error
+	URL(key string, expires time.Duration) (string, error)
+}
+
+var ErrObjectNotFound = errors.New("Object not found")
+
+// Signed URLs stay valid for MEDIA_URL_TTL, 24h by default.
+var MediaURLTTL = GetEnvDuration("MEDIA_URL_TTL", 24*time.Hour)
+
+// The storage of this instance, see StorageFromEnv.
+var Media = StorageFromEnv()
+
+// Signed URLs are made at the start of the hour, so they stay the same for a while and clients can cache what they point at.
+func signingTime() time.Time {
+	return time.Now().UTC().Truncate(time.Hour)
+}
+
+// Keeps files below Dir, they are served by ServeMedia at BaseURL.
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+func (storage LocalStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if key == "" || cleaned != "/"+key {
+		return "", errors.New("Invalid key")
+	}
+	return filepath.Join(storage.Dir, filepath.FromSlash(cleaned)), nil
+}
+
+func (storage LocalStorage) Put(key string, body []byte, contentType string) error {
+	path, err := storage.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, body, 0644)
+}
+
+// The content type comes from the extension of key.
+func (storage LocalStorage) Get(key string) (io.ReadCloser, string, error) {
+	path, err := storage.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, "", ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, contentType, nil
+}
+
+func (storage LocalStorage) Delete(key string) error {
+	path, err := storage.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (storage LocalStorage) URL(key string, expires time.Duration) (string, error) {
+	if _, err := storage.path(key); err != nil {
+		return "", err
+	}
+	deadline := strconv.FormatInt(signingTime().Add(expires).Unix(), 10)
+	query := url.Values{"expires": {deadline}, "signature": {tokenSignature("media", key+"\x00"+deadline)}}
+	return storage.BaseURL + "/" + awsEscapePath(key) + "?" + query.Encode(), nil
+}
+
+// Serve the files of Media behind the URLs LocalStorage signs, mount it at "/api/media/*key".
+func ServeMedia(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	deadline := c.Query("expires")
+	expires, err := strconv.ParseInt(deadline, 10, 64)
+	signature := tokenSignature("media", key+"\x00"+deadline)
+	if err != nil || time.Now().Unix() > expires || !hmac.Equal([]byte(c.Query("signature")), []byte(signature)) {
+		c.JSON(http.StatusForbidden, NewError("media", errors.New("Invalid or expired signature")))
+		return
+	}
+	body, contentType, err := Media.Get(key)
+	if err == ErrObjectNotFound {
+		c.JSON(http.StatusNotFound, NewError("media", err))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, NewError("media", err))
+		return
+	}
+	defer body.Close()
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.DataFromReader(http.StatusOK, -1, contentType, body, nil)
+}
+
+// Talks to an S3 compatible object store with AWS Signature Version 4. Endpoint is like
+// "https://s3.eu-west-1.amazonaws.com", PathStyle puts the bucket in the path rather than
+// the host name, which MinIO and most stand-ins want.
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Client    *http.Client
+}
+
+func (storage S3Storage) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(storage.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	object := *endpoint
+	if storage.PathStyle {
+		object.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + storage.Bucket + "/" + key
+	} else {
+		object.Host = storage.Bucket + "." + endpoint.Host
+		object.Path = "/" + key
+	}
+	object.RawPath = awsEscapePath(object.Path)
+	return &object, nil
+}
+
+func (storage S3Storage) client() *http.Client {
+	if storage.Client != nil {
+		return storage.Client
+	}
+	return http.DefaultClient
+}
+
+// Send a request signed in its Authorization header.
+func (storage S3Storage) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	object, err := storage.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(method, object.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	payloadHash := sha256.Sum256(body)
+	headers := map[string]string{
+		"host":                 object.Host,
+		"x-amz-content-sha256": hex.EncodeToString(payloadHash[:]),
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+	signedHeaders, signature := storage.sign(method, object, url.Values{}, headers, headers["x-amz-content-sha256"], now)
+	for name, value := range headers {
+		if name != "host" {
+			request.Header.Set(name, value)
+		}
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		storage.AccessKey, storage.scope(now), signedHeaders, signature))
+	return storage.client().Do(request)
+}
+
+func (storage S3Storage) Put(key string, body []byte, contentType string) error {
+	response, err := storage.do("PUT", key, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("S3 PUT %v: %v", key, response.Status)
+	}
+	return nil
+}
+
+func (storage S3Storage) Get(key string) (io.ReadCloser, string, error) {
+	response, err := storage.do("GET", key, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, "", ErrObjectNotFound
+	}
+	if response.StatusCode/100 != 2 {
+		response.Body.Close()
+		return nil, "", fmt.Errorf("S3 GET %v: %v", key, response.Status)
+	}
+	return response.Body, response.Header.Get("Content-Type"), nil
+}
+
+func (storage S3Storage) Delete(key string) error {
+	response, err := storage.do("DELETE", key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 && response.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("S3 DELETE %v: %v", key, response.Status)
+	}
+	return nil
+}
+
+// A presigned GET URL, S3 caps expires at 7 days.
+func (storage S3Storage) URL(key string, expires time.Duration) (string, error) {
+	return storage.presign("GET", key, signingTime(), expires+time.Hour)
+}
+
+func (storage S3Storage) presign(method, key string, at time.Time, expires time.Duration) (string, error) {
+	object, err := storage.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	if expires > 7*24*time.Hour {
+		expires = 7 * 24 * time.Hour
+	}
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {storage.AccessKey + "/" + storage.scope(at)},
+		"X-Amz-Date":          {at.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	_, signature := storage.sign(method, object, query, map[string]string{"host": object.Host}, "UNSIGNED-PAYLOAD", at)
+	query.Set("X-Amz-Signature", signature)
+	object.RawQuery = awsCanonicalQuery(query)
+	return object.String(), nil
+}
+
+func (storage S3Storage) scope(at time.Time) string {
+	return at.Format("20060102") + "/" + storage.Region + "/s3/aws4_request"
+}
+
+// The signed header names and the signature of a request, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (storage S3Storage) sign(method string, object *url.URL, query url.Values, headers map[string]string, payloadHash string, at time.Time) (string, string) {
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		method,
+		awsEscapePath(object.Path),
+		awsCanonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		at.Format("20060102T150405Z"),
+		storage.scope(at),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + storage.SecretKey)
+	for _, part := range []string{at.Format("20060102"), storage.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Percent-encode everything but the unreserved characters the way AWS wants it, keeping slashes.
+func awsEscapePath(path string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(path) {
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' ||
+			('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, strings.ReplaceAll(awsEscapePath(name), "/", "%2F")+"="+strings.ReplaceAll(awsEscapePath(value), "/", "%2F"))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// The storage configured through the environment:
+//
+//	STORAGE_DRIVER   "local" (default) or "s3"
+//	STORAGE_DIR      where local files go, "uploads" by default
+//	S3_ENDPOINT      such as "https://s3.amazonaws.com" or "http://localhost:9000"
+//	S3_REGION        "us-east-1" by default
+//	S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY
+//	S3_PATH_STYLE    "true" to put the bucket in the path
+func StorageFromEnv() Storage {
+	if GetEnv("STORAGE_DRIVER", "local") == "s3" {
+		return S3Storage{
+			Endpoint:  GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:    GetEnv("S3_REGION", "us-east-1"),
+			Bucket:    GetEnv("S3_BUCKET", ""),
+			AccessKey: GetEnv("S3_ACCESS_KEY", ""),
+			SecretKey: GetEnv("S3_SECRET_KEY", ""),
+			PathStyle: GetEnv("S3_PATH_STYLE", "") == "true",
+			Client:    &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+	return LocalStorage{Dir: GetEnv("STORAGE_DIR", "uploads"), BaseURL: APIURL + "/api/media"}
+}
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Something which happened on a topic. Events only name the model they are about through Ref,
+// every subscriber loads it for itself so what it gets is what it's allowed to see.
+//
+//	Event{Type: "comment", Topic: ArticleTopic(article.ID), Ref: comment.ID}
+type Event struct {
+	ID    uint64 `json:"id"`
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+	Ref   uint   `json:"ref"`
+}
+
+// Comments on an article.
+func ArticleTopic(articleID uint) string {
+	return fmt.Sprintf("article:%v", articleID)
+}
+
+// Articles written by a user.
+func AuthorTopic(userID uint) string {
+	return fmt.Sprintf("author:%v", userID)
+}
+
+// Notifications of a user.
+func UserTopic(userID uint) string {
+	return fmt.Sprintf("user:%v", userID)
+}
+
+// Carries events between the hubs of every running instance. Publish hands an event to the
+// broker, Listen gets called once by the hub with the function every event has to be delivered to,
+// including the events this instance published itself.
+type Broker interface {
+	Publish(event Event) error
+	Listen(deliver func(Event)) error
+}
+
+// The broker of a single instance, events never leave the process.
+type LocalBroker struct {
+	deliver func(Event)
+}
+
+func (broker *LocalBroker) Publish(event Event) error {
+	if broker.deliver != nil {
+		broker.deliver(event)
+	}
+	return nil
+}
+
+func (broker *LocalBroker) Listen(deliver func(Event)) error {
+	broker.deliver = deliver
+	return nil
+}
+
+// Fans events out to the subscriptions of their topic. Every subscription has a buffer of its own,
+// a subscriber which falls that far behind gets dropped instead of holding up the publisher.
+type Hub struct {
+	broker      Broker
+	buffer      int
+	sequence    uint64
+	mutex       sync.RWMutex
+	subscribers map[string]map[*Subscription]bool
+}
+
+func NewHub(broker Broker, buffer int) *Hub {
+	if buffer < 1 {
+		buffer = 1
+	}
+	hub := &Hub{
+		broker:      broker,
+		buffer:      buffer,
+		subscribers: make(map[string]map[*Subscription]bool),
+	}
+	if err := broker.Listen(hub.deliver); err != nil {
+		fmt.Println("stream err: (NewHub) ", err)
+	}
+	return hub
+}
+
+// The hub of this instance, STREAM_BUFFER_SIZE events can wait for a slow subscriber before it's dropped.
+var Stream = NewHub(&LocalBroker{}, GetEnvInt("STREAM_BUFFER_SIZE", 32))
+
+// Publish an event about ref on topic.
+//
+//	err := Stream.Publish("comment", ArticleTopic(article.ID), comment.ID)
+func (hub *Hub) Publish(eventType, topic string, ref uint) error {
+	return hub.broker.Publish(Event{
+		ID:    atomic.AddUint64(&hub.sequence, 1),
+		Type:  eventType,
+		Topic: topic,
+		Ref:   ref,
+	})
+}
+
+func (hub *Hub) deliver(event Event) {
+	var lagging []*Subscription
+	hub.mutex.RLock()
+	for subscription := range hub.subscribers[event.Topic] {
+		select {
+		case subscription.events <- event:
+		default:
+			lagging = append(lagging, subscription)
+		}
+	}
+	hub.mutex.RUnlock()
+	for _, subscription := range lagging {
+		atomic.StoreInt32(&subscription.lagged, 1)
+		subscription.Close()
+	}
+}
+
+// Start receiving the events of topics, the subscription has to be closed once it's not needed anymore.
+//
+//	subscription := Stream.Subscribe(UserTopic(user.ID))
+//	defer subscription.Close()
+//	for event := range subscription.Events { ... }
+func (hub *Hub) Subscribe(topics ...string) *Subscription {
+	events := make(chan Event, hub.buffer)
+	subscription := &Subscription{Events: events, events: events, topics: topics, hub: hub}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, topic := range topics {
+		if hub.subscribers[topic] == nil {
+			hub.subscribers[topic] = make(map[*Subscription]bool)
+		}
+		hub.subscribers[topic][subscription] = true
+	}
+	return subscription
+}
+
+// The number of open subscriptions to topic.
+func (hub *Hub) Subscribers(topic string) int {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	return len(hub.subscribers[topic])
+}
+
+// Events gets closed once the subscription is, Lagged tells whether the hub closed it
+// because the subscriber didn't keep up.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	topics []string
+	hub    *Hub
+	lagged int32
+	closed bool
+}
+
+func (subscription *Subscription) Lagged() bool {
+	return atomic.LoadInt32(&subscription.lagged) == 1
+}
+
+// Stop receiving events, closing a subscription more than once is fine.
+func (subscription *Subscription) Close() {
+	hub := subscription.hub
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	for _, topic := range subscription.topics {
+		delete(hub.subscribers[topic], subscription)
+		if len(hub.subscribers[topic]) == 0 {
+			delete(hub.subscribers, topic)
+		}
+	}
+	close(subscription.events)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,12 +15,30 @@ import (
 )
 
 func Migrate(db *gorm.DB) {
+	db.AutoMigrate(&common.OutboxModel{})
+	db.AutoMigrate(&common.OutboxReceiptModel{})
 	users.AutoMigrate()
 	db.AutoMigrate(&articles.ArticleModel{})
 	db.AutoMigrate(&articles.TagModel{})
 	db.AutoMigrate(&articles.FavoriteModel{})
 	db.AutoMigrate(&articles.ArticleUserModel{})
 	db.AutoMigrate(&articles.CommentModel{})
+	db.AutoMigrate(&articles.ArticleRevisionModel{})
+	db.AutoMigrate(&articles.ArticleSlugModel{})
+	db.AutoMigrate(&articles.TagAliasModel{})
+	db.AutoMigrate(&articles.TagFollowModel{})
+	db.AutoMigrate(&articles.CommentEditModel{})
+	db.AutoMigrate(&articles.ReportModel{})
+	db.AutoMigrate(&articles.MentionModel{})
+	db.AutoMigrate(&articles.DigestSubscriptionModel{})
+	db.AutoMigrate(&articles.FeedTokenModel{})
+	db.AutoMigrate(&articles.ArticleImageModel{})
+	db.AutoMigrate(&articles.ReadingListModel{})
+	db.AutoMigrate(&articles.ReadingListItemModel{})
+	db.AutoMigrate(&articles.SeriesModel{})
+	db.AutoMigrate(&articles.SeriesPartModel{})
+	db.AutoMigrate(&articles.ArticleAuthorModel{})
+	db.AutoMigrate(&articles.ReactionModel{})
 }
 
 func main() {
@@ -28,6 +47,13 @@ func main() {
 	Migrate(db)
 	defer db.Close()
 
+	users.SubscribeEvents()
+	articles.SubscribeEvents()
+	go common.RunEventDispatcher(time.Second, nil)
+	go articles.RunTrashPurge(articles.TrashRetention, time.Hour, nil)
+	go users.RunWebhookDeliveries(10*time.Second, nil)
+	go articles.RunDigests(common.MailerFromEnv(), time.Hour, nil)
+
 	r := gin.Default()
 
 	// Configure CORS
@@ -38,6 +64,9 @@ func main() {
 		AllowCredentials: true,
 	}))
 
+	// Reject oversized request bodies with 413
+	r.Use(common.BodySizeLimit(int64(common.GetEnvInt("MAX_REQUEST_BODY_SIZE", 2<<20))))
+
 	// Security Headers Middleware
 	r.Use(func(c *gin.Context) {
 		// Prevent clickjacking attacks
@@ -72,13 +101,32 @@ func main() {
 	users.UsersRegister(v1.Group("/users"))
 	v1.Use(users.AuthMiddleware(false))
 	articles.ArticlesAnonymousRegister(v1.Group("/articles"))
+	articles.SeriesAnonymousRegister(v1.Group("/series"))
 	articles.TagsAnonymousRegister(v1.Group("/tags"))
+	articles.DigestAnonymousRegister(v1.Group("/digest"))
 
 	v1.Use(users.AuthMiddleware(true))
 	users.UserRegister(v1.Group("/user"))
+	articles.TrashRegister(v1.Group("/user"))
+	articles.UserTagsRegister(v1.Group("/user"))
+	articles.UserDigestRegister(v1.Group("/user"))
+	articles.UserFeedTokenRegister(v1.Group("/user"))
+	articles.UserReadingListRegister(v1.Group("/user"))
+	articles.UserInvitationRegister(v1.Group("/user"))
+	articles.TagsRegister(v1.Group("/tags"))
 	users.ProfileRegister(v1.Group("/profiles"))
 
 	articles.ArticlesRegister(v1.Group("/articles"))
+	articles.SeriesRegister(v1.Group("/series"))
+	articles.StreamRegister(v1.Group("/stream"))
+
+	articles.ModerationRegister(v1.Group("/moderation", users.RequireRole(users.RoleModerator)))
+
+	admin := v1.Group("/admin", users.RequireRole(users.RoleAdmin))
+	articles.TagsAdminRegister(admin.Group("/tags"))
+
+	articles.SitemapRegister(r.Group("/"))
+	r.GET("/api/media/*key", common.ServeMedia)
 
 	testAuth := r.Group("/api/ping")
 
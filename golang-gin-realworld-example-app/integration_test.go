@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"realworld-backend/articles"
 	"realworld-backend/common"
@@ -24,13 +32,37 @@ func setupIntegrationTestRouter() *gin.Engine {
 
 	// Setup database
 	db := common.GetDB()
+	db.AutoMigrate(&common.OutboxModel{})
+	db.AutoMigrate(&common.OutboxReceiptModel{})
 	db.AutoMigrate(&users.UserModel{})
 	db.AutoMigrate(&users.FollowModel{})
+	db.AutoMigrate(&users.NotificationModel{})
+	db.AutoMigrate(&users.NotificationPreferenceModel{})
+	db.AutoMigrate(&users.WebhookModel{})
+	db.AutoMigrate(&users.WebhookDeliveryModel{})
 	db.AutoMigrate(&articles.ArticleModel{})
 	db.AutoMigrate(&articles.ArticleUserModel{})
 	db.AutoMigrate(&articles.FavoriteModel{})
 	db.AutoMigrate(&articles.TagModel{})
 	db.AutoMigrate(&articles.CommentModel{})
+	db.AutoMigrate(&articles.ArticleRevisionModel{})
+	db.AutoMigrate(&articles.ArticleSlugModel{})
+	db.AutoMigrate(&articles.TagAliasModel{})
+	db.AutoMigrate(&articles.TagFollowModel{})
+	db.AutoMigrate(&articles.CommentEditModel{})
+	db.AutoMigrate(&articles.ReportModel{})
+	db.AutoMigrate(&articles.MentionModel{})
+	db.AutoMigrate(&articles.DigestSubscriptionModel{})
+	db.AutoMigrate(&articles.FeedTokenModel{})
+	db.AutoMigrate(&articles.ArticleImageModel{})
+	db.AutoMigrate(&articles.ReadingListModel{})
+	db.AutoMigrate(&articles.ReadingListItemModel{})
+	db.AutoMigrate(&articles.SeriesModel{})
+	db.AutoMigrate(&articles.SeriesPartModel{})
+	db.AutoMigrate(&articles.ArticleAuthorModel{})
+	db.AutoMigrate(&articles.ReactionModel{})
+	users.SubscribeEvents()
+	articles.SubscribeEvents()
 
 	// Register routes - match main.go structure
 	v1 := r.Group("/api")
@@ -39,13 +71,28 @@ func setupIntegrationTestRouter() *gin.Engine {
 	v1Authenticated := r.Group("/api")
 	v1Authenticated.Use(users.AuthMiddleware(false))
 	articles.ArticlesAnonymousRegister(v1Authenticated.Group("/articles"))
+	articles.SeriesAnonymousRegister(v1Authenticated.Group("/series"))
 	articles.TagsAnonymousRegister(v1Authenticated.Group("/tags"))
+	articles.DigestAnonymousRegister(v1Authenticated.Group("/digest"))
 
 	v1Required := r.Group("/api")
 	v1Required.Use(users.AuthMiddleware(true))
 	users.UserRegister(v1Required.Group("/user"))
+	articles.TrashRegister(v1Required.Group("/user"))
+	articles.UserTagsRegister(v1Required.Group("/user"))
+	articles.UserDigestRegister(v1Required.Group("/user"))
+	articles.UserFeedTokenRegister(v1Required.Group("/user"))
+	articles.UserReadingListRegister(v1Required.Group("/user"))
+	articles.UserInvitationRegister(v1Required.Group("/user"))
+	articles.TagsRegister(v1Required.Group("/tags"))
 	users.ProfileRegister(v1Required.Group("/profiles"))
 	articles.ArticlesRegister(v1Required.Group("/articles"))
+	articles.SeriesRegister(v1Required.Group("/series"))
+	articles.StreamRegister(v1Required.Group("/stream"))
+	articles.ModerationRegister(v1Required.Group("/moderation", users.RequireRole(users.RoleModerator)))
+	articles.TagsAdminRegister(v1Required.Group("/admin/tags", users.RequireRole(users.RoleAdmin)))
+	articles.SitemapRegister(r.Group("/"))
+	r.GET("/api/media/*key", common.ServeMedia)
 
 	return r
 }
@@ -53,13 +100,36 @@ func setupIntegrationTestRouter() *gin.Engine {
 // Clean up database after tests
 func teardownIntegrationTest() {
 	db := common.GetDB()
+	db.DropTable(&articles.MentionModel{})
+	db.DropTable(&articles.DigestSubscriptionModel{})
+	db.DropTable(&articles.FeedTokenModel{})
+	db.DropTable(&articles.ArticleImageModel{})
+	db.DropTable(&articles.ReadingListModel{})
+	db.DropTable(&articles.ReadingListItemModel{})
+	db.DropTable(&articles.SeriesModel{})
+	db.DropTable(&articles.SeriesPartModel{})
+	db.DropTable(&articles.ArticleAuthorModel{})
+	db.DropTable(&articles.ReactionModel{})
+	db.DropTable(&articles.ReportModel{})
+	db.DropTable(&articles.CommentEditModel{})
+	db.DropTable(&articles.TagFollowModel{})
+	db.DropTable(&articles.TagAliasModel{})
+	db.DropTable(&articles.ArticleSlugModel{})
+	db.DropTable(&articles.ArticleRevisionModel{})
 	db.DropTable(&articles.CommentModel{})
 	db.DropTable(&articles.FavoriteModel{})
+	db.DropTable("article_tags")
 	db.DropTable(&articles.TagModel{})
 	db.DropTable(&articles.ArticleUserModel{})
 	db.DropTable(&articles.ArticleModel{})
+	db.DropTable(&users.WebhookDeliveryModel{})
+	db.DropTable(&users.WebhookModel{})
+	db.DropTable(&users.NotificationPreferenceModel{})
+	db.DropTable(&users.NotificationModel{})
 	db.DropTable(&users.FollowModel{})
 	db.DropTable(&users.UserModel{})
+	db.DropTable(&common.OutboxReceiptModel{})
+	db.DropTable(&common.OutboxModel{})
 }
 
 // Helper function to create a test user and return token
@@ -422,8 +492,6 @@ func TestUpdateArticleAsAuthor(t *testing.T) {
 }
 
 // TestUpdateArticleUnauthorized tests updating article by non-author
-// NOTE: This test reveals a bug in the backend - it doesn't check article ownership
-// The backend currently allows any authenticated user to update any article
 func TestUpdateArticleUnauthorized(t *testing.T) {
 	router := setupIntegrationTestRouter()
 	defer teardownIntegrationTest()
@@ -466,10 +534,7 @@ func TestUpdateArticleUnauthorized(t *testing.T) {
 	req.Header.Set("Authorization", "Token "+token2)
 	router.ServeHTTP(w, req)
 
-	// Bug: Backend doesn't validate ownership, returns 200 instead of 403
-	// assert.Equal(t, http.StatusForbidden, w.Code)
-	// For now, we document this as a known issue
-	assert.Equal(t, http.StatusOK, w.Code) // Should be 403, but backend has bug
+	assert.Equal(t, http.StatusForbidden, w.Code)
 }
 
 // TestDeleteArticleAsAuthor tests deleting an article as the author
@@ -513,8 +578,6 @@ func TestDeleteArticleAsAuthor(t *testing.T) {
 }
 
 // TestDeleteArticleUnauthorized tests deleting article by non-author
-// NOTE: This test reveals a bug - backend doesn't check article ownership for delete
-// The backend currently allows any authenticated user to delete any article
 func TestDeleteArticleUnauthorized(t *testing.T) {
 	router := setupIntegrationTestRouter()
 	defer teardownIntegrationTest()
@@ -550,10 +613,7 @@ func TestDeleteArticleUnauthorized(t *testing.T) {
 	req.Header.Set("Authorization", "Token "+token2)
 	router.ServeHTTP(w, req)
 
-	// Bug: Backend doesn't validate ownership, returns 200 instead of 403
-	// assert.Equal(t, http.StatusForbidden, w.Code)
-	// For now, we document this as a known issue
-	assert.Equal(t, http.StatusOK, w.Code) // Should be 403, but backend has bug
+	assert.Equal(t, http.StatusForbidden, w.Code)
 }
 
 // ========== Article Interaction Tests ==========
@@ -810,6 +870,27 @@ func TestDeleteComment(t *testing.T) {
 	comment := commentResponse["comment"].(map[string]interface{})
 	commentID := int(comment["id"].(float64))
 
+	// Someone else can't delete it, not even through an article of their own
+	token3 := createTestUser(t, router, "stranger3", "stranger3@example.com", "password123")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(`{"article": {"title": "Stranger Article", "description": "Description", "body": "Body"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token3)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/articles/%s/comments/%d", slug, commentID), nil)
+	req.Header.Set("Authorization", "Token "+token3)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/articles/stranger-article/comments/%d", commentID), nil)
+	req.Header.Set("Authorization", "Token "+token3)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
 	// Delete comment
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/articles/%s/comments/%d", slug, commentID), nil)
@@ -817,4 +898,1808 @@ func TestDeleteComment(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The article author can delete comments on it too
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(`{"comment": {"body": "Another comment"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token2)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	commentID = int(commentResponse["comment"].(map[string]interface{})["id"].(float64))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/articles/%s/comments/%d", slug, commentID), nil)
+	req.Header.Set("Authorization", "Token "+token1)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// ========== Article Revision Tests ==========
+
+// TestArticleRevisionHistory tests listing, diffing and restoring article revisions
+func TestArticleRevisionHistory(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "reviser", "reviser@example.com", "password123")
+
+	articleJSON := `{
+		"article": {
+			"title": "Revision Article",
+			"description": "Description",
+			"body": "line one\nline two"
+		}
+	}`
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	updateJSON := `{"article": {"body": "line one\nline 2"}}`
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/articles/"+slug, bytes.NewBufferString(updateJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// List revisions
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/revisions", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, float64(2), listResponse["revisionsCount"])
+
+	// Diff revision 2 against revision 1
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/revisions/2/diff", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var diffResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &diffResponse)
+	body := diffResponse["diff"].(map[string]interface{})["body"].([]interface{})
+	assert.Equal(t, 3, len(body))
+
+	// Another user can't restore
+	token2 := createTestUser(t, router, "notreviser", "notreviser@example.com", "password123")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/revisions/1/restore", nil)
+	req.Header.Set("Authorization", "Token "+token2)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The author restores revision 1
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/revisions/1/restore", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var restoreResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &restoreResponse)
+	assert.Equal(t, "line one\nline two", restoreResponse["article"].(map[string]interface{})["body"])
+
+	// Unknown revision
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/revisions/9", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Revisions of a hidden article are only visible to its author
+	common.GetDB().Model(&articles.ArticleModel{}).Where("slug = ?", slug).Update("hidden", true)
+	for _, path := range []string{"/revisions", "/revisions/1", "/revisions/2/diff"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/articles/"+slug+path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/revisions", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// ========== Slug Tests ==========
+
+// TestArticleSlugsAreUniqueAndStable tests slug suffixing, stable slugs and old slug redirects
+func TestArticleSlugsAreUniqueAndStable(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "slugger", "slugger@example.com", "password123")
+
+	// Same title, different bodies, an exact repost would be rejected as a duplicate
+	createArticle := func(body string) string {
+		articleJSON := fmt.Sprintf(`{"article": {"title": "Duplicate Title", "description": "Description", "body": "%s"}}`, body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["article"].(map[string]interface{})["slug"].(string)
+	}
+	assert.Equal(t, "duplicate-title", createArticle("First body"))
+	slug := createArticle("Second body")
+	assert.Equal(t, "duplicate-title-2", slug)
+
+	updateArticle := func(updateJSON string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/articles/"+slug, bytes.NewBufferString(updateJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["article"].(map[string]interface{})["slug"].(string)
+	}
+
+	// A title edit keeps the slug
+	assert.Equal(t, "duplicate-title-2", updateArticle(`{"article": {"title": "Renamed Title"}}`))
+
+	// Asking for it moves the slug to the new title
+	assert.Equal(t, "renamed-title", updateArticle(`{"article": {"title": "Renamed Title", "updateSlug": true}}`))
+
+	// The old slug redirects
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/articles/"+slug, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/api/articles/renamed-title", w.Header().Get("Location"))
+
+	// Unknown slugs are still not found
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/never-existed", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestArticleBodyHTML tests the sanitized HTML rendering of article and comment bodies
+func TestArticleBodyHTML(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "markdowner", "markdowner@example.com", "password123")
+
+	articleJSON := `{"article": {"title": "Markdown Article", "description": "Description", "body": "## Heading\n\n<script>alert(1)</script>"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	article := createResponse["article"].(map[string]interface{})
+	assert.NotContains(t, article, "bodyHtml")
+	slug := article["slug"].(string)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"?render=html", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	bodyHTML := response["article"].(map[string]interface{})["bodyHtml"].(string)
+	assert.Contains(t, bodyHTML, "<h2>Heading</h2>")
+	assert.NotContains(t, bodyHTML, "<script")
+
+	commentJSON := `{"comment": {"body": "[x](javascript:alert(1)) *hi*"}}`
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments?render=html", bytes.NewBufferString(commentJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var commentResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	commentHTML := commentResponse["comment"].(map[string]interface{})["bodyHtml"].(string)
+	assert.Contains(t, commentHTML, "<em>hi</em>")
+	assert.NotContains(t, commentHTML, "javascript:")
+}
+
+// TestLongArticleBodies tests bodies over the old 2048 limit, the configured limit and list excerpts
+func TestLongArticleBodies(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "longwriter", "longwriter@example.com", "password123")
+
+	postArticle := func(title, body string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"article": map[string]interface{}{"title": title, "description": "Description", "body": body},
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	longBody := strings.Repeat("word ", 1000)
+	w := postArticle("Long Article", longBody)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	defaultLimit := articles.MaxArticleBodySize
+	articles.MaxArticleBodySize = 100
+	w = postArticle("Too Long Article", longBody)
+	articles.MaxArticleBodySize = defaultLimit
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Lists carry an excerpt instead of the body
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/articles/", nil)
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	article := response["articles"].([]interface{})[0].(map[string]interface{})
+	assert.NotContains(t, article, "body")
+	assert.True(t, strings.HasSuffix(article["excerpt"].(string), "…"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/?includeBody=true", nil)
+	router.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), &response)
+	article = response["articles"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, longBody, article["body"])
+}
+
+// ========== Trash Tests ==========
+
+// TestTrashAndRestore tests listing the trash and restoring deleted articles and comments
+func TestTrashAndRestore(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "trasher", "trasher@example.com", "password123")
+
+	articleJSON := `{"article": {"title": "Trash Article", "description": "Description", "body": "Body"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	commentJSON := `{"comment": {"body": "Trash comment"}}`
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(commentJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var commentResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	commentID := int(commentResponse["comment"].(map[string]interface{})["id"].(float64))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/articles/%s/comments/%d", slug, commentID), nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/articles/"+slug, nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	getTrash := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/user/trash", nil)
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["trash"].(map[string]interface{})
+	}
+
+	trash := getTrash()
+	trashedArticles := trash["articles"].([]interface{})
+	assert.Equal(t, 1, len(trashedArticles))
+	assert.Equal(t, slug, trashedArticles[0].(map[string]interface{})["slug"])
+	assert.Equal(t, 0, len(trash["comments"].([]interface{})))
+
+	// Another user can't restore it
+	token2 := createTestUser(t, router, "nottrasher", "nottrasher@example.com", "password123")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/user/trash/articles/"+slug+"/restore", nil)
+	req.Header.Set("Authorization", "Token "+token2)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/user/trash/articles/"+slug+"/restore", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// With the article back, the comment shows up in the trash
+	trash = getTrash()
+	assert.Equal(t, 0, len(trash["articles"].([]interface{})))
+	assert.Equal(t, 1, len(trash["comments"].([]interface{})))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/user/trash/comments/%d/restore", commentID), nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/comments", nil)
+	router.ServeHTTP(w, req)
+
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, 1, len(listResponse["comments"].([]interface{})))
+}
+
+// ========== Tag Tests ==========
+
+// TestTagCountsAndAdmin tests tag counts and the admin-only tag endpoints
+func TestTagCountsAndAdmin(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "tagger", "tagger@example.com", "password123")
+
+	for i, tags := range []string{`["Go", "web"]`, `["go"]`, `["golang"]`} {
+		articleJSON := fmt.Sprintf(`{"article": {"title": "Tagged %d", "description": "Description", "body": "Body", "tagList": %s}}`, i, tags)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/tags/?sort=popular&limit=1", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, []interface{}{"go"}, response["tags"])
+	tagCount := response["tagCounts"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(2), tagCount["articlesCount"])
+
+	// Regular users can't merge
+	mergeJSON := `{"tag": {"into": "go"}}`
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/admin/tags/golang/merge", bytes.NewBufferString(mergeJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	common.GetDB().Model(&users.UserModel{}).Where("username = ?", "tagger").Update("role", users.RoleAdmin)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/admin/tags/golang/merge", bytes.NewBufferString(mergeJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	renameJSON := `{"tag": {"name": "Web Development"}}`
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/admin/tags/web", bytes.NewBufferString(renameJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/tags/", nil)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, []interface{}{"go", "web-development"}, response["tags"])
+
+	// The old name still finds the articles
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/?tag=golang", nil)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(3), response["articlesCount"])
+}
+
+// TestTagFollowFeed tests following tags and the feed including followed tags
+func TestTagFollowFeed(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	writerToken := createTestUser(t, router, "tagwriter", "tagwriter@example.com", "password123")
+	articleJSON := `{"article": {"title": "Tagged For Feed", "description": "Description", "body": "Body", "tagList": ["feeds"]}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+writerToken)
+	router.ServeHTTP(w, req)
+
+	token := createTestUser(t, router, "tagreader", "tagreader@example.com", "password123")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/tags/Feeds/follow", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, map[string]interface{}{"tag": "feeds", "following": true}, response["tag"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/tags/missing/follow", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/user/tags", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, []interface{}{"feeds"}, response["tags"])
+
+	getFeed := func(query string) float64 {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/articles/feed"+query, nil)
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["articlesCount"].(float64)
+	}
+	assert.Equal(t, float64(0), getFeed(""))
+	assert.Equal(t, float64(1), getFeed("?include=tags"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/tags/feeds/follow", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(0), getFeed("?include=tags"))
+}
+
+// ========== Threaded Comment Tests ==========
+
+// TestThreadedCommentReplies tests replying to comments, the tree view and tombstones
+func TestThreadedCommentReplies(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "threader", "threader@example.com", "password123")
+
+	articleJSON := `{"article": {"title": "Threaded Article", "description": "Description", "body": "Body"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	postComment := func(commentJSON string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(commentJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		comment, _ := response["comment"].(map[string]interface{})
+		return w.Code, comment
+	}
+
+	code, root := postComment(`{"comment": {"body": "Root comment"}}`)
+	assert.Equal(t, http.StatusCreated, code)
+	rootID := int(root["id"].(float64))
+
+	code, reply := postComment(fmt.Sprintf(`{"comment": {"body": "Reply", "parentId": %d}}`, rootID))
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, float64(rootID), reply["parentId"])
+
+	code, _ = postComment(`{"comment": {"body": "Orphan", "parentId": 999}}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// A hidden comment takes no replies, and a hidden article no comments from readers
+	common.GetDB().Model(&articles.CommentModel{}).Where("id = ?", int(reply["id"].(float64))).Update("hidden", true)
+	code, _ = postComment(fmt.Sprintf(`{"comment": {"body": "Reply to hidden", "parentId": %d}}`, int(reply["id"].(float64))))
+	assert.Equal(t, http.StatusNotFound, code)
+	common.GetDB().Model(&articles.CommentModel{}).Where("id = ?", int(reply["id"].(float64))).Update("hidden", false)
+
+	readerToken := createTestUser(t, router, "threadreader", "threadreader@example.com", "password123")
+	common.GetDB().Model(&articles.ArticleModel{}).Where("slug = ?", slug).Update("hidden", true)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(`{"comment": {"body": "Sneaky"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+readerToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	common.GetDB().Model(&articles.ArticleModel{}).Where("slug = ?", slug).Update("hidden", false)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/articles/%s/comments/%d", slug, rootID), nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/comments?view=tree", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	comments := response["comments"].([]interface{})
+	assert.Equal(t, 1, len(comments))
+	tombstone := comments[0].(map[string]interface{})
+	assert.Equal(t, true, tombstone["deleted"])
+	assert.Nil(t, tombstone["author"])
+	assert.Equal(t, float64(1), tombstone["repliesCount"])
+	replies := tombstone["replies"].([]interface{})
+	assert.Equal(t, "Reply", replies[0].(map[string]interface{})["body"])
+}
+
+// TestEditComment tests editing a comment by its author and reading the history as a moderator
+func TestEditComment(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "editor", "editor@example.com", "password123")
+
+	articleJSON := `{"article": {"title": "Edited Article", "description": "Description", "body": "Body"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(`{"comment": {"body": "Typo commnet"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var commentResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	comment := commentResponse["comment"].(map[string]interface{})
+	assert.Equal(t, false, comment["edited"])
+	commentURL := fmt.Sprintf("/api/articles/%s/comments/%d", slug, int(comment["id"].(float64)))
+
+	editComment := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", commentURL, bytes.NewBufferString(`{"comment": {"body": "Fixed comment"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	otherToken := createTestUser(t, router, "noteditor", "noteditor@example.com", "password123")
+	assert.Equal(t, http.StatusForbidden, editComment(otherToken).Code)
+
+	w = editComment(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	comment = commentResponse["comment"].(map[string]interface{})
+	assert.Equal(t, "Fixed comment", comment["body"])
+	assert.Equal(t, true, comment["edited"])
+
+	// Only moderators see the history
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", commentURL+"/edits", nil)
+	req.Header.Set("Authorization", "Token "+otherToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	common.GetDB().Model(&users.UserModel{}).Where("username = ?", "noteditor").Update("role", users.RoleModerator)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", commentURL+"/edits", nil)
+	req.Header.Set("Authorization", "Token "+otherToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var editsResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &editsResponse)
+	edits := editsResponse["edits"].([]interface{})
+	assert.Equal(t, 1, len(edits))
+	assert.Equal(t, "Typo commnet", edits[0].(map[string]interface{})["body"])
+}
+
+// TestCommentPagination tests paging and sorting comments and the commentsCount of an article
+func TestCommentPagination(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "pager", "pager@example.com", "password123")
+
+	articleJSON := `{"article": {"title": "Paged Article", "description": "Description", "body": "Body"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	for i := 1; i <= 3; i++ {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(fmt.Sprintf(`{"comment": {"body": "Comment %d"}}`, i)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/comments?limit=2&offset=0&sort=newest", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(3), response["commentsCount"])
+	comments := response["comments"].([]interface{})
+	assert.Equal(t, 2, len(comments))
+	assert.Equal(t, "Comment 3", comments[0].(map[string]interface{})["body"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/comments?limit=2&offset=2", nil)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	comments = response["comments"].([]interface{})
+	assert.Equal(t, 1, len(comments))
+	assert.Equal(t, "Comment 3", comments[0].(map[string]interface{})["body"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug, nil)
+	router.ServeHTTP(w, req)
+	var articleResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &articleResponse)
+	assert.Equal(t, float64(3), articleResponse["article"].(map[string]interface{})["commentsCount"])
+}
+
+// ========== Moderation Tests ==========
+
+// TestReportAndModerate tests reporting a comment and a moderator acting on the report
+func TestReportAndModerate(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "spammer", "spammer@example.com", "password123")
+	readerToken := createTestUser(t, router, "reader", "reader@example.com", "password123")
+	moderatorToken := createTestUser(t, router, "moderator", "moderator@example.com", "password123")
+	common.GetDB().Model(&users.UserModel{}).Where("username = ?", "moderator").Update("role", users.RoleModerator)
+
+	articleJSON := `{"article": {"title": "Reported Article", "description": "Description", "body": "Body"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(`{"comment": {"body": "Cheap pills"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	var commentResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	commentID := int(commentResponse["comment"].(map[string]interface{})["id"].(float64))
+
+	report := func(reportJSON string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/articles/%s/comments/%d/report", slug, commentID), bytes.NewBufferString(reportJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+readerToken)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, report(`{"report": {"reason": "boring"}}`).Code)
+	assert.Equal(t, http.StatusCreated, report(`{"report": {"reason": "spam", "note": "Pharmacy spam"}}`).Code)
+	assert.Equal(t, http.StatusConflict, report(`{"report": {"reason": "spam"}}`).Code)
+
+	// Only moderators see the queue
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/moderation/reports", nil)
+	req.Header.Set("Authorization", "Token "+readerToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/moderation/reports", nil)
+	req.Header.Set("Authorization", "Token "+moderatorToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var queueResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &queueResponse)
+	assert.Equal(t, float64(1), queueResponse["reportsCount"])
+	queued := queueResponse["reports"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "spam", queued["reason"])
+	assert.Equal(t, "Cheap pills", queued["comment"].(map[string]interface{})["body"])
+	assert.Equal(t, "spammer", queued["author"].(map[string]interface{})["username"])
+	assert.Equal(t, slug, queued["article"].(map[string]interface{})["slug"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/moderation/reports/%d/resolve", int(queued["id"].(float64))),
+		bytes.NewBufferString(`{"resolution": {"actions": ["hide", "suspend"], "suspendDays": 3}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+moderatorToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The hidden comment drops out of the listing and its author can't write any more
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug+"/comments", nil)
+	router.ServeHTTP(w, req)
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, 0, len(listResponse["comments"].([]interface{})))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+slug+"/comments", bytes.NewBufferString(`{"comment": {"body": "More pills"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestContentFilter tests banned words being rejected and links from new accounts being quarantined
+func TestContentFilter(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	defaultFilters := articles.ContentFilters
+	articles.ContentFilters = append(common.ContentFilters{common.NewBannedWordsFilter([]string{"casino"}, common.VerdictReject)}, defaultFilters...)
+	defer func() { articles.ContentFilters = defaultFilters }()
+
+	token := createTestUser(t, router, "newbie", "newbie@example.com", "password123")
+
+	postArticle := func(articleJSON string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := postArticle(`{"article": {"title": "Casino Night", "description": "Description", "body": "Body"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	verdict := response["errors"].(map[string]interface{})["content"].(map[string]interface{})
+	assert.Equal(t, "reject", verdict["action"])
+	assert.Equal(t, "banned-words", verdict["rule"])
+
+	code, response = postArticle(`{"article": {"title": "My Homepage", "description": "Description", "body": "Visit https://example.com"}}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, "new-account", response["verdict"].(map[string]interface{})["rule"])
+	slug := response["article"].(map[string]interface{})["slug"].(string)
+
+	// Held back from readers until a moderator lets it through
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/articles/"+slug, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/articles/"+slug, nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Restoring a revision written before the word got banned is filtered like an edit
+	code, response = postArticle(`{"article": {"title": "Game Night", "description": "Description", "body": "Board games"}}`)
+	assert.Equal(t, http.StatusCreated, code)
+	article, _ := articles.FindOneArticle(&articles.ArticleModel{Slug: "game-night"})
+	common.GetDB().Create(&articles.ArticleRevisionModel{ArticleID: article.ID, Number: 2, AuthorID: article.AuthorID, Title: "Game Night", Body: "Casino games"})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/game-night/revisions/2/restore", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	article, _ = articles.FindOneArticle(&articles.ArticleModel{Slug: "game-night"})
+	assert.Equal(t, "Board games", article.Body)
+}
+
+// ========== Notification Tests ==========
+
+// TestNotifications tests notifications for follows, favorites and comments, reading them and preferences
+func TestNotifications(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "famous", "famous@example.com", "password123")
+	fanToken := createTestUser(t, router, "bigfan", "bigfan@example.com", "password123")
+
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/articles/", authorToken, `{"article": {"title": "Popular Article", "description": "Description", "body": "Body"}}`)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	slug := createResponse["article"].(map[string]interface{})["slug"].(string)
+
+	assert.Equal(t, http.StatusOK, request("POST", "/api/profiles/famous/follow", fanToken, "").Code)
+	assert.Equal(t, http.StatusOK, request("POST", "/api/articles/"+slug+"/favorite", fanToken, "").Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/api/articles/"+slug+"/comments", fanToken, `{"comment": {"body": "Great read"}}`).Code)
+	// Authors don't hear about their own comments
+	assert.Equal(t, http.StatusCreated, request("POST", "/api/articles/"+slug+"/comments", authorToken, `{"comment": {"body": "Thanks"}}`).Code)
+	// Notifications are sent once the events get dispatched
+	common.DispatchEvents()
+
+	w = request("GET", "/api/user/notifications?limit=2", authorToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(3), response["notificationsCount"])
+	assert.Equal(t, float64(3), response["unreadCount"])
+	notifications := response["notifications"].([]interface{})
+	assert.Equal(t, 2, len(notifications))
+	newest := notifications[0].(map[string]interface{})
+	assert.Equal(t, "comment", newest["type"])
+	assert.Equal(t, "bigfan", newest["actor"].(map[string]interface{})["username"])
+	assert.Equal(t, slug, newest["article"].(map[string]interface{})["slug"])
+
+	w = request("POST", fmt.Sprintf("/api/user/notifications/%d/read", int(newest["id"].(float64))), authorToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(2), response["unreadCount"])
+	assert.Equal(t, http.StatusNotFound, request("POST", fmt.Sprintf("/api/user/notifications/%d/read", int(newest["id"].(float64))), fanToken, "").Code)
+
+	assert.Equal(t, http.StatusOK, request("POST", "/api/user/notifications/read", authorToken, "").Code)
+	w = request("GET", "/api/user/notifications?unread=true", authorToken, "")
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(0), response["notificationsCount"])
+
+	// Turned off comment notifications are not delivered
+	assert.Equal(t, http.StatusUnprocessableEntity, request("PUT", "/api/user/notifications/preferences", authorToken, `{"preferences": {"gossip": false}}`).Code)
+	w = request("PUT", "/api/user/notifications/preferences", authorToken, `{"preferences": {"comment": false}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	preferences := response["preferences"].(map[string]interface{})
+	assert.Equal(t, false, preferences["comment"])
+	assert.Equal(t, true, preferences["follow"])
+	w = request("PUT", "/api/user/notifications/preferences", authorToken, `{"preferences": {"invitation": false}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, false, response["preferences"].(map[string]interface{})["invitation"])
+	request("POST", "/api/articles/"+slug+"/comments", fanToken, `{"comment": {"body": "Another one"}}`)
+	common.DispatchEvents()
+	w = request("GET", "/api/user/notifications", authorToken, "")
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(0), response["unreadCount"])
+}
+
+// TestMentions tests @username mentions in articles and comments and the notifications they send
+func TestMentions(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	token := createTestUser(t, router, "writer", "writer@example.com", "password123")
+	friendToken := createTestUser(t, router, "friend", "friend@example.com", "password123")
+
+	articleJSON := `{"article": {"title": "Shout Out", "description": "Description", "body": "Thanks @friend and @stranger"}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(articleJSON))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	article := createResponse["article"].(map[string]interface{})
+	mentions := article["mentions"].([]interface{})
+	assert.Equal(t, 1, len(mentions))
+	assert.Equal(t, "friend", mentions[0].(map[string]interface{})["username"])
+	assert.Equal(t, "/api/profiles/friend", mentions[0].(map[string]interface{})["profile"])
+	assert.Equal(t, "Thanks @friend and @stranger", article["body"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/articles/"+article["slug"].(string)+"/comments", bytes.NewBufferString(`{"comment": {"body": "@writer you're welcome"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+friendToken)
+	router.ServeHTTP(w, req)
+	var commentResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &commentResponse)
+	commentMentions := commentResponse["comment"].(map[string]interface{})["mentions"].([]interface{})
+	assert.Equal(t, "writer", commentMentions[0].(map[string]interface{})["username"])
+
+	common.DispatchEvents()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/user/notifications", nil)
+	req.Header.Set("Authorization", "Token "+friendToken)
+	router.ServeHTTP(w, req)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	notifications := response["notifications"].([]interface{})
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, "mention", notifications[0].(map[string]interface{})["type"])
+}
+
+// TestStream tests the Server-Sent Events stream of comments, followed authors and notifications
+func TestStream(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	token := createTestUser(t, router, "listener", "listener@example.com", "password123")
+	authorToken := createTestUser(t, router, "streamer", "streamer@example.com", "password123")
+	send := func(method, path, body, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	send("POST", "/api/profiles/streamer/follow", "", token)
+	w := send("POST", "/api/articles/", `{"article": {"title": "Live", "description": "Description", "body": "Watch this"}}`, authorToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	common.DispatchEvents()
+
+	w = send("GET", "/api/stream?articles=missing", "", token)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/stream?articles=live", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan [2]string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		var eventType string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "event: ") {
+				eventType = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				events <- [2]string{eventType, strings.TrimPrefix(line, "data: ")}
+			}
+		}
+		close(events)
+	}()
+	next := func() (string, map[string]interface{}) {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("Stream ended")
+			}
+			var data map[string]interface{}
+			json.Unmarshal([]byte(event[1]), &data)
+			return event[0], data
+		case <-time.After(5 * time.Second):
+			t.Fatal("No event received")
+		}
+		return "", nil
+	}
+
+	eventType, _ := next()
+	assert.Equal(t, "ready", eventType)
+
+	send("POST", "/api/articles/live/comments", `{"comment": {"body": "Going live now"}}`, authorToken)
+	common.DispatchEvents()
+	eventType, data := next()
+	assert.Equal(t, "comment", eventType)
+	assert.Equal(t, "Going live now", data["comment"].(map[string]interface{})["body"])
+	assert.Equal(t, "live", data["article"].(map[string]interface{})["slug"])
+
+	send("POST", "/api/articles/", `{"article": {"title": "Encore", "description": "Description", "body": "One more"}}`, authorToken)
+	common.DispatchEvents()
+	eventType, data = next()
+	assert.Equal(t, "article", eventType)
+	assert.Equal(t, "encore", data["article"].(map[string]interface{})["slug"])
+
+	send("POST", "/api/profiles/listener/follow", "", authorToken)
+	common.DispatchEvents()
+	eventType, data = next()
+	assert.Equal(t, "notification", eventType)
+	assert.Equal(t, "follow", data["notification"].(map[string]interface{})["type"])
+}
+
+// TestWebhooks tests registering a webhook, signed deliveries, retries and the delivery log
+func TestWebhooks(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	type received struct {
+		event     string
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan received, 10)
+	status := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		deliveries <- received{r.Header.Get("X-Webhook-Event"), r.Header.Get("X-Webhook-Signature"), body}
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	token := createTestUser(t, router, "hooked", "hooked@example.com", "password123")
+	otherToken := createTestUser(t, router, "bystander", "bystander@example.com", "password123")
+	send := func(method, path, body, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/api/user/webhooks", `{"webhook": {"url": "ftp://example.com", "events": ["article.created"]}}`, token)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = send("POST", "/api/user/webhooks", `{"webhook": {"url": "`+receiver.URL+`", "events": ["article.published"]}}`, token)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = send("POST", "/api/user/webhooks", `{"webhook": {"url": "http://169.254.169.254/latest/meta-data", "events": ["article.created"]}}`, token)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = send("POST", "/api/user/webhooks", `{"webhook": {"url": "`+receiver.URL+`", "events": ["article.created"]}}`, token)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// The receiver runs on loopback
+	users.WebhookAllowPrivate = true
+	defer func() { users.WebhookAllowPrivate = false }()
+
+	w = send("POST", "/api/user/webhooks", `{"webhook": {"url": "`+receiver.URL+`", "events": ["article.created", "comment.created"]}}`, token)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	webhook := response["webhook"].(map[string]interface{})
+	secret := webhook["secret"].(string)
+	assert.NotEmpty(t, secret)
+	assert.Equal(t, true, webhook["active"])
+	webhookPath := fmt.Sprintf("/api/user/webhooks/%v", webhook["id"])
+
+	w = send("GET", "/api/user/webhooks", "", token)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	listed := response["webhooks"].([]interface{})[0].(map[string]interface{})
+	assert.Nil(t, listed["secret"], "Secret should only be shown on creation")
+	assert.Equal(t, http.StatusNotFound, send("GET", webhookPath+"/deliveries", "", otherToken).Code)
+
+	// Only events involving the owner are delivered, signed with the secret
+	send("POST", "/api/articles/", `{"article": {"title": "Not Mine", "description": "Description", "body": "Someone else"}}`, otherToken)
+	send("POST", "/api/articles/", `{"article": {"title": "Hooked On", "description": "Description", "body": "Deliver me"}}`, token)
+	common.DispatchEvents()
+	count, err := users.DeliverWebhooks(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	delivery := <-deliveries
+	assert.Equal(t, "article.created", delivery.event)
+	assert.Equal(t, users.SignWebhookPayload(secret, delivery.body), delivery.signature)
+	var payload map[string]interface{}
+	json.Unmarshal(delivery.body, &payload)
+	assert.Equal(t, "article.created", payload["event"])
+	assert.Equal(t, "hooked-on", payload["data"].(map[string]interface{})["slug"])
+	assert.Equal(t, "hooked", payload["data"].(map[string]interface{})["author"])
+
+	// A failing receiver gets retried after a backoff
+	status = http.StatusInternalServerError
+	send("POST", "/api/articles/hooked-on/comments", `{"comment": {"body": "Knock knock"}}`, otherToken)
+	common.DispatchEvents()
+	now := time.Now()
+	count, _ = users.DeliverWebhooks(now)
+	assert.Equal(t, 1, count)
+	<-deliveries
+	count, _ = users.DeliverWebhooks(now)
+	assert.Equal(t, 0, count, "Failed delivery should wait for its retry")
+	w = send("GET", webhookPath+"/deliveries", "", token)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	latest := response["deliveries"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "comment.created", latest["event"])
+	assert.Equal(t, "pending", latest["status"])
+	assert.Equal(t, float64(1), latest["attempts"])
+	assert.Equal(t, float64(500), latest["responseStatus"])
+	assert.NotNil(t, latest["nextAttemptAt"])
+
+	status = http.StatusOK
+	count, _ = users.DeliverWebhooks(now.Add(users.WebhookBackoff(1) + time.Second))
+	assert.Equal(t, 1, count)
+	delivery = <-deliveries
+	json.Unmarshal(delivery.body, &payload)
+	assert.Equal(t, "Knock knock", payload["data"].(map[string]interface{})["body"])
+	w = send("GET", webhookPath+"/deliveries", "", token)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, float64(2), response["deliveriesCount"])
+	latest = response["deliveries"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "delivered", latest["status"])
+	assert.Equal(t, float64(2), latest["attempts"])
+	assert.Nil(t, latest["nextAttemptAt"])
+
+	// Deactivated webhooks get nothing
+	w = send("PUT", webhookPath, `{"webhook": {"active": false}}`, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	send("PUT", "/api/articles/hooked-on", `{"article": {"body": "Changed"}}`, token)
+	send("POST", "/api/articles/hooked-on/comments", `{"comment": {"body": "Anyone there"}}`, otherToken)
+	common.DispatchEvents()
+	count, _ = users.DeliverWebhooks(time.Now())
+	assert.Equal(t, 0, count)
+	assert.Equal(t, http.StatusOK, send("DELETE", webhookPath, "", token).Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", webhookPath+"/deliveries", "", token).Code)
+}
+
+// ========== Digest Tests ==========
+
+// TestDigest tests subscribing to the email digest, receiving it and unsubscribing through its link
+func TestDigest(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "prolific", "prolific@example.com", "password123")
+	readerToken := createTestUser(t, router, "digester", "digester@example.com", "password123")
+
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/api/user/digest", readerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"frequency":"off"`)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("PUT", "/api/user/digest", readerToken, `{"digest": {"frequency": "hourly"}}`).Code)
+	w = request("PUT", "/api/user/digest", readerToken, `{"digest": {"frequency": "weekly"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"frequency":"weekly"`)
+
+	assert.Equal(t, http.StatusOK, request("POST", "/api/profiles/prolific/follow", readerToken, "").Code)
+	request("POST", "/api/articles/", authorToken, `{"article": {"title": "Digest Material", "description": "Description", "body": "Body"}}`)
+
+	mailer := &common.MemoryMailer{}
+	sent, err := articles.SendDigests(mailer, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	message := mailer.Messages()[0]
+	assert.Equal(t, "digester@example.com", message.To)
+	assert.Contains(t, message.Text, "Digest Material by prolific")
+
+	w = request("GET", "/api/user/digest", readerToken, "")
+	assert.Contains(t, w.Body.String(), `"lastSentAt":"`)
+
+	link := strings.Trim(message.Headers["List-Unsubscribe"], "<>")
+	assert.Equal(t, "List-Unsubscribe=One-Click", message.Headers["List-Unsubscribe-Post"])
+	unsubscribe := link[strings.Index(link, "/api/"):]
+	assert.Equal(t, http.StatusNotFound, request("POST", unsubscribe+"x", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", unsubscribe+"x", "", "").Code)
+
+	// Opening the link only asks to confirm
+	w = request("GET", unsubscribe, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `<form method="post"`)
+	w = request("GET", "/api/user/digest", readerToken, "")
+	assert.NotContains(t, w.Body.String(), `"frequency":"off"`)
+
+	w = request("POST", unsubscribe, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"frequency":"off"`)
+	w = request("GET", "/api/user/digest", readerToken, "")
+	assert.Contains(t, w.Body.String(), `"frequency":"off"`)
+}
+
+// ========== Syndication Tests ==========
+
+// TestSyndicationFeeds tests the RSS and Atom feeds, their caching headers and private feed tokens
+func TestSyndicationFeeds(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "syndicated", "syndicated@example.com", "password123")
+	readerToken := createTestUser(t, router, "feedreader", "feedreader@example.com", "password123")
+
+	request := func(method, url, token string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(""))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/articles/", bytes.NewBufferString(`{"article": {"title": "Syndicated Article", "description": "Description", "body": "Body", "tagList": ["rss"]}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+authorToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = request("GET", "/api/articles/feed.rss", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<title>Syndicated Article</title>")
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, lastModified)
+	assert.Equal(t, http.StatusNotModified, request("GET", "/api/articles/feed.rss", "", map[string]string{"If-None-Match": etag}).Code)
+	assert.Equal(t, http.StatusNotModified, request("GET", "/api/articles/feed.rss", "", map[string]string{"If-Modified-Since": lastModified}).Code)
+
+	w = request("GET", "/api/articles/feed.atom?tag=rss", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`)
+	assert.Contains(t, w.Body.String(), "<name>syndicated</name>")
+	assert.Contains(t, w.Body.String(), `<category term="rss"></category>`)
+	w = request("GET", "/api/articles/feed.atom?author=feedreader", "", nil)
+	assert.NotContains(t, w.Body.String(), "<entry>")
+
+	// The private feed works with the feed token alone, until it's revoked
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/user/feed-token", readerToken, nil).Code)
+	w = request("POST", "/api/user/feed-token", readerToken, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	feedToken := response["feedToken"].(map[string]interface{})
+	rssURL := feedToken["rss"].(string)
+	assert.Contains(t, rssURL, "/api/articles/feed.rss?token="+feedToken["token"].(string))
+	privateFeed := rssURL[strings.Index(rssURL, "/api/"):]
+	w = request("GET", privateFeed, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<item>")
+
+	assert.Equal(t, http.StatusOK, request("POST", "/api/profiles/syndicated/follow", readerToken, nil).Code)
+	w = request("GET", privateFeed, "", nil)
+	assert.Contains(t, w.Body.String(), "<title>Syndicated Article</title>")
+	assert.Contains(t, w.Body.String(), "feedreader&#39;s feed")
+
+	assert.Equal(t, http.StatusOK, request("DELETE", "/api/user/feed-token", readerToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", privateFeed, "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/articles/feed.rss?token=guess", "", nil).Code)
+}
+
+// ========== SEO Tests ==========
+
+// TestSitemapAndMeta tests the sitemap, its index once it gets too big, and article preview metadata
+func TestSitemapAndMeta(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "seowriter", "seowriter@example.com", "password123")
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	var slugs []string
+	// New accounts can't post links, so the cover is relative to the frontend
+	for i, title := range []string{"Search Engines", "Link Previews"} {
+		w := request("POST", "/api/articles/", authorToken, fmt.Sprintf(`{"article": {"title": "%v", "description": "About %v", "body": "![cover](/covers/%v.png)", "tagList": ["seo"]}}`, title, title, i))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var created map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		slugs = append(slugs, created["article"].(map[string]interface{})["slug"].(string))
+	}
+
+	w := request("GET", "/sitemap.xml", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	assert.Contains(t, w.Body.String(), "/article/"+slugs[0]+"</loc>")
+	assert.Contains(t, w.Body.String(), "/profile/seowriter</loc>")
+	assert.Contains(t, w.Body.String(), "/?tag=seo</loc>")
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	// Four urls don't fit in pages of three
+	maxURLs := articles.SitemapMaxURLs
+	articles.SitemapMaxURLs = 3
+	defer func() { articles.SitemapMaxURLs = maxURLs }()
+	w = request("GET", "/sitemap.xml", "", "")
+	assert.Contains(t, w.Body.String(), `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	assert.Contains(t, w.Body.String(), "/sitemaps/2.xml</loc>")
+	assert.NotContains(t, w.Body.String(), "/sitemaps/3.xml")
+	w = request("GET", "/sitemaps/2.xml", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "<url>"))
+	assert.Contains(t, w.Body.String(), "/?tag=seo</loc>")
+	assert.Equal(t, http.StatusNotFound, request("GET", "/sitemaps/3.xml", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/sitemaps/latest.xml", "", "").Code)
+
+	w = request("GET", "/api/articles/"+slugs[0]+"/meta", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	meta := response["meta"].(map[string]interface{})
+	assert.Equal(t, "Search Engines", meta["title"])
+	assert.Equal(t, "About Search Engines", meta["description"])
+	assert.Equal(t, "seowriter", meta["author"])
+	assert.Equal(t, common.AppURL+"/covers/0.png", meta["image"])
+	assert.NotEmpty(t, meta["publishedTime"])
+	openGraph := meta["openGraph"].(map[string]interface{})
+	assert.Equal(t, "article", openGraph["og:type"])
+	assert.Equal(t, meta["url"], openGraph["og:url"])
+	assert.Equal(t, "summary_large_image", meta["twitter"].(map[string]interface{})["twitter:card"])
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/articles/no-such-article/meta", "", "").Code)
+}
+
+// ========== Upload Tests ==========
+
+// TestImageUploads tests avatar and article image uploads, their signed URLs and the media route
+func TestImageUploads(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+	media := common.Media
+	common.Media = common.LocalStorage{Dir: t.TempDir(), BaseURL: common.APIURL + "/api/media"}
+	defer func() { common.Media = media }()
+
+	authorToken := createTestUser(t, router, "uploader", "uploader@example.com", "password123")
+	otherToken := createTestUser(t, router, "bystander", "bystander@example.com", "password123")
+
+	picture := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	var pictureData bytes.Buffer
+	png.Encode(&pictureData, picture)
+	upload := func(url, token string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("image", "upload.jpg")
+		part.Write(data)
+		form.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Authorization", "Token "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	fetch := func(link string) *httptest.ResponseRecorder {
+		return request("GET", strings.TrimPrefix(link, common.APIURL), "", "")
+	}
+
+	// Avatars are cropped to a square and served through signed URLs
+	assert.Equal(t, http.StatusUnsupportedMediaType, upload("/api/user/avatar", authorToken, []byte("not an image")).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("POST", "/api/user/avatar", authorToken, "").Code)
+	w := upload("/api/user/avatar", authorToken, pictureData.Bytes())
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	avatar := response["user"].(map[string]interface{})["image"].(string)
+	assert.Contains(t, avatar, "/api/media/avatars/")
+	w = fetch(avatar)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	config, _, err := image.DecodeConfig(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{users.AvatarSize, users.AvatarSize}, []int{config.Width, config.Height})
+	assert.Equal(t, http.StatusForbidden, fetch(strings.Split(avatar, "?")[0]).Code)
+	w = request("GET", "/api/profiles/uploader", otherToken, "")
+	assert.Contains(t, w.Body.String(), "/api/media/avatars/")
+
+	// An image URL replaces the upload
+	w = request("PUT", "/api/user/", authorToken, `{"user": {"image": "https://example.com/me.png"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"image":"https://example.com/me.png"`)
+	assert.Equal(t, http.StatusNotFound, fetch(avatar).Code)
+
+	// Article images get a thumbnail, only the author can add or remove them
+	w = request("POST", "/api/articles/", authorToken, `{"article": {"title": "Illustrated", "description": "Description", "body": "Body"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusForbidden, upload("/api/articles/illustrated/images", otherToken, pictureData.Bytes()).Code)
+	w = upload("/api/articles/illustrated/images", authorToken, pictureData.Bytes())
+	assert.Equal(t, http.StatusCreated, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	uploaded := response["image"].(map[string]interface{})
+	assert.Equal(t, float64(600), uploaded["width"])
+	assert.Equal(t, "image/png", uploaded["contentType"])
+	w = fetch(uploaded["thumbnailUrl"].(string))
+	assert.Equal(t, http.StatusOK, w.Code)
+	config, _, _ = image.DecodeConfig(w.Body)
+	assert.Equal(t, []int{articles.ArticleThumbnailSize, articles.ArticleThumbnailSize / 2}, []int{config.Width, config.Height})
+
+	w = request("GET", "/api/articles/illustrated/images", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 1, len(response["images"].([]interface{})))
+	link := uploaded["link"].(string)
+	w = request("GET", strings.TrimPrefix(link, common.APIURL), "", "")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, http.StatusOK, fetch(w.Header().Get("Location")).Code)
+
+	imagePath := strings.TrimPrefix(link, common.APIURL)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", imagePath, otherToken, "").Code)
+	assert.Equal(t, http.StatusOK, request("DELETE", imagePath, authorToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", imagePath, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, fetch(uploaded["url"].(string)).Code)
+}
+
+// ========== Reading List Tests ==========
+
+// TestReadingLists tests private reading lists, the bookmarked flag and listing a list's articles
+func TestReadingLists(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "listauthor", "listauthor@example.com", "password123")
+	readerToken := createTestUser(t, router, "listreader", "listreader@example.com", "password123")
+	otherToken := createTestUser(t, router, "listother", "listother@example.com", "password123")
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for _, title := range []string{"Saved One", "Saved Two", "Saved Three"} {
+		w := request("POST", "/api/articles/", authorToken, fmt.Sprintf(`{"article": {"title": "%v", "description": "Description", "body": "Body of %v"}}`, title, title))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := request("POST", "/api/user/lists", readerToken, `{"list": {"name": "Weekend"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	listPath := fmt.Sprintf("/api/user/lists/%v", response["list"].(map[string]interface{})["id"])
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/user/lists", readerToken, `{"list": {"name": "Weekend"}}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("POST", "/api/user/lists", readerToken, `{"list": {}}`).Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", listPath, otherToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/api/user/lists", "", "").Code)
+
+	for _, slug := range []string{"saved-one", "saved-two", "saved-three"} {
+		assert.Equal(t, http.StatusOK, request("POST", listPath+"/articles/"+slug, readerToken, "").Code)
+	}
+	assert.Equal(t, http.StatusNotFound, request("POST", listPath+"/articles/missing", readerToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", listPath+"/articles/saved-one", otherToken, "").Code)
+	w = request("PUT", listPath+"/articles", readerToken, `{"articles": ["saved-three", "saved-two"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"articlesCount":3`)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("PUT", listPath+"/articles", readerToken, `{"articles": ["missing"]}`).Code)
+
+	listID := strings.TrimPrefix(listPath, "/api/user/lists/")
+	w = request("GET", "/api/articles/?list="+listID, readerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	var slugs []string
+	for _, article := range response["articles"].([]interface{}) {
+		assert.Equal(t, true, article.(map[string]interface{})["bookmarked"])
+		slugs = append(slugs, article.(map[string]interface{})["slug"].(string))
+	}
+	assert.Equal(t, []string{"saved-three", "saved-two", "saved-one"}, slugs)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/articles/?list="+listID, otherToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/articles/?list="+listID, "", "").Code)
+
+	// Bookmarks are private, unlike favorites
+	assert.Contains(t, request("GET", "/api/articles/saved-one", readerToken, "").Body.String(), `"bookmarked":true`)
+	assert.Contains(t, request("GET", "/api/articles/saved-one", otherToken, "").Body.String(), `"bookmarked":false`)
+	assert.Contains(t, request("GET", "/api/articles/saved-one", readerToken, "").Body.String(), `"favoritesCount":0`)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", listPath+"/articles/saved-one", readerToken, "").Code)
+	assert.Contains(t, request("GET", "/api/articles/saved-one", readerToken, "").Body.String(), `"bookmarked":false`)
+	w = request("PUT", listPath, readerToken, `{"list": {"name": "Someday"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Someday"`)
+	w = request("GET", "/api/user/lists", readerToken, "")
+	assert.Contains(t, w.Body.String(), `"articlesCount":2`)
+	assert.Equal(t, http.StatusOK, request("DELETE", listPath, readerToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", listPath, readerToken, "").Code)
+	assert.Contains(t, request("GET", "/api/articles/saved-two", readerToken, "").Body.String(), `"bookmarked":false`)
+}
+
+// ========== Series Tests ==========
+
+// TestArticleSeries tests creating a series, ordering its parts and the series info on articles
+func TestArticleSeries(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "seriesauthor", "seriesauthor@example.com", "password123")
+	otherToken := createTestUser(t, router, "seriesother", "seriesother@example.com", "password123")
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for _, title := range []string{"Tutorial Part One", "Tutorial Part Two", "Tutorial Part Three"} {
+		w := request("POST", "/api/articles/", authorToken, fmt.Sprintf(`{"article": {"title": "%v", "description": "Description", "body": "Body of %v"}}`, title, title))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	w := request("POST", "/api/articles/", otherToken, `{"article": {"title": "Not Yours", "description": "Description", "body": "Body"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = request("POST", "/api/series/", authorToken, `{"series": {"title": "Learn Go", "description": "From zero"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"slug":"learn-go"`)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("POST", "/api/series/", authorToken, `{"series": {}}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/api/series/", "", `{"series": {"title": "Learn Go"}}`).Code)
+
+	for _, slug := range []string{"tutorial-part-one", "tutorial-part-two", "tutorial-part-three"} {
+		assert.Equal(t, http.StatusOK, request("POST", "/api/series/learn-go/articles/"+slug, authorToken, "").Code)
+	}
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/series/learn-go/articles/not-yours", authorToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/series/learn-go/articles/tutorial-part-one", otherToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/series/missing/articles/tutorial-part-one", authorToken, "").Code)
+	request("POST", "/api/series/", authorToken, `{"series": {"title": "Another Series"}}`)
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/series/another-series/articles/tutorial-part-one", authorToken, "").Code)
+
+	w = request("PUT", "/api/series/learn-go/articles", authorToken, `{"articles": ["tutorial-part-one", "tutorial-part-three"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("PUT", "/api/series/learn-go/articles", authorToken, `{"articles": ["not-yours"]}`).Code)
+
+	w = request("GET", "/api/series/learn-go", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	series := response["series"].(map[string]interface{})
+	assert.Equal(t, "Learn Go", series["title"])
+	assert.Equal(t, "seriesauthor", series["author"].(map[string]interface{})["username"])
+	var slugs []string
+	for _, part := range series["articles"].([]interface{}) {
+		slugs = append(slugs, part.(map[string]interface{})["slug"].(string))
+	}
+	assert.Equal(t, []string{"tutorial-part-one", "tutorial-part-three", "tutorial-part-two"}, slugs)
+
+	w = request("GET", "/api/articles/tutorial-part-three", "", "")
+	json.Unmarshal(w.Body.Bytes(), &response)
+	info := response["article"].(map[string]interface{})["series"].(map[string]interface{})
+	assert.Equal(t, "learn-go", info["slug"])
+	assert.Equal(t, float64(2), info["position"])
+	assert.Equal(t, float64(3), info["partsCount"])
+	assert.Equal(t, "tutorial-part-one", info["prev"])
+	assert.Equal(t, "tutorial-part-two", info["next"])
+	w = request("GET", "/api/articles/tutorial-part-one", "", "")
+	assert.Contains(t, w.Body.String(), `"prev":null`)
+	assert.NotContains(t, request("GET", "/api/articles/not-yours", "", "").Body.String(), `"series"`)
+
+	assert.Equal(t, http.StatusForbidden, request("PUT", "/api/series/learn-go", otherToken, `{"series": {"title": "Hijacked"}}`).Code)
+	w = request("PUT", "/api/series/learn-go", authorToken, `{"series": {"title": "Learn Go Properly"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"Learn Go Properly"`)
+	assert.Contains(t, w.Body.String(), `"slug":"learn-go"`)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", "/api/series/learn-go/articles/tutorial-part-three", authorToken, "").Code)
+	w = request("GET", "/api/articles/tutorial-part-one", "", "")
+	assert.Contains(t, w.Body.String(), `"next":"tutorial-part-two"`)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/api/series/learn-go", otherToken, "").Code)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/api/series/learn-go", authorToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/series/learn-go", "", "").Code)
+	assert.NotContains(t, request("GET", "/api/articles/tutorial-part-one", "", "").Body.String(), `"series"`)
+}
+
+// ========== Co-Author Tests ==========
+
+// TestCoauthoredArticles tests inviting co-authors, their edit rights and the authors of an article
+func TestCoauthoredArticles(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	ownerToken := createTestUser(t, router, "leadwriter", "leadwriter@example.com", "password123")
+	coauthorToken := createTestUser(t, router, "cowriter", "cowriter@example.com", "password123")
+	outsiderToken := createTestUser(t, router, "outsider", "outsider@example.com", "password123")
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := request("POST", "/api/articles/", ownerToken, `{"article": {"title": "Joint Work", "description": "Description", "body": "Body"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Only the owner invites, and only once
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/articles/joint-work/authors", outsiderToken, `{"author": {"username": "cowriter"}}`).Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/articles/joint-work/authors", ownerToken, `{"author": {"username": "nobody"}}`).Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/articles/joint-work/authors", ownerToken, `{"author": {"username": "leadwriter"}}`).Code)
+	w = request("POST", "/api/articles/joint-work/authors", ownerToken, `{"author": {"username": "cowriter"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/articles/joint-work/authors", ownerToken, `{"author": {"username": "cowriter"}}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("PUT", "/api/articles/joint-work", coauthorToken, `{"article": {"title": "Joint Work"}}`).Code)
+
+	common.DispatchEvents()
+	w = request("GET", "/api/user/notifications", coauthorToken, "")
+	assert.Contains(t, w.Body.String(), `"type":"invitation"`)
+	w = request("GET", "/api/articles/joint-work/authors", ownerToken, "")
+	assert.Contains(t, w.Body.String(), `"invitations":[{`)
+	assert.NotContains(t, request("GET", "/api/articles/joint-work/authors", "", "").Body.String(), "invitations")
+
+	w = request("GET", "/api/user/invitations", coauthorToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	invitations := response["invitations"].([]interface{})
+	assert.Equal(t, 1, len(invitations))
+	invitation := invitations[0].(map[string]interface{})
+	assert.Equal(t, "joint-work", invitation["article"].(map[string]interface{})["slug"])
+	assert.Equal(t, "leadwriter", invitation["invitedBy"].(map[string]interface{})["username"])
+	acceptPath := fmt.Sprintf("/api/user/invitations/%v/accept", invitation["id"])
+	assert.Equal(t, http.StatusNotFound, request("POST", acceptPath, outsiderToken, "").Code)
+	assert.Equal(t, http.StatusOK, request("POST", acceptPath, coauthorToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", acceptPath, coauthorToken, "").Code)
+
+	// Co-authors edit without taking the article over, the owner keeps deleting to themselves
+	w = request("PUT", "/api/articles/joint-work", coauthorToken, `{"article": {"title": "Joint Work", "body": "Rewritten together"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	article := response["article"].(map[string]interface{})
+	assert.Equal(t, "leadwriter", article["author"].(map[string]interface{})["username"])
+	authors := article["authors"].([]interface{})
+	assert.Equal(t, 2, len(authors))
+	assert.Equal(t, "leadwriter", authors[0].(map[string]interface{})["username"])
+	assert.Equal(t, "owner", authors[0].(map[string]interface{})["role"])
+	assert.Equal(t, "cowriter", authors[1].(map[string]interface{})["username"])
+	assert.Equal(t, "coauthor", authors[1].(map[string]interface{})["role"])
+	assert.Equal(t, http.StatusForbidden, request("PUT", "/api/articles/joint-work", outsiderToken, `{"article": {"title": "Joint Work"}}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/api/articles/joint-work", coauthorToken, "").Code)
+	w = request("GET", "/api/articles/joint-work/revisions", "", "")
+	assert.Contains(t, w.Body.String(), `"username":"cowriter"`)
+
+	w = request("GET", "/api/articles/?author=cowriter", "", "")
+	assert.Contains(t, w.Body.String(), `"articlesCount":1`)
+	assert.Contains(t, w.Body.String(), `"slug":"joint-work"`)
+
+	// Co-authors leave by themselves, the owner can't
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/api/articles/joint-work/authors/cowriter", outsiderToken, "").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("DELETE", "/api/articles/joint-work/authors/leadwriter", ownerToken, "").Code)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/api/articles/joint-work/authors/cowriter", coauthorToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, request("PUT", "/api/articles/joint-work", coauthorToken, `{"article": {"title": "Joint Work"}}`).Code)
+	assert.Contains(t, request("GET", "/api/articles/?author=cowriter", "", "").Body.String(), `"articlesCount":0`)
+
+	// Declined invitations are gone
+	request("POST", "/api/articles/joint-work/authors", ownerToken, `{"author": {"username": "cowriter"}}`)
+	json.Unmarshal(request("GET", "/api/user/invitations", coauthorToken, "").Body.Bytes(), &response)
+	invitation = response["invitations"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, http.StatusOK, request("POST", fmt.Sprintf("/api/user/invitations/%v/decline", invitation["id"]), coauthorToken, "").Code)
+	assert.Contains(t, request("GET", "/api/user/invitations", coauthorToken, "").Body.String(), `"invitations":[]`)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/api/articles/joint-work", ownerToken, "").Code)
+}
+
+// ========== Reaction Tests ==========
+
+// TestReactions tests toggling reactions on articles and comments and how they show in responses
+func TestReactions(t *testing.T) {
+	router := setupIntegrationTestRouter()
+	defer teardownIntegrationTest()
+
+	authorToken := createTestUser(t, router, "reactauthor", "reactauthor@example.com", "password123")
+	readerToken := createTestUser(t, router, "reactreader", "reactreader@example.com", "password123")
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := request("POST", "/api/articles/", authorToken, `{"article": {"title": "Reacted To", "description": "Description", "body": "Body"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"myReactions":[]`)
+	w = request("POST", "/api/articles/reacted-to/comments", authorToken, `{"comment": {"body": "First comment"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	commentPath := fmt.Sprintf("/api/articles/reacted-to/comments/%v", response["comment"].(map[string]interface{})["id"])
+
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/api/articles/reacted-to/reactions/like", "", "").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request("POST", "/api/articles/reacted-to/reactions/angry", readerToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/articles/missing/reactions/like", readerToken, "").Code)
+	w = request("POST", "/api/articles/reacted-to/reactions/like", readerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	article := response["article"].(map[string]interface{})
+	assert.Equal(t, float64(1), article["reactions"].(map[string]interface{})["like"])
+	assert.Equal(t, float64(0), article["reactions"].(map[string]interface{})["love"])
+	assert.Equal(t, []interface{}{"like"}, article["myReactions"])
+	request("POST", "/api/articles/reacted-to/reactions/like", authorToken, "")
+	request("POST", "/api/articles/reacted-to/reactions/love", readerToken, "")
+	w = request("POST", "/api/articles/reacted-to/reactions/love", readerToken, "")
+	assert.Contains(t, w.Body.String(), `"love":0`)
+
+	w = request("POST", commentPath+"/reactions/hooray", readerToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"hooray":1`)
+	assert.Contains(t, w.Body.String(), `"myReactions":["hooray"]`)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/articles/reacted-to/comments/999/reactions/hooray", readerToken, "").Code)
+
+	// Lists carry the counts and the reactions of whoever is asking
+	w = request("GET", "/api/articles/", authorToken, "")
+	json.Unmarshal(w.Body.Bytes(), &response)
+	article = response["articles"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(2), article["reactions"].(map[string]interface{})["like"])
+	assert.Equal(t, []interface{}{"like"}, article["myReactions"])
+	w = request("GET", "/api/articles/reacted-to/comments", "", "")
+	json.Unmarshal(w.Body.Bytes(), &response)
+	comment := response["comments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(1), comment["reactions"].(map[string]interface{})["hooray"])
+	assert.Equal(t, []interface{}{}, comment["myReactions"])
+	assert.Contains(t, request("GET", "/api/articles/reacted-to/comments", readerToken, "").Body.String(), `"myReactions":["hooray"]`)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", commentPath, authorToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", commentPath+"/reactions/hooray", readerToken, "").Code)
 }
@@ -1,6 +1,7 @@
 package users
 
 import (
+	"errors"
 	"net/http"
 	"realworld-backend/common"
 	"strings"
@@ -71,5 +72,25 @@ func AuthMiddleware(auto401 bool) gin.HandlerFunc {
 			my_user_id := uint(claims["id"].(float64))
 			UpdateContextUserModel(c, my_user_id)
 		}
+
+		// Suspended users keep read access only
+		myUserModel := c.MustGet("my_user_model").(UserModel)
+		if auto401 && myUserModel.IsSuspended() && c.Request.Method != http.MethodGet {
+			c.AbortWithStatusJSON(http.StatusForbidden, common.NewError("permission", errors.New("Account suspended until "+myUserModel.SuspendedUntil.UTC().Format("2006-01-02T15:04:05.999Z"))))
+			return
+		}
+	}
+}
+
+// Only let users holding role through, it needs AuthMiddleware(true) in front of it.
+//
+//	r.Use(AuthMiddleware(true), RequireRole(RoleAdmin))
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		myUserModel := c.MustGet("my_user_model").(UserModel)
+		if !myUserModel.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, common.NewError("permission", errors.New("Require role "+role)))
+			return
+		}
 	}
 }
@@ -1,10 +1,24 @@
 package users
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/jinzhu/gorm"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"realworld-backend/common"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // Models should only be concerned with database schema, more strict checking should be put in validator.
@@ -19,6 +33,56 @@ type UserModel struct {
 	Bio          string  `gorm:"column:bio;size:1024"`
 	Image        *string `gorm:"column:image"`
 	PasswordHash string  `gorm:"column:password;not null"`
+	Role         string  `gorm:"column:role"`
+	// An uploaded avatar in common.Media, it takes the place of Image, see ImageURL
+	ImageKey string `gorm:"column:image_key"`
+	// Set on sign up, accounts made before it was tracked have none
+	JoinedAt *time.Time `gorm:"column:joined_at"`
+	// Moderation record, see Warn and Suspend
+	Warnings       uint       `gorm:"column:warnings"`
+	SuspendedUntil *time.Time `gorm:"column:suspended_until"`
+}
+
+// Roles granting extra rights, an empty Role is a regular user.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Admins hold every role.
+// 	if myUserModel.HasRole(RoleModerator) { ... }
+func (u UserModel) HasRole(role string) bool {
+	return u.Role != "" && (u.Role == role || u.Role == RoleAdmin)
+}
+
+// A suspended user can still sign in and read, but not write anything.
+func (u UserModel) IsSuspended() bool {
+	return u.SuspendedUntil != nil && u.SuspendedUntil.After(time.Now())
+}
+
+// Count a moderator warning against the user.
+// 	err := userModel.Warn()
+func (u *UserModel) Warn() error {
+	db := common.GetDB()
+	err := db.Model(u).UpdateColumn("warnings", gorm.Expr("warnings + 1")).Error
+	if err == nil {
+		u.Warnings++
+	}
+	return err
+}
+
+// Keep the user from writing until the given time, a suspension also counts as a warning.
+// 	err := userModel.Suspend(time.Now().Add(7 * 24 * time.Hour))
+func (u *UserModel) Suspend(until time.Time) error {
+	if err := u.Warn(); err != nil {
+		return err
+	}
+	db := common.GetDB()
+	err := db.Model(u).UpdateColumn("suspended_until", until).Error
+	if err == nil {
+		u.SuspendedUntil = &until
+	}
+	return err
 }
 
 // A hack way to save ManyToMany relationship,
@@ -39,12 +103,128 @@ type FollowModel struct {
 	FollowedByID uint
 }
 
+// Published when Follower starts following Following.
+type UserFollowed struct {
+	FollowerID  uint `json:"followerId"`
+	FollowingID uint `json:"followingId"`
+}
+
+func (UserFollowed) EventName() string { return "user.followed" }
+
+// Kinds of notifications, every one is on until the user turns it off.
+const (
+	NotificationFollow     = "follow"
+	NotificationFavorite   = "favorite"
+	NotificationComment    = "comment"
+	NotificationReply      = "reply"
+	NotificationMention    = "mention"
+	NotificationInvitation = "invitation"
+)
+
+var NotificationTypes = []string{NotificationFollow, NotificationFavorite, NotificationComment, NotificationReply, NotificationMention, NotificationInvitation}
+
+// Recipient learns that Actor did something, Type tells what. The article is copied by slug and title
+// as this package knows nothing about articles, CommentID is 0 unless it's about a comment.
+type NotificationModel struct {
+	gorm.Model
+	Recipient    UserModel
+	RecipientID  uint `gorm:"index"`
+	Actor        UserModel
+	ActorID      uint
+	Type         string
+	ArticleSlug  string
+	ArticleTitle string
+	CommentID    uint
+	ReadAt       *time.Time
+}
+
+// A user turning a type of notifications on or off, no row means on.
+type NotificationPreferenceModel struct {
+	gorm.Model
+	User    UserModel
+	UserID  uint
+	Type    string
+	Enabled bool
+}
+
+// Events a webhook can subscribe to.
+const (
+	WebhookArticleCreated = "article.created"
+	WebhookArticleUpdated = "article.updated"
+	WebhookArticleDeleted = "article.deleted"
+	WebhookCommentCreated = "comment.created"
+	WebhookCommentUpdated = "comment.updated"
+	WebhookUserFollowed   = "user.followed"
+)
+
+var WebhookEvents = []string{WebhookArticleCreated, WebhookArticleUpdated, WebhookArticleDeleted, WebhookCommentCreated, WebhookCommentUpdated, WebhookUserFollowed}
+
+// An endpoint Owner gets events POSTed to, Events is a space separated list of WebhookEvents and
+// Secret signs every payload. Regular users hear about events involving them, admins about every event.
+type WebhookModel struct {
+	gorm.Model
+	Owner   UserModel
+	OwnerID uint `gorm:"index"`
+	URL     string
+	Secret  string
+	Events  string
+	Active  bool
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// An event on its way to a webhook, kept afterwards as the delivery log. A pending delivery is
+// tried at NextAttemptAt until the receiver answers with a 2xx or WebhookMaxAttempts are used up.
+type WebhookDeliveryModel struct {
+	gorm.Model
+	Webhook        WebhookModel
+	WebhookID      uint `gorm:"index"`
+	Key            string `gorm:"index"`
+	Event          string
+	Payload        string `gorm:"type:text"`
+	Status         string `gorm:"index"`
+	Attempts       int
+	NextAttemptAt  time.Time
+	ResponseStatus int
+	Error          string `gorm:"size:1024"`
+}
+
+// WEBHOOK_MAX_ATTEMPTS tries, 8 by default, WEBHOOK_RETRY_DELAY (30s) after the first failure, doubling
+// after every other one. Receivers get WEBHOOK_TIMEOUT (10s) to answer.
+// Loopback, private and link-local receivers are refused unless WEBHOOK_ALLOW_PRIVATE is "true".
+var (
+	WebhookMaxAttempts  = common.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	WebhookRetryDelay   = common.GetEnvDuration("WEBHOOK_RETRY_DELAY", 30*time.Second)
+	WebhookAllowPrivate = common.GetEnv("WEBHOOK_ALLOW_PRIVATE", "") == "true"
+	WebhookClient       = &http.Client{
+		Timeout: common.GetEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		// The address is checked again once resolved, so a host can't be pointed inside after registering.
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: webhookDialControl}).DialContext,
+		},
+		// Redirects aren't followed, a 3xx counts as a failed delivery.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+var errWebhookAddress = errors.New("Webhooks can't be delivered to private addresses")
+
 // Migrate the schema of database if needed
 func AutoMigrate() {
 	db := common.GetDB()
 
 	db.AutoMigrate(&UserModel{})
 	db.AutoMigrate(&FollowModel{})
+	db.AutoMigrate(&NotificationModel{})
+	db.AutoMigrate(&NotificationPreferenceModel{})
+	db.AutoMigrate(&WebhookModel{})
+	db.AutoMigrate(&WebhookDeliveryModel{})
 }
 
 // What's bcrypt? https://en.wikipedia.org/wiki/Bcrypt
@@ -95,16 +275,52 @@ func (model *UserModel) Update(data interface{}) error {
 	return err
 }
 
+// Uploaded avatars are cropped to squares of AVATAR_SIZE pixels, 256 by default.
+var AvatarSize = common.GetEnvInt("AVATAR_SIZE", 256)
+
+// The avatar to show, a signed link to the uploaded one or the URL the user gave.
+func (model UserModel) ImageURL() *string {
+	if model.ImageKey != "" {
+		return common.MediaURL(model.ImageKey)
+	}
+	return model.Image
+}
+
+// Replace the avatar with the uploaded one at key, or remove it with "". The old upload is deleted.
+func (model *UserModel) setAvatar(key string) error {
+	db := common.GetDB()
+	oldKey := model.ImageKey
+	err := db.Model(model).Updates(map[string]interface{}{"image_key": key, "image": nil}).Error
+	if err != nil {
+		return err
+	}
+	model.ImageKey, model.Image = key, nil
+	if oldKey != "" && oldKey != key {
+		if err := common.Media.Delete(oldKey); err != nil {
+			fmt.Println("media err: (setAvatar) ", err)
+		}
+	}
+	return nil
+}
+
 // You could add a following relationship as userModel1 following userModel2
 // 	err = userModel1.following(userModel2)
 func (u UserModel) following(v UserModel) error {
-	db := common.GetDB()
-	var follow FollowModel
-	err := db.FirstOrCreate(&follow, &FollowModel{
-		FollowingID:  v.ID,
-		FollowedByID: u.ID,
-	}).Error
-	return err
+	return common.Transaction(func(tx *gorm.DB) error {
+		var follow FollowModel
+		tx.Where(FollowModel{
+			FollowingID:  v.ID,
+			FollowedByID: u.ID,
+		}).First(&follow)
+		if follow.ID != 0 {
+			return nil
+		}
+		follow = FollowModel{FollowingID: v.ID, FollowedByID: u.ID}
+		if err := tx.Create(&follow).Error; err != nil {
+			return err
+		}
+		return common.PublishEvent(tx, UserFollowed{FollowerID: u.ID, FollowingID: v.ID})
+	})
 }
 
 // You could check whether  userModel1 following userModel2
@@ -148,3 +364,418 @@ func (u UserModel) GetFollowings() []UserModel {
 	tx.Commit()
 	return followings
 }
+
+// Deliver a notification unless the actor notifies themselves, the recipient turned the type off
+// or the same notification is still waiting unread.
+// 	err := Notify(NotificationModel{RecipientID: author.ID, ActorID: myUserModel.ID, Type: NotificationFavorite})
+func Notify(notification NotificationModel) error {
+	if notification.RecipientID == 0 || notification.RecipientID == notification.ActorID {
+		return nil
+	}
+	recipient := UserModel{ID: notification.RecipientID}
+	if !recipient.notificationPreferences()[notification.Type] {
+		return nil
+	}
+	db := common.GetDB()
+	var count int
+	db.Model(&NotificationModel{}).Where(NotificationModel{
+		RecipientID: notification.RecipientID,
+		ActorID:     notification.ActorID,
+		Type:        notification.Type,
+		ArticleSlug: notification.ArticleSlug,
+		CommentID:   notification.CommentID,
+	}).Where("read_at IS NULL").Count(&count)
+	if count > 0 {
+		return nil
+	}
+	if err := db.Create(&notification).Error; err != nil {
+		return err
+	}
+	return common.Stream.Publish("notification", common.UserTopic(notification.RecipientID), notification.ID)
+}
+
+// One of the notifications of u, with its actor.
+func (u UserModel) FindNotification(id uint) (NotificationModel, error) {
+	db := common.GetDB()
+	var model NotificationModel
+	if err := db.Where(NotificationModel{RecipientID: u.ID}).First(&model, id).Error; err != nil {
+		return model, err
+	}
+	err := db.First(&model.Actor, model.ActorID).Error
+	return model, err
+}
+
+// The notifications of u, newest first, with the total number of them.
+// 	notifications, count, err := userModel.findNotifications(false, 20, 0)
+func (u UserModel) findNotifications(unreadOnly bool, limit, offset int) ([]NotificationModel, int, error) {
+	db := common.GetDB()
+	var models []NotificationModel
+	var count int
+	query := db.Model(&NotificationModel{}).Where(NotificationModel{RecipientID: u.ID})
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	query.Count(&count)
+	err := query.Order("id desc").Offset(offset).Limit(limit).Find(&models).Error
+	if err != nil {
+		return models, count, err
+	}
+	var actorIDs []uint
+	for _, model := range models {
+		actorIDs = append(actorIDs, model.ActorID)
+	}
+	var actors []UserModel
+	db.Where("id in (?)", actorIDs).Find(&actors)
+	actorsByID := map[uint]UserModel{}
+	for _, actor := range actors {
+		actorsByID[actor.ID] = actor
+	}
+	for i, _ := range models {
+		models[i].Actor = actorsByID[models[i].ActorID]
+	}
+	return models, count, nil
+}
+
+func (u UserModel) unreadNotificationsCount() int {
+	db := common.GetDB()
+	var count int
+	db.Model(&NotificationModel{}).Where(NotificationModel{RecipientID: u.ID}).Where("read_at IS NULL").Count(&count)
+	return count
+}
+
+// Mark one notification of u read, it's an error when u has no such notification.
+func (u UserModel) markNotificationRead(id uint) error {
+	db := common.GetDB()
+	var notification NotificationModel
+	if err := db.Where("id = ? AND recipient_id = ?", id, u.ID).First(&notification).Error; err != nil {
+		return err
+	}
+	if notification.ReadAt != nil {
+		return nil
+	}
+	err := db.Model(&notification).UpdateColumn("read_at", time.Now()).Error
+	return err
+}
+
+func (u UserModel) markAllNotificationsRead() error {
+	db := common.GetDB()
+	err := db.Model(&NotificationModel{}).Where(NotificationModel{RecipientID: u.ID}).Where("read_at IS NULL").UpdateColumn("read_at", time.Now()).Error
+	return err
+}
+
+// Whether u gets each type of notifications.
+func (u UserModel) notificationPreferences() map[string]bool {
+	preferences := map[string]bool{}
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = true
+	}
+	db := common.GetDB()
+	var models []NotificationPreferenceModel
+	db.Where(NotificationPreferenceModel{UserID: u.ID}).Find(&models)
+	for _, model := range models {
+		preferences[model.Type] = model.Enabled
+	}
+	return preferences
+}
+
+// Turn the given types of notifications on or off for u, other types stay as they are.
+func (u UserModel) setNotificationPreferences(preferences map[string]bool) error {
+	db := common.GetDB()
+	tx := db.Begin()
+	for notificationType, enabled := range preferences {
+		var model NotificationPreferenceModel
+		tx.Where(NotificationPreferenceModel{UserID: u.ID, Type: notificationType}).
+			Assign(map[string]interface{}{"enabled": enabled}).
+			FirstOrCreate(&model)
+	}
+	err := tx.Commit().Error
+	return err
+}
+
+func (w WebhookModel) eventList() []string {
+	return strings.Fields(w.Events)
+}
+
+func (w WebhookModel) subscribed(event string) bool {
+	for _, subscribed := range w.eventList() {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether webhooks may be delivered to ip.
+func webhookAllowedIP(ip net.IP) bool {
+	if WebhookAllowPrivate {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// Whether the host of rawURL only resolves to addresses webhooks may be delivered to. A host which
+// doesn't resolve passes, deliveries to it fail until it does and get checked again then.
+func webhookAllowedURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return webhookAllowedIP(ip)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return true
+	}
+	for _, ip := range ips {
+		if !webhookAllowedIP(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func webhookDialControl(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !webhookAllowedIP(ip) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+func newWebhookSecret() string {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return common.RandString(48)
+	}
+	return hex.EncodeToString(secret)
+}
+
+// The signature sent in the X-Webhook-Signature header, receivers compute it over the raw body
+// with the secret they got when registering the webhook and compare.
+// 	signature := SignWebhookPayload(webhook.Secret, body)  // "sha256=5d41..."
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// How long to wait before the next try after attempts failed ones.
+func WebhookBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 16 {
+		attempts = 16
+	}
+	return WebhookRetryDelay << uint(attempts-1)
+}
+
+var webhookWake = make(chan struct{}, 1)
+
+// Queue event for the active webhooks subscribed to it, of the users it involves and of admins.
+// Every receiver gets the same payload, data must not depend on who's looking. key is sent as the
+// payload's id, a webhook which already got a delivery with the same key doesn't get another one.
+// 	err := DispatchWebhook(meta.Key, WebhookUserFollowed, payload, followed.ID, follower.ID)
+func DispatchWebhook(key, event string, data interface{}, userIDs ...uint) error {
+	db := common.GetDB()
+	var webhooks []WebhookModel
+	if err := db.Where("active = ? AND events LIKE ?", true, "%"+event+"%").Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	var ownerIDs []uint
+	for _, webhook := range webhooks {
+		ownerIDs = append(ownerIDs, webhook.OwnerID)
+	}
+	var owners []UserModel
+	if err := db.Where("id in (?)", ownerIDs).Find(&owners).Error; err != nil {
+		return err
+	}
+	ownersByID := map[uint]UserModel{}
+	for _, owner := range owners {
+		ownersByID[owner.ID] = owner
+	}
+	involved := map[uint]bool{}
+	for _, id := range userIDs {
+		involved[id] = true
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":        key,
+		"event":     event,
+		"createdAt": now.UTC().Format("2006-01-02T15:04:05.999Z"),
+		"data":      data,
+	})
+	if err != nil {
+		return err
+	}
+	// Any error goes back to the outbox, which retries the whole event
+	err = common.Transaction(func(tx *gorm.DB) error {
+		for _, webhook := range webhooks {
+			owner, ok := ownersByID[webhook.OwnerID]
+			if !ok || !webhook.subscribed(event) || !(involved[owner.ID] || owner.HasRole(RoleAdmin)) {
+				continue
+			}
+			var delivered int
+			if err := tx.Model(&WebhookDeliveryModel{}).Where(WebhookDeliveryModel{WebhookID: webhook.ID, Key: key}).Count(&delivered).Error; err != nil {
+				return err
+			}
+			if delivered > 0 {
+				continue
+			}
+			err := tx.Create(&WebhookDeliveryModel{
+				WebhookID:     webhook.ID,
+				Key:           key,
+				Event:         event,
+				Payload:       string(payload),
+				Status:        DeliveryPending,
+				NextAttemptAt: now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// POST the payload to the webhook once and record how it went.
+func (delivery *WebhookDeliveryModel) attempt(now time.Time) error {
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+	req, err := http.NewRequest("POST", delivery.Webhook.URL, strings.NewReader(delivery.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "realworld-webhooks")
+		req.Header.Set("X-Webhook-Event", delivery.Event)
+		req.Header.Set("X-Webhook-Delivery", fmt.Sprint(delivery.ID))
+		req.Header.Set("X-Webhook-Signature", SignWebhookPayload(delivery.Webhook.Secret, []byte(delivery.Payload)))
+		var resp *http.Response
+		if resp, err = WebhookClient.Do(req); err == nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			delivery.ResponseStatus = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("Receiver answered %v", resp.Status)
+			}
+		}
+	}
+	switch {
+	case err == nil:
+		delivery.Status = DeliveryDelivered
+	case delivery.Attempts >= WebhookMaxAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(WebhookBackoff(delivery.Attempts))
+		delivery.Error = err.Error()
+	}
+	if len(delivery.Error) > 1024 {
+		delivery.Error = delivery.Error[:1024]
+	}
+	db := common.GetDB()
+	return db.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"error":           delivery.Error,
+	}).Error
+}
+
+// Try the deliveries which are due, oldest first, and return how many were tried.
+// A delivery for a webhook which got deleted or deactivated in the meantime fails right away.
+func DeliverWebhooks(now time.Time) (int, error) {
+	db := common.GetDB()
+	var deliveries []WebhookDeliveryModel
+	err := db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).Order("id asc").Limit(100).Find(&deliveries).Error
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+	var webhookIDs []uint
+	for _, delivery := range deliveries {
+		webhookIDs = append(webhookIDs, delivery.WebhookID)
+	}
+	var webhooks []WebhookModel
+	db.Where("id in (?)", webhookIDs).Find(&webhooks)
+	webhooksByID := map[uint]WebhookModel{}
+	for _, webhook := range webhooks {
+		webhooksByID[webhook.ID] = webhook
+	}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		webhook, ok := webhooksByID[delivery.WebhookID]
+		if !ok || !webhook.Active {
+			db.Model(delivery).Updates(map[string]interface{}{"status": DeliveryFailed, "error": "Webhook is gone or inactive"})
+			continue
+		}
+		delivery.Webhook = webhook
+		if err := delivery.attempt(now); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// Deliver webhooks as they get queued, and every interval for the retries, until stop is closed.
+//
+//	go RunWebhookDeliveries(10*time.Second, nil)
+func RunWebhookDeliveries(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := DeliverWebhooks(time.Now()); err != nil {
+			fmt.Println("webhook err: (RunWebhookDeliveries) ", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// The webhooks of u, oldest first.
+func (u UserModel) findWebhooks() ([]WebhookModel, error) {
+	db := common.GetDB()
+	var models []WebhookModel
+	err := db.Where(WebhookModel{OwnerID: u.ID}).Order("id asc").Find(&models).Error
+	return models, err
+}
+
+func (u UserModel) findWebhook(id uint) (WebhookModel, error) {
+	db := common.GetDB()
+	var model WebhookModel
+	err := db.Where(WebhookModel{OwnerID: u.ID}).First(&model, id).Error
+	return model, err
+}
+
+// The delivery log of w, newest first, with the total number of deliveries.
+func (w WebhookModel) findDeliveries(limit, offset int) ([]WebhookDeliveryModel, int, error) {
+	db := common.GetDB()
+	var models []WebhookDeliveryModel
+	var count int
+	query := db.Model(&WebhookDeliveryModel{}).Where(WebhookDeliveryModel{WebhookID: w.ID})
+	query.Count(&count)
+	err := query.Order("id desc").Offset(offset).Limit(limit).Find(&models).Error
+	return models, count, err
+}
@@ -2,9 +2,12 @@ package users
 
 import (
 	"errors"
+	"fmt"
 	"realworld-backend/common"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func UsersRegister(router *gin.RouterGroup) {
@@ -15,6 +18,39 @@ func UsersRegister(router *gin.RouterGroup) {
 func UserRegister(router *gin.RouterGroup) {
 	router.GET("/", UserRetrieve)
 	router.PUT("/", UserUpdate)
+	router.POST("/avatar", AvatarUpload)
+	router.DELETE("/avatar", AvatarDelete)
+	router.GET("/notifications", NotificationList)
+	router.POST("/notifications/read", NotificationReadAll)
+	router.POST("/notifications/:id/read", NotificationRead)
+	router.GET("/notifications/preferences", NotificationPreferencesRetrieve)
+	router.PUT("/notifications/preferences", NotificationPreferencesUpdate)
+	router.GET("/webhooks", WebhookList)
+	router.POST("/webhooks", WebhookCreate)
+	router.PUT("/webhooks/:id", WebhookUpdate)
+	router.DELETE("/webhooks/:id", WebhookDelete)
+	router.GET("/webhooks/:id/deliveries", WebhookDeliveryList)
+}
+
+// Hook the side effects of this package up to the domain events, see common.DispatchEvents.
+func SubscribeEvents() {
+	common.Subscribe("users.notify-follow", func(meta common.EventMeta, event UserFollowed) error {
+		return Notify(NotificationModel{RecipientID: event.FollowingID, ActorID: event.FollowerID, Type: NotificationFollow})
+	})
+	common.Subscribe("users.webhook-follow", func(meta common.EventMeta, event UserFollowed) error {
+		follower, err := FindOneUser(&UserModel{ID: event.FollowerID})
+		if err != nil {
+			return nil
+		}
+		following, err := FindOneUser(&UserModel{ID: event.FollowingID})
+		if err != nil {
+			return nil
+		}
+		return DispatchWebhook(meta.Key, WebhookUserFollowed, gin.H{
+			"follower":  gin.H{"username": follower.Username},
+			"following": gin.H{"username": following.Username},
+		}, following.ID, follower.ID)
+	})
 }
 
 func ProfileRegister(router *gin.RouterGroup) {
@@ -75,6 +111,8 @@ func UsersRegistration(c *gin.Context) {
 		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
 		return
 	}
+	joinedAt := time.Now()
+	userModelValidator.userModel.JoinedAt = &joinedAt
 
 	if err := SaveOne(&userModelValidator.userModel); err != nil {
 		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
@@ -120,6 +158,13 @@ func UserUpdate(c *gin.Context) {
 		return
 	}
 
+	// An image URL replaces the uploaded avatar, the validator only has one when it was sent
+	if userModelValidator.User.Image != "" && myUserModel.ImageKey != "" {
+		if err := myUserModel.setAvatar(""); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+			return
+		}
+	}
 	userModelValidator.userModel.ID = myUserModel.ID
 	if err := myUserModel.Update(userModelValidator.userModel); err != nil {
 		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
@@ -129,3 +174,200 @@ func UserUpdate(c *gin.Context) {
 	serializer := UserSerializer{c}
 	c.JSON(http.StatusOK, gin.H{"user": serializer.Response()})
 }
+
+// Upload an avatar as the "image" field of a multipart form, it's cropped to a square of AvatarSize pixels.
+func AvatarUpload(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	img, contentType, err := common.ReadImageUpload(c, "image")
+	if err != nil {
+		c.JSON(common.UploadErrorStatus(err), common.NewError("image", err))
+		return
+	}
+	key, _, err := common.StoreImage(fmt.Sprintf("avatars/%v/", myUserModel.ID), common.FillImage(img, AvatarSize, AvatarSize), contentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, common.NewError("storage", err))
+		return
+	}
+	if err := myUserModel.setAvatar(key); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	UpdateContextUserModel(c, myUserModel.ID)
+	serializer := UserSerializer{c}
+	c.JSON(http.StatusOK, gin.H{"user": serializer.Response()})
+}
+
+func AvatarDelete(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	if err := myUserModel.setAvatar(""); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	UpdateContextUserModel(c, myUserModel.ID)
+	serializer := UserSerializer{c}
+	c.JSON(http.StatusOK, gin.H{"user": serializer.Response()})
+}
+
+// Newest first, paged with ?limit= and ?offset=, ?unread=true leaves out what was read
+func NotificationList(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	notificationModels, count, err := myUserModel.findNotifications(c.Query("unread") == "true", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("notifications", errors.New("Invalid param")))
+		return
+	}
+	serializer := NotificationsSerializer{c, notificationModels}
+	c.JSON(http.StatusOK, gin.H{
+		"notifications":      serializer.Response(),
+		"notificationsCount": count,
+		"unreadCount":        myUserModel.unreadNotificationsCount(),
+	})
+}
+
+func NotificationRead(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("notification", errors.New("Invalid id")))
+		return
+	}
+	if err := myUserModel.markNotificationRead(uint(id64)); err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("notification", errors.New("Invalid id")))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unreadCount": myUserModel.unreadNotificationsCount()})
+}
+
+func NotificationReadAll(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	if err := myUserModel.markAllNotificationsRead(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unreadCount": 0})
+}
+
+func NotificationPreferencesRetrieve(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	c.JSON(http.StatusOK, gin.H{"preferences": myUserModel.notificationPreferences()})
+}
+
+func NotificationPreferencesUpdate(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	preferencesValidator := NewNotificationPreferencesValidator()
+	if err := preferencesValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := myUserModel.setNotificationPreferences(preferencesValidator.Preferences); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preferences": myUserModel.notificationPreferences()})
+}
+
+func WebhookList(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	webhookModels, err := myUserModel.findWebhooks()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := WebhooksSerializer{c, webhookModels}
+	c.JSON(http.StatusOK, gin.H{"webhooks": serializer.Response()})
+}
+
+// The response carries the secret to verify signatures with, it's not shown again.
+func WebhookCreate(c *gin.Context) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	webhookValidator := NewWebhookValidator()
+	if err := webhookValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	webhookValidator.webhookModel.OwnerID = myUserModel.ID
+	if err := SaveOne(&webhookValidator.webhookModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := WebhookSerializer{c, webhookValidator.webhookModel}
+	response := serializer.Response()
+	response.Secret = webhookValidator.webhookModel.Secret
+	c.JSON(http.StatusCreated, gin.H{"webhook": response})
+}
+
+func WebhookUpdate(c *gin.Context) {
+	webhookModel, ok := findWebhookParam(c)
+	if !ok {
+		return
+	}
+	webhookValidator := NewWebhookValidatorFillWith(webhookModel)
+	if err := webhookValidator.Bind(c); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewValidatorError(err))
+		return
+	}
+	if err := SaveOne(&webhookValidator.webhookModel); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	serializer := WebhookSerializer{c, webhookValidator.webhookModel}
+	c.JSON(http.StatusOK, gin.H{"webhook": serializer.Response()})
+}
+
+func WebhookDelete(c *gin.Context) {
+	webhookModel, ok := findWebhookParam(c)
+	if !ok {
+		return
+	}
+	db := common.GetDB()
+	if err := db.Delete(&webhookModel).Error; err != nil {
+		c.JSON(http.StatusUnprocessableEntity, common.NewError("database", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhook": "Delete success"})
+}
+
+// Newest first, paged with ?limit= and ?offset=
+func WebhookDeliveryList(c *gin.Context) {
+	webhookModel, ok := findWebhookParam(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	deliveryModels, count, err := webhookModel.findDeliveries(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusNotFound, common.NewError("deliveries", errors.New("Invalid param")))
+		return
+	}
+	serializer := WebhookDeliveriesSerializer{c, deliveryModels}
+	c.JSON(http.StatusOK, gin.H{"deliveries": serializer.Response(), "deliveriesCount": count})
+}
+
+// Find the webhook of the current user named by :id, answering with 404 when there's none.
+func findWebhookParam(c *gin.Context) (WebhookModel, bool) {
+	myUserModel := c.MustGet("my_user_model").(UserModel)
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err == nil {
+		webhookModel, err := myUserModel.findWebhook(uint(id64))
+		if err == nil {
+			return webhookModel, true
+		}
+	}
+	c.JSON(http.StatusNotFound, common.NewError("webhook", errors.New("Invalid id")))
+	return WebhookModel{}, false
+}
@@ -1,6 +1,8 @@
 package users
 
 import (
+	"encoding/json"
+
 	"github.com/gin-gonic/gin"
 
 	"realworld-backend/common"
@@ -27,7 +29,7 @@ func (self *ProfileSerializer) Response() ProfileResponse {
 		ID:        self.ID,
 		Username:  self.Username,
 		Bio:       self.Bio,
-		Image:     self.Image,
+		Image:     self.ImageURL(),
 		Following: myUserModel.isFollowing(self.UserModel),
 	}
 	return profile
@@ -51,8 +53,141 @@ func (self *UserSerializer) Response() UserResponse {
 		Username: myUserModel.Username,
 		Email:    myUserModel.Email,
 		Bio:      myUserModel.Bio,
-		Image:    myUserModel.Image,
+		Image:    myUserModel.ImageURL(),
 		Token:    common.GenToken(myUserModel.ID),
 	}
 	return user
 }
+
+type NotificationSerializer struct {
+	C *gin.Context
+	NotificationModel
+}
+
+type NotificationArticleResponse struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type NotificationResponse struct {
+	ID        uint                         `json:"id"`
+	Type      string                       `json:"type"`
+	Actor     ProfileResponse              `json:"actor"`
+	Article   *NotificationArticleResponse `json:"article,omitempty"`
+	CommentID uint                         `json:"commentId,omitempty"`
+	Read      bool                         `json:"read"`
+	CreatedAt string                       `json:"createdAt"`
+}
+
+func (self *NotificationSerializer) Response() NotificationResponse {
+	actorSerializer := ProfileSerializer{self.C, self.Actor}
+	response := NotificationResponse{
+		ID:        self.ID,
+		Type:      self.Type,
+		Actor:     actorSerializer.Response(),
+		CommentID: self.CommentID,
+		Read:      self.ReadAt != nil,
+		CreatedAt: self.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+	if self.ArticleSlug != "" {
+		response.Article = &NotificationArticleResponse{self.ArticleSlug, self.ArticleTitle}
+	}
+	return response
+}
+
+type NotificationsSerializer struct {
+	C             *gin.Context
+	Notifications []NotificationModel
+}
+
+func (self *NotificationsSerializer) Response() []NotificationResponse {
+	response := []NotificationResponse{}
+	for _, notification := range self.Notifications {
+		serializer := NotificationSerializer{self.C, notification}
+		response = append(response, serializer.Response())
+	}
+	return response
+}
+
+type WebhookSerializer struct {
+	C *gin.Context
+	WebhookModel
+}
+
+// Secret is only shown once, when the webhook gets created.
+type WebhookResponse struct {
+	ID        uint     `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+func (self *WebhookSerializer) Response() WebhookResponse {
+	return WebhookResponse{
+		ID:        self.ID,
+		URL:       self.URL,
+		Events:    self.eventList(),
+		Active:    self.Active,
+		CreatedAt: self.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		UpdatedAt: self.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+	}
+}
+
+type WebhooksSerializer struct {
+	C        *gin.Context
+	Webhooks []WebhookModel
+}
+
+func (self *WebhooksSerializer) Response() []WebhookResponse {
+	response := []WebhookResponse{}
+	for _, webhook := range self.Webhooks {
+		serializer := WebhookSerializer{self.C, webhook}
+		response = append(response, serializer.Response())
+	}
+	return response
+}
+
+type WebhookDeliveriesSerializer struct {
+	C          *gin.Context
+	Deliveries []WebhookDeliveryModel
+}
+
+// NextAttemptAt is only set while the delivery is pending.
+type WebhookDeliveryResponse struct {
+	ID             uint            `json:"id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	NextAttemptAt  *string         `json:"nextAttemptAt"`
+	CreatedAt      string          `json:"createdAt"`
+	UpdatedAt      string          `json:"updatedAt"`
+}
+
+func (self *WebhookDeliveriesSerializer) Response() []WebhookDeliveryResponse {
+	response := []WebhookDeliveryResponse{}
+	for _, delivery := range self.Deliveries {
+		deliveryResponse := WebhookDeliveryResponse{
+			ID:             delivery.ID,
+			Event:          delivery.Event,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			ResponseStatus: delivery.ResponseStatus,
+			Error:          delivery.Error,
+			Payload:        json.RawMessage(delivery.Payload),
+			CreatedAt:      delivery.CreatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+			UpdatedAt:      delivery.UpdatedAt.UTC().Format("2006-01-02T15:04:05.999Z"),
+		}
+		if delivery.Status == DeliveryPending {
+			nextAttemptAt := delivery.NextAttemptAt.UTC().Format("2006-01-02T15:04:05.999Z")
+			deliveryResponse.NextAttemptAt = &nextAttemptAt
+		}
+		response = append(response, deliveryResponse)
+	}
+	return response
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"realworld-backend/common"
 	_ "regexp"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
@@ -93,11 +94,164 @@ func TestUserModel(t *testing.T) {
 	asserts.Equal(false, a.isFollowing(b), "isFollowing should be right after a unFollowing b")
 }
 
+func TestUserRoles(t *testing.T) {
+	asserts := assert.New(t)
+
+	userModel := newUserModel()
+	asserts.False(userModel.HasRole(RoleModerator), "regular user should not be a moderator")
+	userModel.Role = RoleModerator
+	asserts.True(userModel.HasRole(RoleModerator), "moderator should be a moderator")
+	asserts.False(userModel.HasRole(RoleAdmin), "moderator should not be an admin")
+	userModel.Role = RoleAdmin
+	asserts.True(userModel.HasRole(RoleModerator), "admin should hold every role")
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("my_user_model", newUserModel()) })
+	r.GET("/admin", RequireRole(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	r.ServeHTTP(w, req)
+	asserts.Equal(http.StatusForbidden, w.Code, "user without role should be forbidden")
+}
+
+func TestUserSuspension(t *testing.T) {
+	asserts := assert.New(t)
+
+	userModel := userModelMocker(1)[0]
+	asserts.False(userModel.IsSuspended(), "new user should not be suspended")
+	asserts.NoError(userModel.Warn(), "warning should work")
+	asserts.NoError(userModel.Suspend(time.Now().Add(time.Hour)), "suspending should work")
+	userModel, _ = FindOneUser(&UserModel{ID: userModel.ID})
+	asserts.Equal(uint(2), userModel.Warnings, "warning and suspension should both count")
+	asserts.True(userModel.IsSuspended(), "user should be suspended")
+
+	r := gin.New()
+	r.Use(AuthMiddleware(true))
+	r.GET("/user", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.PUT("/user", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for method, code := range map[string]int{"GET": http.StatusOK, "PUT": http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/user", nil)
+		HeaderTokenMock(req, userModel.ID)
+		r.ServeHTTP(w, req)
+		asserts.Equal(code, w.Code, "suspended user should only be able to read")
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	asserts := assert.New(t)
+
+	mocked := userModelMocker(2)
+	a, b := mocked[0], mocked[1]
+	asserts.NoError(Notify(NotificationModel{RecipientID: a.ID, ActorID: a.ID, Type: NotificationFollow}), "notifying oneself should not error")
+	asserts.NoError(Notify(NotificationModel{RecipientID: a.ID, ActorID: b.ID, Type: NotificationFollow}), "notifying should work")
+	asserts.NoError(Notify(NotificationModel{RecipientID: a.ID, ActorID: b.ID, Type: NotificationFollow}), "notifying again should not error")
+	notifications, count, err := a.findNotifications(false, 20, 0)
+	asserts.NoError(err, "finding notifications should not error")
+	asserts.Equal(1, count, "self and repeated unread notifications should be left out")
+	asserts.Equal(b.Username, notifications[0].Actor.Username, "actor should be loaded")
+	asserts.Equal(1, a.unreadNotificationsCount(), "notification should be unread")
+
+	asserts.Error(b.markNotificationRead(notifications[0].ID), "only the recipient should mark a notification read")
+	asserts.NoError(a.markNotificationRead(notifications[0].ID), "marking read should work")
+	asserts.Equal(0, a.unreadNotificationsCount(), "notification should be read")
+	_, count, _ = a.findNotifications(true, 20, 0)
+	asserts.Equal(0, count, "read notifications should be left out of unread ones")
+
+	asserts.NoError(a.setNotificationPreferences(map[string]bool{NotificationFavorite: false}), "setting preferences should work")
+	preferences := a.notificationPreferences()
+	asserts.False(preferences[NotificationFavorite], "favorite notifications should be off")
+	asserts.True(preferences[NotificationFollow], "other notifications should stay on")
+	Notify(NotificationModel{RecipientID: a.ID, ActorID: b.ID, Type: NotificationFavorite, ArticleSlug: "slug"})
+	asserts.Equal(0, a.unreadNotificationsCount(), "turned off notifications should not be delivered")
+
+	Notify(NotificationModel{RecipientID: a.ID, ActorID: b.ID, Type: NotificationComment, ArticleSlug: "slug", CommentID: 1})
+	Notify(NotificationModel{RecipientID: a.ID, ActorID: b.ID, Type: NotificationComment, ArticleSlug: "slug", CommentID: 2})
+	asserts.Equal(2, a.unreadNotificationsCount(), "notifications about different comments should all be delivered")
+	asserts.NoError(a.markAllNotificationsRead(), "marking all read should work")
+	asserts.Equal(0, a.unreadNotificationsCount(), "every notification should be read")
+}
+
+func TestWebhookDispatch(t *testing.T) {
+	asserts := assert.New(t)
+
+	mocked := userModelMocker(3)
+	owner, admin, other := mocked[0], mocked[1], mocked[2]
+	test_db.Model(&admin).UpdateColumn("role", RoleAdmin)
+	ownerHook := WebhookModel{OwnerID: owner.ID, URL: "http://127.0.0.1:1/hook", Secret: "s", Events: WebhookUserFollowed, Active: true}
+	adminHook := WebhookModel{OwnerID: admin.ID, URL: "http://127.0.0.1:1/hook", Secret: "s", Events: WebhookUserFollowed + " " + WebhookArticleCreated, Active: true}
+	SaveOne(&ownerHook)
+	SaveOne(&adminHook)
+
+	asserts.NoError(DispatchWebhook("key-1", WebhookUserFollowed, map[string]string{"a": "b"}, owner.ID), "dispatching should work")
+	asserts.NoError(DispatchWebhook("key-2", WebhookUserFollowed, nil, other.ID), "dispatching should work")
+	asserts.NoError(DispatchWebhook("key-3", WebhookArticleCreated, nil, owner.ID), "dispatching should work")
+	deliveries, count, _ := ownerHook.findDeliveries(10, 0)
+	asserts.Equal(1, count, "owner should only get subscribed events involving them")
+	asserts.Contains(deliveries[0].Payload, `"data":{"a":"b"}`, "payload should carry the data")
+	_, count, _ = adminHook.findDeliveries(10, 0)
+	asserts.Equal(3, count, "admin should get every subscribed event")
+
+	asserts.Equal("sha256=b82fcb791acec57859b989b430a826488ce2e479fdf92326bd0a2e8375a42ba4", SignWebhookPayload("secret", []byte("payload")), "signature should be sha256 HMAC")
+	asserts.Equal(2*WebhookBackoff(1), WebhookBackoff(2), "backoff should double")
+
+	// Unreachable receivers are retried until attempts run out
+	maxAttempts := WebhookMaxAttempts
+	WebhookMaxAttempts = 2
+	defer func() { WebhookMaxAttempts = maxAttempts }()
+	now := time.Now()
+	tried, err := DeliverWebhooks(now)
+	asserts.NoError(err, "delivering should work")
+	asserts.Equal(4, tried, "every due delivery should be tried")
+	tried, _ = DeliverWebhooks(now.Add(WebhookBackoff(1) + time.Second))
+	asserts.Equal(4, tried, "failed deliveries should be retried after the backoff")
+	deliveries, _, _ = ownerHook.findDeliveries(10, 0)
+	asserts.Equal(DeliveryFailed, deliveries[0].Status, "delivery should fail once attempts run out")
+	asserts.Equal(2, deliveries[0].Attempts, "every attempt should be counted")
+	asserts.NotEmpty(deliveries[0].Error, "error should be recorded")
+
+	// A delivery which can't be stored fails the dispatch, so the outbox tries the event again
+	test_db.DropTable(&WebhookDeliveryModel{})
+	defer test_db.AutoMigrate(&WebhookDeliveryModel{})
+	asserts.Error(DispatchWebhook("key-4", WebhookUserFollowed, nil, owner.ID), "dispatching should fail without deliveries")
+}
+
+func TestWebhookAddresses(t *testing.T) {
+	asserts := assert.New(t)
+
+	for _, url := range []string{"http://127.0.0.1/hook", "http://localhost:8080/hook", "http://10.1.2.3/hook",
+		"http://192.168.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+		asserts.False(webhookAllowedURL(url), "private receivers should be refused: "+url)
+	}
+	asserts.True(webhookAllowedURL("https://93.184.216.34/hook"), "public receivers should be allowed")
+
+	// Checked again once connecting, whatever the name resolved to
+	redirected := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			redirected = true
+		}
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	}))
+	defer receiver.Close()
+	_, err := WebhookClient.Post(receiver.URL, "application/json", bytes.NewBufferString("{}"))
+	asserts.ErrorIs(err, errWebhookAddress, "connecting to a private address should fail")
+
+	WebhookAllowPrivate = true
+	defer func() { WebhookAllowPrivate = false }()
+	resp, err := WebhookClient.Post(receiver.URL, "application/json", bytes.NewBufferString("{}"))
+	asserts.NoError(err, "private receivers should work when allowed")
+	resp.Body.Close()
+	asserts.Equal(http.StatusFound, resp.StatusCode, "redirects should not be followed")
+	asserts.False(redirected, "redirects should not be followed")
+}
+
 // Reset test DB and create new one with mock data
 func resetDBWithMock() {
 	common.TestDBFree(test_db)
 	test_db = common.TestDBInit()
 	AutoMigrate()
+	test_db.AutoMigrate(&common.OutboxModel{}, &common.OutboxReceiptModel{})
 	userModelMocker(3)
 }
 
@@ -489,6 +643,7 @@ func TestMain(m *testing.M) {
 
 	test_db = common.TestDBInit()
 	AutoMigrate()
+	test_db.AutoMigrate(&common.OutboxModel{}, &common.OutboxReceiptModel{})
 	exitVal := m.Run()
 	common.TestDBFree(test_db)
 	os.Exit(exitVal)
@@ -3,8 +3,27 @@ package users
 import (
 	"realworld-backend/common"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"strings"
 )
 
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("webhookurl", func(fl validator.FieldLevel) bool {
+			return webhookAllowedURL(fl.Field().String())
+		})
+		v.RegisterValidation("notificationtype", func(fl validator.FieldLevel) bool {
+			for _, notificationType := range NotificationTypes {
+				if fl.Field().String() == notificationType {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
 // *ModelValidator containing two parts:
 // - Validator: write the form/json checking rule according to the doc https://github.com/go-playground/validator
 // - DataModel: fill with data from Validator after invoking common.Bind(c, self)
@@ -84,3 +103,52 @@ func NewLoginValidator() LoginValidator {
 	loginValidator := LoginValidator{}
 	return loginValidator
 }
+
+type NotificationPreferencesValidator struct {
+	Preferences map[string]bool `form:"preferences" json:"preferences" binding:"required,dive,keys,notificationtype,endkeys"`
+}
+
+func NewNotificationPreferencesValidator() NotificationPreferencesValidator {
+	return NotificationPreferencesValidator{}
+}
+
+func (self *NotificationPreferencesValidator) Bind(c *gin.Context) error {
+	return common.Bind(c, self)
+}
+
+type WebhookValidator struct {
+	Webhook struct {
+		URL    string   `form:"url" json:"url" binding:"required,url,startswith=http,max=2048,webhookurl"`
+		Events []string `form:"events" json:"events" binding:"required,min=1,dive,oneof=article.created article.updated article.deleted comment.created comment.updated user.followed"`
+		Active *bool    `form:"active" json:"active"`
+	} `json:"webhook"`
+	webhookModel WebhookModel `json:"-"`
+}
+
+// A new webhook is active unless asked otherwise and gets a fresh secret.
+func NewWebhookValidator() WebhookValidator {
+	webhookValidator := WebhookValidator{}
+	webhookValidator.webhookModel.Active = true
+	webhookValidator.webhookModel.Secret = newWebhookSecret()
+	return webhookValidator
+}
+
+func NewWebhookValidatorFillWith(webhookModel WebhookModel) WebhookValidator {
+	webhookValidator := WebhookValidator{webhookModel: webhookModel}
+	webhookValidator.Webhook.URL = webhookModel.URL
+	webhookValidator.Webhook.Events = webhookModel.eventList()
+	return webhookValidator
+}
+
+func (self *WebhookValidator) Bind(c *gin.Context) error {
+	err := common.Bind(c, self)
+	if err != nil {
+		return err
+	}
+	self.webhookModel.URL = self.Webhook.URL
+	self.webhookModel.Events = strings.Join(self.Webhook.Events, " ")
+	if self.Webhook.Active != nil {
+		self.webhookModel.Active = *self.Webhook.Active
+	}
+	return nil
+}